@@ -0,0 +1,235 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type apiRepository struct {
+	Name        string    `json:"name"`
+	Path        string    `json:"path"`
+	Commits     int       `json:"commits"`
+	Authors     int       `json:"authors"`
+	Additions   int       `json:"additions"`
+	Deletions   int       `json:"deletions"`
+	FirstCommit time.Time `json:"first_commit"`
+	LastCommit  time.Time `json:"last_commit"`
+}
+
+type apiAuthor struct {
+	Author    string `json:"author"`
+	Email     string `json:"email"`
+	Commits   int    `json:"commits"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+}
+
+type apiCommit struct {
+	Hash       string    `json:"hash"`
+	Repository string    `json:"repository"`
+	Author     string    `json:"author"`
+	Email      string    `json:"email"`
+	Date       time.Time `json:"date"`
+	Message    string    `json:"message"`
+}
+
+type commitFilter struct {
+	Repository string
+	Author     string
+	Since      string
+	Until      string
+	Limit      int
+}
+
+func (f commitFilter) validate() error {
+	for _, date := range []string{f.Since, f.Until} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			return fmt.Errorf("invalid date: %s", date)
+		}
+	}
+	return nil
+}
+
+// loadCommits returns commits newest first. Since and until are inclusive
+// YYYY-MM-DD dates.
+func loadCommits(db *sql.DB, filter commitFilter) ([]apiCommit, error) {
+	query := `
+		SELECT c.hash, r.name, c.author, c.email, c.date, c.message
+		FROM commits c
+		JOIN repositories r ON r.id = c.repository_id
+		WHERE 1 = 1`
+	var params []any
+	if filter.Repository != "" {
+		query += " AND r.name = ?"
+		params = append(params, filter.Repository)
+	}
+	if filter.Author != "" {
+		query += " AND c.email = ?"
+		params = append(params, filter.Author)
+	}
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	if filter.Since != "" {
+		since, _ := time.Parse(time.DateOnly, filter.Since)
+		query += " AND c.report_date >= ?"
+		params = append(params, since)
+	}
+	if filter.Until != "" {
+		until, _ := time.Parse(time.DateOnly, filter.Until)
+		query += " AND c.report_date < ?"
+		params = append(params, until.AddDate(0, 0, 1))
+	}
+	query += " ORDER BY c.date DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		params = append(params, filter.Limit)
+	}
+
+	rows, err := db.Query(query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	commits := []apiCommit{}
+	for rows.Next() {
+		var c apiCommit
+		if err := rows.Scan(&c.Hash, &c.Repository, &c.Author, &c.Email, &c.Date, &c.Message); err != nil {
+			return nil, err
+		}
+		commits = append(commits, c)
+	}
+	return commits, rows.Err()
+}
+
+// apiError is an error reported to the client with its own HTTP status.
+type apiError struct {
+	status int
+	error
+}
+
+func badRequest(err error) error {
+	return apiError{http.StatusBadRequest, err}
+}
+
+func apiHandler(fn func(r *http.Request) (any, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		value, err := fn(r)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if e, ok := err.(apiError); ok {
+				status = e.status
+			} else {
+				log.Printf("API error: %s: %v", r.URL.Path, err)
+			}
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(value)
+	})
+}
+
+// registerAPI adds the read-only REST endpoints to mux.
+func registerAPI(mux *http.ServeMux, db *sql.DB) {
+	mux.Handle("GET /repos", apiHandler(func(r *http.Request) (any, error) {
+		repos, err := loadRepositorySummaries(db)
+		if err != nil {
+			return nil, err
+		}
+		list := []apiRepository{}
+		for _, repo := range repos {
+			list = append(list, apiRepository{repo.Name, repo.Path, repo.Commits, repo.Authors,
+				repo.Additions, repo.Deletions, repo.FirstCommit, repo.LastCommit})
+		}
+		return list, nil
+	}))
+
+	mux.Handle("GET /authors", apiHandler(func(r *http.Request) (any, error) {
+		authors, err := loadAuthorSummaries(db)
+		if err != nil {
+			return nil, err
+		}
+		list := []apiAuthor{}
+		for _, a := range authors {
+			list = append(list, apiAuthor(a))
+		}
+		return list, nil
+	}))
+
+	mux.Handle("GET /components", apiHandler(func(r *http.Request) (any, error) {
+		components, err := loadComponentPatterns(db)
+		if err != nil {
+			return nil, err
+		}
+		names := []string{}
+		for _, comp := range components {
+			names = append(names, comp.name)
+		}
+		return names, nil
+	}))
+
+	mux.Handle("GET /components/{name}/contributions", apiHandler(func(r *http.Request) (any, error) {
+		name := r.PathValue("name")
+		var id int
+		err := db.QueryRow("SELECT id FROM components WHERE name = ?", name).Scan(&id)
+		if err == sql.ErrNoRows {
+			return nil, apiError{http.StatusNotFound, fmt.Errorf("unknown component: %s", name)}
+		} else if err != nil {
+			return nil, err
+		}
+		rows, err := db.Query(`
+			SELECT r.name, cc.author, cc.email, cc.commit_count, cc.total_additions, cc.total_deletions
+			FROM component_contributions cc
+			JOIN repositories r ON r.id = cc.repository_id
+			WHERE cc.component_id = ?
+			ORDER BY cc.commit_count DESC, cc.email
+		`, id)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		list := []jsonContribution{}
+		for rows.Next() {
+			var c jsonContribution
+			if err := rows.Scan(&c.Repository, &c.Author, &c.Email, &c.CommitCount, &c.TotalAdditions, &c.TotalDeletions); err != nil {
+				return nil, err
+			}
+			list = append(list, c)
+		}
+		return list, rows.Err()
+	}))
+
+	mux.Handle("GET /commits", apiHandler(func(r *http.Request) (any, error) {
+		q := r.URL.Query()
+		filter := commitFilter{
+			Repository: q.Get("repository"),
+			Author:     q.Get("author"),
+			Since:      q.Get("since"),
+			Until:      q.Get("until"),
+		}
+		if limit := q.Get("limit"); limit != "" {
+			n, err := strconv.Atoi(limit)
+			if err != nil {
+				return nil, badRequest(fmt.Errorf("invalid limit: %s", limit))
+			}
+			filter.Limit = n
+		}
+		if err := filter.validate(); err != nil {
+			return nil, badRequest(err)
+		}
+		return loadCommits(db, filter)
+	}))
+}
@@ -0,0 +1,92 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// AutoComponents generates components from the repositories, in addition to
+// the configured ones.
+type AutoComponents struct {
+	// Codeowners adds a component per owner, user or team, of the
+	// CODEOWNERS file of each repository, with the paths it owns.
+	Codeowners bool `yaml:"codeowners"`
+	// Directories adds a component per directory this deep in the
+	// repositories, 1 for the top-level ones; 0 adds none.
+	Directories int `yaml:"directories"`
+	// ByLanguage adds a component per language of the files of the
+	// repositories, for a language breakdown of the contributions.
+	ByLanguage bool `yaml:"by_language"`
+}
+
+// addAutoComponents adds the components generated from the repositories
+// as set in auto_components.
+func (c *Config) addAutoComponents() error {
+	if c.AutoComponents.Codeowners {
+		c.addCodeownersComponents()
+	}
+	if c.AutoComponents.Directories > 0 {
+		if err := c.addDirectoryComponents(c.AutoComponents.Directories); err != nil {
+			return err
+		}
+	}
+	if c.AutoComponents.ByLanguage {
+		if err := c.addLanguageComponents(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// repositoryDirectories returns the directories of a repository at
+// revision that are depth levels deep.
+func repositoryDirectories(repo Repository, revision string, depth int) ([]string, error) {
+	output, err := gitCommand(repo.Path, "ls-tree", "-r", "-d", "--name-only", revision).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git ls-tree failed: %v", err)
+	}
+	var dirs []string
+	for dir := range strings.Lines(string(output)) {
+		if dir = strings.TrimSuffix(dir, "\n"); strings.Count(dir, "/") == depth-1 {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs, nil
+}
+
+// addDirectoryComponents adds a component per directory depth levels deep
+// in the repositories, named by its path. The directories with the same
+// path in several repositories are one component. Configured components
+// with the same name are kept as they are.
+func (c *Config) addDirectoryComponents(depth int) error {
+	configured := make(map[string]bool)
+	for _, comp := range c.Components {
+		configured[comp.Name] = true
+	}
+	var generated []Component
+	for _, repo := range c.Repositories {
+		dirs, err := repositoryDirectories(repo, c.Filters.revision(), depth)
+		if err != nil {
+			return fmt.Errorf("%s: %v", repo.Name, err)
+		}
+		for _, dir := range dirs {
+			if configured[dir] {
+				continue
+			}
+			i := slices.IndexFunc(generated, func(comp Component) bool { return comp.Name == dir })
+			if i < 0 {
+				generated = append(generated, Component{Name: dir})
+				i = len(generated) - 1
+			}
+			generated[i].Paths = append(generated[i].Paths, repo.Name+":"+dir+"/**")
+		}
+	}
+	slog.Debug("Adding directory components", "depth", depth, "components", len(generated))
+	c.Components = append(c.Components, generated...)
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type badge struct {
+	file  string
+	label string
+	value string
+	color string
+}
+
+const (
+	badgeBlue  = "#007ec6"
+	badgeGreen = "#4c1"
+	badgeGrey  = "#9f9f9f"
+)
+
+func writeBadges(db *sql.DB, dir string) error {
+	report, err := loadReport(db)
+	if err != nil {
+		return err
+	}
+
+	cal, err := loadCalendar(db)
+	if err != nil {
+		return err
+	}
+	quarterStart := cal.startOfQuarter(time.Now())
+	var quarterCommits int
+	if err := db.QueryRow("SELECT COUNT(*) FROM commits WHERE report_date >= ?", quarterStart).Scan(&quarterCommits); err != nil {
+		return err
+	}
+
+	var totalCommits int
+	for _, repo := range report.Repositories {
+		totalCommits += repo.Commits
+	}
+
+	top := badge{"top-contributor.svg", "top contributor", "none", badgeGrey}
+	if len(report.Authors) > 0 {
+		top.value = report.Authors[0].Author
+		top.color = badgeGreen
+	}
+
+	badges := []badge{
+		{"commits.svg", "commits", fmt.Sprint(totalCommits), badgeBlue},
+		{"commits-quarter.svg", "commits this quarter", fmt.Sprint(quarterCommits), badgeBlue},
+		{"contributors.svg", "contributors", fmt.Sprint(len(report.Authors)), badgeBlue},
+		top,
+	}
+
+	slugs := make(slugger)
+	for _, repo := range report.Repositories {
+		badges = append(badges, badge{"repo-" + slugs.slug(repo.Name) + "-commits.svg", repo.Name + " commits", fmt.Sprint(repo.Commits), badgeBlue})
+	}
+	slugs = make(slugger)
+	for _, comp := range report.Components {
+		b := badge{"component-" + slugs.slug(comp.Name) + "-top-contributor.svg", comp.Name + " top contributor", "none", badgeGrey}
+		if len(comp.Contributors) > 0 {
+			b.value = comp.Contributors[0].Author
+			b.color = badgeGreen
+		}
+		badges = append(badges, b)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, b := range badges {
+		if err := os.WriteFile(filepath.Join(dir, b.file), []byte(badgeSVG(b.label, b.value, b.color)), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// badgeTextWidth approximates the rendered width of s in 11px Verdana.
+func badgeTextWidth(s string) int {
+	return len([]rune(s))*7 + 10
+}
+
+// badgeSVG renders a flat shields-style badge.
+func badgeSVG(label, value, color string) string {
+	label = xmlEscape(label)
+	value = xmlEscape(value)
+	lw := badgeTextWidth(label)
+	vw := badgeTextWidth(value)
+	w := lw + vw
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s: %s">`, w, label, value)
+	fmt.Fprintf(&b, `<title>%s: %s</title>`, label, value)
+	b.WriteString(`<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>`)
+	fmt.Fprintf(&b, `<clipPath id="r"><rect width="%d" height="20" rx="3" fill="#fff"/></clipPath>`, w)
+	fmt.Fprintf(&b, `<g clip-path="url(#r)"><rect width="%d" height="20" fill="#555"/><rect x="%d" width="%d" height="20" fill="%s"/><rect width="%d" height="20" fill="url(#s)"/></g>`,
+		lw, lw, vw, color, w)
+	b.WriteString(`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">`)
+	fmt.Fprintf(&b, `<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text><text x="%d" y="14">%s</text>`, lw/2, label, lw/2, label)
+	fmt.Fprintf(&b, `<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text><text x="%d" y="14">%s</text>`, lw+vw/2, value, lw+vw/2, value)
+	b.WriteString(`</g></svg>`)
+	return b.String()
+}
@@ -0,0 +1,104 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"slices"
+)
+
+// defaultBotPatterns match the usual automation accounts against
+// "Name <email>": GitHub apps (dependabot[bot], github-actions[bot]),
+// dependency updaters and addresses such as ci-bot@example.com.
+var defaultBotPatterns = []string{
+	`(?i)\[bot\]`,
+	`(?i)^(dependabot|renovate|greenkeeper|snyk-bot|pre-commit-ci|mergify|imgbot|allcontributors)\b`,
+	`(?i)[<._-]bot@`,
+}
+
+// botMatcher returns a function reporting whether an author is a bot,
+// matching the default patterns and those of bots.patterns.
+func (b BotOptions) botMatcher() (func(author, email string) bool, error) {
+	var patterns []*regexp.Regexp
+	for _, pattern := range append(slices.Clone(defaultBotPatterns), b.Patterns...) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bots pattern %q: %v", pattern, err)
+		}
+		patterns = append(patterns, re)
+	}
+	return func(author, email string) bool {
+		ident := author + " <" + email + ">"
+		return slices.ContainsFunc(patterns, func(re *regexp.Regexp) bool { return re.MatchString(ident) })
+	}, nil
+}
+
+// tagBots sets is_bot on the commits and co-authors of the database
+// according to isBot, so changed patterns also apply to commits ingested
+// before. It reports whether the commits with a rowid up to after, those
+// already aggregated in component contributions, changed.
+func tagBots(db *sql.DB, isBot func(author, email string) bool, after int64) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT author, email FROM commits
+		UNION SELECT author, email FROM commit_coauthors
+	`)
+	if err != nil {
+		return false, err
+	}
+	var bots [][2]string
+	for rows.Next() {
+		var author, email string
+		if err := rows.Scan(&author, &email); err != nil {
+			rows.Close()
+			return false, err
+		}
+		if isBot(author, email) {
+			bots = append(bots, [2]string{author, email})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+
+	var changed bool
+	err = withTempTable(tx, "bot_identities", "author TEXT NOT NULL, email TEXT NOT NULL", func() error {
+		for _, bot := range bots {
+			if _, err := tx.Exec("INSERT INTO temp.bot_identities (author, email) VALUES (?, ?)", bot[0], bot[1]); err != nil {
+				return err
+			}
+		}
+
+		const isBotIdentity = `EXISTS (SELECT 1 FROM temp.bot_identities b WHERE b.author = %[1]s.author AND b.email = %[1]s.email)`
+		commitBot := fmt.Sprintf(isBotIdentity, "commits")
+		coAuthorBot := fmt.Sprintf(isBotIdentity, "commit_coauthors")
+		err := tx.QueryRow(fmt.Sprintf(`
+			SELECT EXISTS (SELECT 1 FROM commits WHERE rowid <= ? AND is_bot != %s)
+				OR EXISTS (
+					SELECT 1 FROM commit_coauthors
+					JOIN commits c ON c.hash = commit_coauthors.commit_hash
+					WHERE c.rowid <= ? AND commit_coauthors.is_bot != %s)
+		`, commitBot, coAuthorBot), after, after).Scan(&changed)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(fmt.Sprintf("UPDATE commits SET is_bot = %[1]s WHERE is_bot != %[1]s", commitBot)); err != nil {
+			return err
+		}
+		_, err = tx.Exec(fmt.Sprintf("UPDATE commit_coauthors SET is_bot = %[1]s WHERE is_bot != %[1]s", coAuthorBot))
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return changed, tx.Commit()
+}
@@ -0,0 +1,96 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// branch is a local or remote-tracking branch of a repository.
+type branch struct {
+	Name     string
+	Tip      string
+	LastDate time.Time
+	// Ahead and Behind count the commits of the branch missing from the
+	// default branch, and those of the default branch missing from it.
+	Ahead  int
+	Behind int
+}
+
+// listBranches returns the local and remote-tracking branches of a
+// repository, compared to its default one.
+func listBranches(ctx context.Context, repo Repository, defaultBranch string) ([]branch, error) {
+	output, err := gitCommandContext(ctx, repo.Path, "for-each-ref", "--sort=refname",
+		"--format=%(refname:short)%00%(objectname)%00%(committerdate:iso-strict)%00%(symref)",
+		"refs/heads", "refs/remotes").Output()
+	if err != nil {
+		return nil, fmt.Errorf("git for-each-ref failed: %v", err)
+	}
+	var branches []branch
+	for line := range strings.Lines(string(output)) {
+		parts := strings.Split(strings.TrimSuffix(line, "\n"), "\x00")
+		// Symbolic refs such as origin/HEAD are aliases of another branch.
+		if len(parts) < 4 || parts[3] != "" {
+			continue
+		}
+		b := branch{Name: parts[0], Tip: parts[1]}
+		if b.LastDate, err = time.Parse(time.RFC3339, parts[2]); err != nil {
+			continue
+		}
+		output, err := gitCommandContext(ctx, repo.Path, "rev-list", "--left-right", "--count", defaultBranch+"..."+b.Tip).Output()
+		if err != nil {
+			return nil, fmt.Errorf("git rev-list %s failed: %v", b.Name, err)
+		}
+		counts := strings.Fields(string(output))
+		if len(counts) == 2 {
+			b.Behind, _ = strconv.Atoi(counts[0])
+			b.Ahead, _ = strconv.Atoi(counts[1])
+		}
+		branches = append(branches, b)
+	}
+	return branches, nil
+}
+
+// ingestBranches replaces the branches recorded for a repository with its
+// current ones. The default branch is the one ingested.
+func ingestBranches(ctx context.Context, db *sql.DB, repo Repository, repoID int, filters Filters) error {
+	defaultBranch := filters.revision()
+	branches, err := listBranches(ctx, repo, defaultBranch)
+	if err != nil {
+		return err
+	}
+	// HEAD is recorded as the branch it points to, if any.
+	if output, err := gitCommandContext(ctx, repo.Path, "rev-parse", "--abbrev-ref", defaultBranch).Output(); err == nil {
+		defaultBranch = strings.TrimSpace(string(output))
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM branches WHERE repository_id = ?", repoID); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`
+		INSERT INTO branches (repository_id, name, tip, last_commit_date, ahead, behind, is_default)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	for _, b := range branches {
+		if _, err := stmt.Exec(repoID, b.Name, b.Tip, b.LastDate, b.Ahead, b.Behind, b.Name == defaultBranch); err != nil {
+			return err
+		}
+	}
+	slog.Info("Ingested branches", "repo", repo.Name, "branches", len(branches))
+	return tx.Commit()
+}
@@ -0,0 +1,412 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// Terminal browser for an existing report database, built on bubbletea:
+// lists of repositories, authors and components drill down into commits and
+// their file changes, moving with the arrow keys.
+
+// browsePageSize is the number of items shown until the terminal size is
+// known.
+const browsePageSize = 20
+
+type browser struct {
+	db *sql.DB
+}
+
+type browseItem struct {
+	label string
+	open  func() (*browseList, error)
+}
+
+// browseList is a screen of the browser, header lines above a list of
+// items, the selected one at cursor and the first one shown at offset.
+type browseList struct {
+	title  string
+	header []string
+	items  []browseItem
+	cursor int
+	offset int
+}
+
+// browseModel is the bubbletea model of the browser, the lists opened so
+// far stacked with the one shown last.
+type browseModel struct {
+	lists  []*browseList
+	width  int
+	height int
+	err    error
+}
+
+var (
+	browseTitleStyle    = lipgloss.NewStyle().Bold(true)
+	browseSelectedStyle = lipgloss.NewStyle().Reverse(true)
+	browseHelpStyle     = lipgloss.NewStyle().Faint(true)
+)
+
+// openReportDatabase opens an existing report database read only.
+func openReportDatabase(path string) (*sql.DB, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func browse(path string, in io.Reader, out io.Writer) error {
+	db, err := openReportDatabase(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	b := &browser{db: db}
+	m := &browseModel{lists: []*browseList{{
+		title: path,
+		items: []browseItem{
+			{"Repositories", b.repositories},
+			{"Authors", b.authors},
+			{"Components", b.components},
+		},
+	}}}
+	final, err := tea.NewProgram(m, tea.WithInput(in), tea.WithOutput(out), tea.WithAltScreen()).Run()
+	if err != nil {
+		return err
+	}
+	return final.(*browseModel).err
+}
+
+func (m *browseModel) Init() tea.Cmd { return nil }
+
+func (m *browseModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	list := m.lists[len(m.lists)-1]
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "ctrl+c":
+			return m, tea.Quit
+		case "up", "k":
+			list.cursor--
+		case "down", "j":
+			list.cursor++
+		case "pgup", "ctrl+b":
+			list.cursor -= m.pageSize(list)
+		case "pgdown", "ctrl+f", " ":
+			list.cursor += m.pageSize(list)
+		case "home", "g":
+			list.cursor = 0
+		case "end", "G":
+			list.cursor = len(list.items) - 1
+		case "enter", "right", "l":
+			if list.cursor >= len(list.items) || list.items[list.cursor].open == nil {
+				break
+			}
+			next, err := list.items[list.cursor].open()
+			if err != nil {
+				m.err = err
+				return m, tea.Quit
+			}
+			m.lists = append(m.lists, next)
+			return m, nil
+		case "esc", "left", "h", "backspace":
+			// Going back from the first list quits.
+			if len(m.lists) == 1 {
+				return m, tea.Quit
+			}
+			m.lists = m.lists[:len(m.lists)-1]
+			return m, nil
+		}
+	}
+	list.cursor = max(0, min(list.cursor, len(list.items)-1))
+	// Scroll the selected item into view.
+	page := m.pageSize(list)
+	if list.cursor < list.offset {
+		list.offset = list.cursor
+	} else if list.cursor >= list.offset+page {
+		list.offset = list.cursor - page + 1
+	}
+	return m, nil
+}
+
+// pageSize returns the number of items of list fitting the terminal below
+// its title and header and above the help line.
+func (m *browseModel) pageSize(list *browseList) int {
+	if m.height == 0 {
+		return browsePageSize
+	}
+	lines := m.height - 3
+	if len(list.header) > 0 {
+		lines -= len(list.header) + 1
+	}
+	return max(1, lines)
+}
+
+func (m *browseModel) View() string {
+	list := m.lists[len(m.lists)-1]
+	var b strings.Builder
+	b.WriteString(browseTitleStyle.Render(m.truncate(list.title)))
+	b.WriteString("\n\n")
+	for _, line := range list.header {
+		b.WriteString(m.truncate(line))
+		b.WriteByte('\n')
+	}
+	if len(list.header) > 0 {
+		b.WriteByte('\n')
+	}
+	end := min(list.offset+m.pageSize(list), len(list.items))
+	for i := list.offset; i < end; i++ {
+		label := m.truncate("  " + list.items[i].label)
+		if i == list.cursor {
+			label = browseSelectedStyle.Render(label)
+		}
+		b.WriteString(label)
+		b.WriteByte('\n')
+	}
+	position := "empty"
+	if len(list.items) > 0 {
+		position = fmt.Sprintf("%d/%d", list.cursor+1, len(list.items))
+	}
+	b.WriteString(browseHelpStyle.Render(m.truncate(fmt.Sprintf("%s  ↑/↓ move  enter open  esc back  q quit", position))))
+	return b.String()
+}
+
+// truncate cuts line to the width of the terminal, once known.
+func (m *browseModel) truncate(line string) string {
+	if m.width == 0 {
+		return line
+	}
+	return ansi.Truncate(line, m.width, "…")
+}
+
+func (b *browser) repositories() (*browseList, error) {
+	rows, err := b.db.Query(`
+		SELECT r.id, r.name, COUNT(c.hash)
+		FROM repositories r
+		LEFT JOIN commits c ON c.repository_id = r.id
+		GROUP BY r.id
+		ORDER BY r.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	var items []browseItem
+	for rows.Next() {
+		var id, commits int
+		var name string
+		if err := rows.Scan(&id, &name, &commits); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		items = append(items, browseItem{
+			fmt.Sprintf("%s (%d commits)", name, commits),
+			func() (*browseList, error) { return b.commits("Repository "+name, "c.repository_id = ?", id) },
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return &browseList{title: "Repositories", items: items}, nil
+}
+
+func (b *browser) authors() (*browseList, error) {
+	rows, err := b.db.Query(`
+		SELECT author, email, COUNT(*)
+		FROM commits
+		GROUP BY email
+		ORDER BY COUNT(*) DESC, email
+	`)
+	if err != nil {
+		return nil, err
+	}
+	var items []browseItem
+	for rows.Next() {
+		var author, email string
+		var commits int
+		if err := rows.Scan(&author, &email, &commits); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		items = append(items, browseItem{
+			fmt.Sprintf("%s <%s> (%d commits)", author, email, commits),
+			func() (*browseList, error) { return b.author(email) },
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return &browseList{title: "Authors", items: items}, nil
+}
+
+func (b *browser) author(email string) (*browseList, error) {
+	return b.commits("Author "+email, "c.email = ?", email)
+}
+
+func (b *browser) commits(title, where string, arg any) (*browseList, error) {
+	rows, err := b.db.Query(`
+		SELECT c.hash, c.author, c.report_date, c.message
+		FROM commits c
+		WHERE `+where+`
+		ORDER BY c.report_date DESC
+	`, arg)
+	if err != nil {
+		return nil, err
+	}
+	var items []browseItem
+	for rows.Next() {
+		var hash, author, message string
+		var date time.Time
+		if err := rows.Scan(&hash, &author, &date, &message); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		items = append(items, browseItem{
+			fmt.Sprintf("%s %s %s: %s", hash[:min(10, len(hash))], formatDate(date), author, message),
+			func() (*browseList, error) { return b.commit(hash) },
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return &browseList{title: title, items: items}, nil
+}
+
+func (b *browser) commit(hash string) (*browseList, error) {
+	var repo, author, email, message string
+	var date time.Time
+	err := b.db.QueryRow(`
+		SELECT r.name, c.author, c.email, c.date, c.message
+		FROM commits c
+		JOIN repositories r ON r.id = c.repository_id
+		WHERE c.hash = ?
+	`, hash).Scan(&repo, &author, &email, &date, &message)
+	if err != nil {
+		return nil, err
+	}
+
+	header := []string{
+		"Repository: " + repo,
+		fmt.Sprintf("Author:     %s <%s>", author, email),
+		"Date:       " + date.Format(time.RFC1123Z),
+		"",
+	}
+	for line := range strings.Lines(message) {
+		header = append(header, "    "+strings.TrimRight(line, "\r\n"))
+	}
+
+	rows, err := b.db.Query(`
+		SELECT filepath, additions, deletions, change_type
+		FROM file_changes
+		WHERE commit_hash = ?
+		ORDER BY filepath
+	`, hash)
+	if err != nil {
+		return nil, err
+	}
+	var items []browseItem
+	for rows.Next() {
+		var path, changeType string
+		var additions, deletions sql.NullInt64
+		if err := rows.Scan(&path, &additions, &deletions, &changeType); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		label := fmt.Sprintf("%s %s +%d -%d", changeType, path, additions.Int64, deletions.Int64)
+		if !additions.Valid {
+			label = fmt.Sprintf("%s %s (binary)", changeType, path)
+		}
+		items = append(items, browseItem{label: label})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return &browseList{title: "Commit " + hash, header: header, items: items}, nil
+}
+
+func (b *browser) components() (*browseList, error) {
+	rows, err := b.db.Query(`
+		SELECT c.id, c.name, COALESCE(SUM(cc.commit_count), 0)
+		FROM components c
+		LEFT JOIN component_contributions cc ON cc.component_id = c.id
+		GROUP BY c.id
+		ORDER BY c.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	var items []browseItem
+	for rows.Next() {
+		var id, commits int
+		var name string
+		if err := rows.Scan(&id, &name, &commits); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		items = append(items, browseItem{
+			fmt.Sprintf("%s (%d commits)", name, commits),
+			func() (*browseList, error) { return b.component(id, name) },
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return &browseList{title: "Components", items: items}, nil
+}
+
+func (b *browser) component(id int, name string) (*browseList, error) {
+	rows, err := b.db.Query(`
+		SELECT cc.author, cc.email, SUM(cc.commit_count), SUM(cc.total_additions), SUM(cc.total_deletions)
+		FROM component_contributions cc
+		WHERE cc.component_id = ?
+		GROUP BY cc.email
+		ORDER BY SUM(cc.commit_count) DESC, cc.email
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	var items []browseItem
+	for rows.Next() {
+		var author, email string
+		var commits, additions, deletions int
+		if err := rows.Scan(&author, &email, &commits, &additions, &deletions); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		items = append(items, browseItem{
+			fmt.Sprintf("%s <%s> %d commits +%d -%d", author, email, commits, additions, deletions),
+			func() (*browseList, error) { return b.author(email) },
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return &browseList{title: "Component " + name, items: items}, nil
+}
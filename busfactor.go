@@ -0,0 +1,164 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"slices"
+	"text/tabwriter"
+)
+
+// defaultBusFactorThreshold is the percentage of the work of a component
+// the authors counted in its bus factor cover, unless set by bus_factor.
+const defaultBusFactorThreshold = 50
+
+// busFactor returns the least number of authors, each having done shares
+// of the work, together covering threshold percent of it; 0 without any.
+func busFactor(shares []int, threshold int) int {
+	total := 0
+	for _, share := range shares {
+		total += share
+	}
+	if total == 0 {
+		return 0
+	}
+	shares = slices.Clone(shares)
+	slices.SortFunc(shares, func(a, b int) int { return b - a })
+	covered := 0
+	for i, share := range shares {
+		covered += share
+		if covered*100 >= total*threshold {
+			return i + 1
+		}
+	}
+	return len(shares)
+}
+
+// replaceBusFactors recomputes the bus factor of every component, by the
+// commits credited to its authors in component contributions and by the
+// lines they own in component ownership, the contributions of bots left
+// out. The authors of a component are counted once across repositories.
+func replaceBusFactors(db *sql.DB, threshold int) error {
+	if threshold == 0 {
+		threshold = defaultBusFactorThreshold
+	}
+	shares := func(table, column string) (map[int][]int, error) {
+		rows, err := db.Query(`
+			SELECT component_id, SUM(` + column + `)
+			FROM ` + table + `
+			WHERE NOT is_bot
+			GROUP BY component_id, email
+		`)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		byComponent := make(map[int][]int)
+		for rows.Next() {
+			var componentID, share int
+			if err := rows.Scan(&componentID, &share); err != nil {
+				return nil, err
+			}
+			byComponent[componentID] = append(byComponent[componentID], share)
+		}
+		return byComponent, rows.Err()
+	}
+	commits, err := shares("component_contributions", "commit_count")
+	if err != nil {
+		return err
+	}
+	lines, err := shares("component_ownership", "lines")
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM component_bus_factors"); err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO component_bus_factors (component_id, threshold) SELECT id, ? FROM components", threshold)
+	if err != nil {
+		return err
+	}
+	for componentID, shares := range commits {
+		_, err := tx.Exec("UPDATE component_bus_factors SET commit_authors = ? WHERE component_id = ?", busFactor(shares, threshold), componentID)
+		if err != nil {
+			return err
+		}
+	}
+	for componentID, shares := range lines {
+		_, err := tx.Exec("UPDATE component_bus_factors SET line_authors = ? WHERE component_id = ?", busFactor(shares, threshold), componentID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// BusFactorSummary is the bus factor of a component.
+type BusFactorSummary struct {
+	Component     string
+	Threshold     int
+	CommitAuthors int
+	LineAuthors   int
+}
+
+// loadBusFactors returns the bus factors of the components with
+// contributions, lowest first, none for databases written before they were
+// computed.
+func loadBusFactors(db *sql.DB) ([]BusFactorSummary, error) {
+	var found bool
+	err := db.QueryRow("SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'component_bus_factors'").Scan(&found)
+	if err != nil || !found {
+		return nil, err
+	}
+	rows, err := db.Query(`
+		SELECT c.name, b.threshold, b.commit_authors, b.line_authors
+		FROM component_bus_factors b
+		JOIN components c ON c.id = b.component_id
+		WHERE b.commit_authors > 0
+		ORDER BY b.commit_authors, b.line_authors, c.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var factors []BusFactorSummary
+	for rows.Next() {
+		var b BusFactorSummary
+		if err := rows.Scan(&b.Component, &b.Threshold, &b.CommitAuthors, &b.LineAuthors); err != nil {
+			return nil, err
+		}
+		factors = append(factors, b)
+	}
+	return factors, rows.Err()
+}
+
+// renderBusFactors lists the components with the lowest bus factors, those
+// most at risk of losing their maintainers.
+func renderBusFactors(w io.Writer, factors []BusFactorSummary) {
+	if len(factors) == 0 {
+		return
+	}
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "BUS FACTOR (%d%%)\tCOMMITS\tLINES\n", factors[0].Threshold)
+	for _, b := range factors[:min(summaryTop, len(factors))] {
+		lines := "-"
+		if b.LineAuthors > 0 {
+			lines = fmt.Sprint(b.LineAuthors)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", b.Component, b.CommitAuthors, lines)
+	}
+	tw.Flush()
+	if more := len(factors) - summaryTop; more > 0 {
+		fmt.Fprintf(w, "... and %d more\n", more)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Calendar aligns weekly and quarterly aggregations with the calendar of
+// the organization.
+type Calendar struct {
+	// WeekStart is the first day of the week, e.g. sunday; monday by
+	// default, as in ISO weeks.
+	WeekStart string `yaml:"week_start"`
+	// FiscalYearStart is the month, 1 to 12, fiscal years start in;
+	// January by default. Fiscal years are named after the calendar year
+	// they end in.
+	FiscalYearStart int `yaml:"fiscal_year_start"`
+}
+
+// weekday returns the first day of the week.
+func (c Calendar) weekday() (time.Weekday, error) {
+	if c.WeekStart == "" {
+		return time.Monday, nil
+	}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(c.WeekStart, day.String()) {
+			return day, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown week day %q", c.WeekStart)
+}
+
+// reportCalendar is the calendar a database was generated with, stored in
+// report_settings so outputs rendered later from the database use it too.
+type reportCalendar struct {
+	loc         *time.Location
+	weekStart   time.Weekday
+	fiscalStart time.Month
+}
+
+// saveCalendar records the reporting timezone and calendar in
+// report_settings.
+func saveCalendar(db *sql.DB, timezone string, calendar Calendar) error {
+	weekStart, err := calendar.weekday()
+	if err != nil {
+		return err
+	}
+	fiscalStart := max(calendar.FiscalYearStart, 1)
+	_, err = db.Exec(`
+		INSERT INTO report_settings (id, timezone, week_start, fiscal_year_start) VALUES (1, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			timezone = excluded.timezone,
+			week_start = excluded.week_start,
+			fiscal_year_start = excluded.fiscal_year_start
+	`, timezone, int(weekStart), fiscalStart)
+	return err
+}
+
+// loadCalendar returns the calendar recorded in report_settings, or UTC,
+// ISO weeks and calendar years for databases without one, e.g. those
+// written by older versions.
+func loadCalendar(db *sql.DB) (reportCalendar, error) {
+	cal := reportCalendar{loc: time.UTC, weekStart: time.Monday, fiscalStart: time.January}
+	var found bool
+	err := db.QueryRow("SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'report_settings'").Scan(&found)
+	if err != nil || !found {
+		return cal, err
+	}
+	var timezone string
+	var weekStart, fiscalStart int
+	err = db.QueryRow("SELECT timezone, week_start, fiscal_year_start FROM report_settings WHERE id = 1").
+		Scan(&timezone, &weekStart, &fiscalStart)
+	if err == sql.ErrNoRows {
+		return cal, nil
+	}
+	if err != nil {
+		return cal, err
+	}
+	if cal.loc, err = time.LoadLocation(timezone); err != nil {
+		return cal, err
+	}
+	cal.weekStart = time.Weekday(weekStart)
+	cal.fiscalStart = time.Month(fiscalStart)
+	return cal, nil
+}
+
+// startOfWeek returns the start of the week t falls in.
+func (c reportCalendar) startOfWeek(t time.Time) time.Time {
+	t = t.In(c.loc)
+	days := (int(t.Weekday()) - int(c.weekStart) + 7) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-days, 0, 0, 0, 0, c.loc)
+}
+
+// startOfQuarter returns the start of the fiscal quarter t falls in.
+func (c reportCalendar) startOfQuarter(t time.Time) time.Time {
+	t = t.In(c.loc)
+	months := (int(t.Month()) - int(c.fiscalStart) + 12) % 12
+	return time.Date(t.Year(), t.Month()-time.Month(months%3), 1, 0, 0, 0, 0, c.loc)
+}
@@ -0,0 +1,181 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+)
+
+type Changelog struct {
+	Output string `yaml:"output"`
+	// Ranges maps repository names to a git revision range (e.g. v1.2..v1.3).
+	Ranges map[string]string `yaml:"ranges"`
+}
+
+const changelogOther = "Other changes"
+
+type changelogEntry struct {
+	hash    string
+	author  string
+	message string
+}
+
+// writeChangelog produces release notes for the configured revision ranges,
+// grouped by component and author. Commits are taken from the already
+// ingested data, git is only used to resolve the range.
+func writeChangelog(db *sql.DB, config *Config) error {
+	f, err := os.Create(config.Changelog.Output)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	fmt.Fprintf(w, "# Changelog\n")
+
+	for _, repo := range config.Repositories {
+		revRange, ok := config.Changelog.Ranges[repo.Name]
+		if !ok {
+			continue
+		}
+		slog.Info("Writing changelog", "repo", repo.Name, "range", revRange)
+		hashes, err := revList(repo.Path, revRange)
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("%s: %v", repo.Name, err)
+		}
+		groups, err := changelogGroups(db, config.Components, repo.Name, hashes)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		renderChangelog(w, repo.Name, revRange, groups)
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func revList(dir, revRange string) ([]string, error) {
+	output, err := gitCommand(dir, "rev-list", revRange, "--").Output()
+	if err != nil {
+		return nil, fmt.Errorf("git rev-list %s failed: %v", revRange, err)
+	}
+	return strings.Fields(string(output)), nil
+}
+
+// changelogGroups returns the commits in hashes grouped by component name
+// and then by author. Commits touching several components are listed under
+// each of them; commits matching none go to changelogOther.
+func changelogGroups(db *sql.DB, components []Component, repoName string, hashes []string) (map[string]map[string][]changelogEntry, error) {
+	patterns := make(map[string][]string)
+	for _, comp := range components {
+		patterns[comp.Name] = splitComponentPatterns(comp.Paths)[repoName]
+	}
+
+	groups := make(map[string]map[string][]changelogEntry)
+	add := func(group string, entry changelogEntry) {
+		if groups[group] == nil {
+			groups[group] = make(map[string][]changelogEntry)
+		}
+		groups[group][entry.author] = append(groups[group][entry.author], entry)
+	}
+
+	for _, hash := range hashes {
+		var entry changelogEntry
+		err := db.QueryRow(`
+			SELECT c.hash, c.author, c.message
+			FROM commits c
+			JOIN repositories r ON r.id = c.repository_id
+			WHERE r.name = ? AND c.hash = ?
+		`, repoName, hash).Scan(&entry.hash, &entry.author, &entry.message)
+		if err == sql.ErrNoRows {
+			// Filtered out at ingest time.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		files, err := commitFiles(db, hash)
+		if err != nil {
+			return nil, err
+		}
+
+		matched := false
+		for _, comp := range components {
+			if slices.ContainsFunc(files, func(path string) bool {
+				return slices.ContainsFunc(patterns[comp.Name], func(pattern string) bool {
+					return matchPathFold(path, pattern, comp.CaseInsensitive)
+				})
+			}) {
+				add(comp.Name, entry)
+				matched = true
+			}
+		}
+		if !matched {
+			add(changelogOther, entry)
+		}
+	}
+	return groups, nil
+}
+
+func commitFiles(db *sql.DB, hash string) ([]string, error) {
+	rows, err := db.Query("SELECT filepath FROM file_changes WHERE commit_hash = ?", hash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var files []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		files = append(files, path)
+	}
+	return files, rows.Err()
+}
+
+func renderChangelog(w io.Writer, repoName, revRange string, groups map[string]map[string][]changelogEntry) {
+	fmt.Fprintf(w, "\n## %s (%s)\n", repoName, revRange)
+	if len(groups) == 0 {
+		fmt.Fprintf(w, "\nNo changes.\n")
+		return
+	}
+
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		if name != changelogOther {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	if _, ok := groups[changelogOther]; ok {
+		names = append(names, changelogOther)
+	}
+
+	for _, name := range names {
+		fmt.Fprintf(w, "\n### %s\n", name)
+		authors := make([]string, 0, len(groups[name]))
+		for author := range groups[name] {
+			authors = append(authors, author)
+		}
+		slices.Sort(authors)
+		for _, author := range authors {
+			fmt.Fprintf(w, "\n#### %s\n\n", author)
+			for _, entry := range groups[name][author] {
+				fmt.Fprintf(w, "- %s (%s)\n", entry.message, entry.hash[:min(10, len(entry.hash))])
+			}
+		}
+	}
+}
@@ -0,0 +1,325 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ActivityPoint holds the activity of a single month.
+type ActivityPoint struct {
+	Period    string
+	Commits   int
+	Additions int
+	Deletions int
+}
+
+const activityPeriod = "2006-01"
+
+type activityCounter struct {
+	points  map[string]*ActivityPoint
+	commits map[string]map[string]bool
+	first   time.Time
+	last    time.Time
+}
+
+func newActivityCounter() *activityCounter {
+	return &activityCounter{
+		points:  make(map[string]*ActivityPoint),
+		commits: make(map[string]map[string]bool),
+	}
+}
+
+func (a *activityCounter) add(hash string, date time.Time, additions, deletions int) {
+	period := date.Format(activityPeriod)
+	p, ok := a.points[period]
+	if !ok {
+		p = &ActivityPoint{Period: period}
+		a.points[period] = p
+		a.commits[period] = make(map[string]bool)
+	}
+	if !a.commits[period][hash] {
+		a.commits[period][hash] = true
+		p.Commits++
+	}
+	p.Additions += additions
+	p.Deletions += deletions
+	if a.first.IsZero() || date.Before(a.first) {
+		a.first = date
+	}
+	if date.After(a.last) {
+		a.last = date
+	}
+}
+
+// series returns one point per month between the first and last activity,
+// including the empty months.
+func (a *activityCounter) series() []ActivityPoint {
+	if len(a.points) == 0 {
+		return nil
+	}
+	var series []ActivityPoint
+	month := time.Date(a.first.Year(), a.first.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(a.last.Year(), a.last.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for !month.After(end) {
+		period := month.Format(activityPeriod)
+		if p, ok := a.points[period]; ok {
+			series = append(series, *p)
+		} else {
+			series = append(series, ActivityPoint{Period: period})
+		}
+		month = month.AddDate(0, 1, 0)
+	}
+	return series
+}
+
+// loadActivity computes the monthly activity per repository and per
+// component, matching file changes against the stored component patterns.
+func loadActivity(db *sql.DB, report *Report) error {
+	stored, err := loadComponentPatterns(db)
+	if err != nil {
+		return err
+	}
+	type componentPatterns struct {
+		index int
+		storedComponent
+	}
+	var components []componentPatterns
+	for _, comp := range stored {
+		for i := range report.Components {
+			if report.Components[i].Name == comp.name {
+				components = append(components, componentPatterns{i, comp})
+			}
+		}
+	}
+
+	repoCounters := make(map[string]*activityCounter)
+	componentCounters := make(map[int]*activityCounter)
+
+	rows, err := db.Query(`
+		SELECT r.name, c.hash, c.report_date, COALESCE(fc.filepath, ''),
+			COALESCE(fc.additions, 0), COALESCE(fc.deletions, 0)
+		FROM commits c
+		JOIN repositories r ON r.id = c.repository_id
+		LEFT JOIN file_changes fc ON fc.commit_hash = c.hash
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var repo, hash, path string
+		var date time.Time
+		var additions, deletions int
+		if err := rows.Scan(&repo, &hash, &date, &path, &additions, &deletions); err != nil {
+			return err
+		}
+
+		counter, ok := repoCounters[repo]
+		if !ok {
+			counter = newActivityCounter()
+			repoCounters[repo] = counter
+		}
+		counter.add(hash, date, additions, deletions)
+
+		if path == "" {
+			continue
+		}
+		for _, comp := range components {
+			if !comp.matches(repo, path) {
+				continue
+			}
+			counter, ok := componentCounters[comp.index]
+			if !ok {
+				counter = newActivityCounter()
+				componentCounters[comp.index] = counter
+			}
+			counter.add(hash, date, additions, deletions)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range report.Repositories {
+		if counter, ok := repoCounters[report.Repositories[i].Name]; ok {
+			report.Repositories[i].Activity = counter.series()
+		}
+	}
+	for i, counter := range componentCounters {
+		report.Components[i].Activity = counter.series()
+	}
+	return nil
+}
+
+type storedComponent struct {
+	name            string
+	patterns        map[string][]string
+	caseInsensitive bool
+}
+
+// matches reports whether path, of the repository repoName, matches a
+// pattern of the component.
+func (c storedComponent) matches(repoName, path string) bool {
+	return slices.ContainsFunc(c.patterns[repoName], func(pattern string) bool {
+		return matchPathFold(path, pattern, c.caseInsensitive)
+	})
+}
+
+// loadComponentPatterns reads the component definitions stored in a report
+// database, with their patterns grouped by repository.
+func loadComponentPatterns(db *sql.DB) ([]storedComponent, error) {
+	// Databases written before case_insensitive match case.
+	caseColumn := "0"
+	var found bool
+	err := db.QueryRow("SELECT COUNT(*) > 0 FROM pragma_table_info('components') WHERE name = 'case_insensitive'").Scan(&found)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		caseColumn = "case_insensitive"
+	}
+	rows, err := db.Query("SELECT name, path_patterns, " + caseColumn + " FROM components ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var components []storedComponent
+	for rows.Next() {
+		var name, encoded string
+		var caseInsensitive bool
+		if err := rows.Scan(&name, &encoded, &caseInsensitive); err != nil {
+			return nil, err
+		}
+		var paths []string
+		if err := json.Unmarshal([]byte(encoded), &paths); err != nil {
+			return nil, err
+		}
+		components = append(components, storedComponent{name, splitComponentPatterns(paths), caseInsensitive})
+	}
+	return components, rows.Err()
+}
+
+// splitComponentPatterns groups repo:path component patterns by repository.
+func splitComponentPatterns(paths []string) map[string][]string {
+	patterns := make(map[string][]string)
+	for _, pattern := range paths {
+		parts := strings.SplitN(pattern, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		patterns[parts[0]] = append(patterns[parts[0]], parts[1])
+	}
+	return patterns
+}
+
+const (
+	chartWidth  = 600
+	chartHeight = 160
+	chartLeft   = 50
+	chartBottom = 20
+	chartTop    = 10
+)
+
+// commitsChartSVG renders the commits per month as a bar chart.
+func commitsChartSVG(series []ActivityPoint) string {
+	if len(series) == 0 {
+		return ""
+	}
+	maxValue := 1
+	for _, p := range series {
+		maxValue = max(maxValue, p.Commits)
+	}
+
+	var b strings.Builder
+	plotHeight := float64(chartHeight - chartTop - chartBottom)
+	barWidth := float64(chartWidth-chartLeft) / float64(len(series))
+	chartOpen(&b, "Commits per month")
+	chartAxis(&b, fmt.Sprint(maxValue), "0", float64(chartTop), float64(chartHeight-chartBottom))
+	for i, p := range series {
+		h := plotHeight * float64(p.Commits) / float64(maxValue)
+		x := chartLeft + float64(i)*barWidth
+		fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="#4a78b5"><title>%s: %d commits</title></rect>`,
+			x+1, float64(chartHeight-chartBottom)-h, max(barWidth-2, 1), h, p.Period, p.Commits)
+	}
+	chartLabels(&b, series, barWidth)
+	b.WriteString("</svg>")
+	return b.String()
+}
+
+// linesChartSVG renders additions above and deletions below a middle axis.
+func linesChartSVG(series []ActivityPoint) string {
+	if len(series) == 0 {
+		return ""
+	}
+	maxValue := 1
+	for _, p := range series {
+		maxValue = max(maxValue, p.Additions, p.Deletions)
+	}
+
+	var b strings.Builder
+	half := float64(chartHeight-chartTop-chartBottom) / 2
+	middle := float64(chartTop) + half
+	barWidth := float64(chartWidth-chartLeft) / float64(len(series))
+	chartOpen(&b, "Lines added and deleted per month")
+	chartAxis(&b, fmt.Sprintf("+%d", maxValue), fmt.Sprintf("-%d", maxValue), float64(chartTop), float64(chartHeight-chartBottom))
+	fmt.Fprintf(&b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#999"/>`, chartLeft, middle, chartWidth, middle)
+	for i, p := range series {
+		x := chartLeft + float64(i)*barWidth
+		w := max(barWidth-2, 1)
+		add := half * float64(p.Additions) / float64(maxValue)
+		del := half * float64(p.Deletions) / float64(maxValue)
+		fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="#2a2"><title>%s: +%d</title></rect>`,
+			x+1, middle-add, w, add, p.Period, p.Additions)
+		fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="#c33"><title>%s: -%d</title></rect>`,
+			x+1, middle, w, del, p.Period, p.Deletions)
+	}
+	chartLabels(&b, series, barWidth)
+	b.WriteString("</svg>")
+	return b.String()
+}
+
+func chartOpen(b *strings.Builder, title string) {
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="10">`,
+		chartWidth, chartHeight, chartWidth, chartHeight)
+	fmt.Fprintf(b, `<title>%s</title>`, title)
+}
+
+func chartAxis(b *strings.Builder, top, bottom string, y1, y2 float64) {
+	fmt.Fprintf(b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#999"/>`, chartLeft, y1, chartLeft, y2)
+	fmt.Fprintf(b, `<text x="%d" y="%.1f" text-anchor="end">%s</text>`, chartLeft-4, y1+8, top)
+	fmt.Fprintf(b, `<text x="%d" y="%.1f" text-anchor="end">%s</text>`, chartLeft-4, y2, bottom)
+}
+
+// chartLabels writes period labels under the bars, skipping some when there
+// are too many to fit.
+func chartLabels(b *strings.Builder, series []ActivityPoint, barWidth float64) {
+	step := max(1, int(45/barWidth)+1)
+	for i := 0; i < len(series); i += step {
+		x := chartLeft + float64(i)*barWidth + barWidth/2
+		fmt.Fprintf(b, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`, x, chartHeight-5, series[i].Period)
+	}
+}
+
+func commitsChartHTML(series []ActivityPoint) template.HTML {
+	return template.HTML(commitsChartSVG(series))
+}
+
+func linesChartHTML(series []ActivityPoint) template.HTML {
+	return template.HTML(linesChartSVG(series))
+}
+
+// svgDataURI encodes an SVG document for use as a Markdown image.
+func svgDataURI(svg string) string {
+	return "data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString([]byte(svg))
+}
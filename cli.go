@@ -0,0 +1,146 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string)
+}
+
+var commands = []command{
+	{"init", "write a starter configuration for the repositories in a directory", initCommand},
+	{"generate", "ingest repositories and write the configured outputs", generateCommand},
+	{"validate", "check a configuration file", validateCommand},
+	{"query", "run SQL against an existing report database", queryCommand},
+	{"top-authors", "print the top authors of an existing report database", topAuthorsCommand},
+	{"summary", "print totals of an existing report database", summaryCommand},
+	{"diff", "compare the activity of two report databases", diffCommand},
+	{"merge", "combine several report databases into one", mergeCommand},
+	{"export", "render an output format from an existing report database", exportCommand},
+	{"browse", "interactively browse an existing report database", browseCommand},
+	{"serve", "serve a dashboard and APIs over an existing report database", serveCommand},
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags] [args]\n\nCommands:\n", os.Args[0])
+	width := 0
+	for _, cmd := range commands {
+		width = max(width, len(cmd.name))
+	}
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-*s  %s\n", width, cmd.name, cmd.usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for the flags of a command.\n", os.Args[0])
+}
+
+// isConfigFile reports whether arg looks like a configuration file given
+// without a subcommand.
+func isConfigFile(arg string) bool {
+	return slices.Contains([]string{".yaml", ".yml", ".json", ".toml"}, strings.ToLower(filepath.Ext(arg)))
+}
+
+func validateCommand(args []string) {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	profile := fs.String("profile", "", "also validate the configuration with a profile applied")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s validate [-profile name] [config.yaml...]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	configPaths := fs.Args()
+	if len(configPaths) == 0 {
+		configPaths = []string{"report.yaml"}
+	}
+
+	config, err := loadConfigs(configPaths)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if *profile != "" {
+		if err := config.applyProfile(*profile); err != nil {
+			log.Fatalf("Failed to apply profile: %v", err)
+		}
+	}
+	if err := validateConfig(config); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	fmt.Println("Configuration is valid")
+}
+
+func exportCommand(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "", "output format")
+	output := fs.String("o", "", "output path, - for stdout (default derived from the database path)")
+	logOpts := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s export -format <format> [-o path] <report.db>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	logOpts.setup()
+	if fs.NArg() != 1 || *format == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if _, ok := reportFormats[*format]; !ok {
+		log.Fatalf("Unknown output format: %s", *format)
+	}
+
+	out := Output{Path: *output, Format: *format}
+	if out.Path == "" {
+		out.Path = derivedOutputPath(fs.Arg(0), *format)
+	}
+	if out.Path == stdoutPath && reportFormats[*format].render == nil {
+		log.Fatalf("Output format cannot be written to stdout: %s", *format)
+	}
+
+	db, err := openReportDatabase(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if err := writeReport(db, out); err != nil {
+		log.Fatalf("Failed to write %s report: %v", out.Format, err)
+	}
+}
+
+func browseCommand(args []string) {
+	fs := flag.NewFlagSet("browse", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s browse <report.db>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err := browse(fs.Arg(0), os.Stdin, os.Stdout); err != nil {
+		log.Fatalf("Failed to browse %s: %v", fs.Arg(0), err)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// codeownersFiles are the locations of a CODEOWNERS file, in the order
+// GitHub looks for it.
+var codeownersFiles = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// codeownersRule is a line of a CODEOWNERS file: a pattern and the owners
+// of the files matching it, none to leave them unowned.
+type codeownersRule struct {
+	pattern string
+	owners  []string
+}
+
+// parseCodeowners returns the rules of a CODEOWNERS file, in order. GitLab
+// section headers are skipped.
+func parseCodeowners(data string) []codeownersRule {
+	var rules []codeownersRule
+	for line := range strings.Lines(data) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "[") || strings.HasPrefix(line, "^[") {
+			continue
+		}
+		fields := strings.Fields(line)
+		rule := codeownersRule{pattern: fields[0]}
+		for _, owner := range fields[1:] {
+			if strings.HasPrefix(owner, "#") {
+				break
+			}
+			rule.owners = append(rule.owners, owner)
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// codeownersGlob returns the component glob matching the files of a
+// CODEOWNERS pattern, which follows the gitignore rules: patterns with a
+// slash but at the end are relative to the repository root, the others
+// match at any depth, and a pattern naming a directory covers its files,
+// except when ending in /*, which only matches the files directly in it.
+func codeownersGlob(pattern string) string {
+	anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	glob := strings.TrimSuffix(strings.TrimPrefix(pattern, "/"), "/")
+	if !anchored && !strings.HasPrefix(glob, "**") {
+		glob = "**/" + glob
+	}
+	if strings.HasSuffix(glob, "/*") || strings.HasSuffix(glob, "/**") {
+		return glob
+	}
+	return glob + "/**"
+}
+
+// readCodeowners returns the CODEOWNERS file of a repository at revision,
+// empty without one.
+func readCodeowners(repo Repository, revision string) string {
+	for _, path := range codeownersFiles {
+		if output, err := gitCommand(repo.Path, "show", revision+":"+path).Output(); err == nil {
+			return string(output)
+		}
+	}
+	return ""
+}
+
+// addCodeownersComponents adds a component per owner found in the
+// CODEOWNERS files of the repositories, see codeownersComponents.
+// Configured components named like an owner are kept as they are.
+func (c *Config) addCodeownersComponents() {
+	configured := make(map[string]bool)
+	for _, comp := range c.Components {
+		configured[comp.Name] = true
+	}
+	var generated []Component
+	for _, repo := range c.Repositories {
+		rules := parseCodeowners(readCodeowners(repo, c.Filters.revision()))
+		generated = codeownersComponents(generated, repo.Name, rules, configured)
+	}
+	for _, comp := range generated {
+		slog.Debug("Adding CODEOWNERS component", "component", comp.Name, "patterns", comp.Paths)
+	}
+	c.Components = append(c.Components, generated...)
+}
+
+// codeownersComponents adds to generated the patterns of the owners of the
+// CODEOWNERS rules of repository repoName, but those configured, creating
+// their components as needed. As the last rule matching a file gives its
+// owners, the patterns of the rules following any rule of an owner that do
+// not list it are excluded from its component, so a file is only credited
+// to the owners of its last rule. The files of a rule of an owner within
+// such a pattern, e.g. docs/api/ owned again after docs/, are excluded too.
+func codeownersComponents(generated []Component, repoName string, rules []codeownersRule, configured map[string]bool) []Component {
+	for i, rule := range rules {
+		for _, owner := range rule.owners {
+			if configured[owner] {
+				continue
+			}
+			j := slices.IndexFunc(generated, func(comp Component) bool { return comp.Name == owner })
+			if j < 0 {
+				generated = append(generated, Component{Name: owner})
+				j = len(generated) - 1
+			}
+			comp := &generated[j]
+			if path := repoName + ":" + codeownersGlob(rule.pattern); !slices.Contains(comp.Paths, path) {
+				comp.Paths = append(comp.Paths, path)
+			}
+			for _, later := range rules[i+1:] {
+				if slices.Contains(later.owners, owner) {
+					continue
+				}
+				if path := repoName + ":" + codeownersGlob(later.pattern); !slices.Contains(comp.Filters.ExcludePaths, path) {
+					comp.Filters.ExcludePaths = append(comp.Filters.ExcludePaths, path)
+				}
+			}
+		}
+	}
+	return generated
+}
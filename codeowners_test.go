@@ -0,0 +1,112 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// codeownersCredited returns the components credited with a change to path
+// of repository r: those with a pattern matching it and no exclusion.
+func codeownersCredited(components []Component, path string) []string {
+	matches := func(patterns []string) bool {
+		return slices.ContainsFunc(patterns, func(pattern string) bool {
+			repo, glob := splitRepoPattern(pattern)
+			return repo == "r" && matchPath(path, glob)
+		})
+	}
+	var credited []string
+	for _, comp := range components {
+		if matches(comp.Paths) && !matches(comp.Filters.ExcludePaths) {
+			credited = append(credited, comp.Name)
+		}
+	}
+	return credited
+}
+
+func TestCodeownersComponents(t *testing.T) {
+	tests := []struct {
+		name       string
+		codeowners string
+		configured []string
+		credited   map[string][]string
+	}{
+		{
+			name:       "last rule wins",
+			codeowners: "* @a\n/docs/ @b\n",
+			credited: map[string][]string{
+				"main.go":        {"@a"},
+				"docs/README.md": {"@b"},
+			},
+		},
+		{
+			name:       "interleaved owners",
+			codeowners: "* @a\ndocs/ @b\nsrc/ @a\n",
+			credited: map[string][]string{
+				"main.go":         {"@a"},
+				"docs/README.md":  {"@b"},
+				"src/main.go":     {"@a"},
+				"a/docs/guide.md": {"@b"},
+			},
+		},
+		{
+			name:       "several owners",
+			codeowners: "* @a\n/api/ @a @b\n/api/gen/ @c\n",
+			credited: map[string][]string{
+				"main.go":        {"@a"},
+				"api/handler.go": {"@a", "@b"},
+				"api/gen/x.go":   {"@c"},
+			},
+		},
+		{
+			name:       "unowned files",
+			codeowners: "* @a\n/vendor/\n",
+			credited: map[string][]string{
+				"main.go":       {"@a"},
+				"vendor/lib.go": nil,
+			},
+		},
+		{
+			name:       "configured owners are kept",
+			codeowners: "* @a\n/docs/ @b\n",
+			configured: []string{"@b"},
+			credited: map[string][]string{
+				"main.go":        {"@a"},
+				"docs/README.md": nil,
+			},
+		},
+	}
+	for _, tt := range tests {
+		configured := make(map[string]bool)
+		for _, name := range tt.configured {
+			configured[name] = true
+		}
+		components := codeownersComponents(nil, "r", parseCodeowners(tt.codeowners), configured)
+		for path, want := range tt.credited {
+			if got := codeownersCredited(components, path); !slices.Equal(got, want) {
+				t.Errorf("%s: %s credited to %q, want %q", tt.name, path, got, want)
+			}
+		}
+	}
+}
+
+func TestCodeownersGlob(t *testing.T) {
+	tests := []struct {
+		pattern, want string
+	}{
+		{"*", "**/*"},
+		{"*.go", "**/*.go/**"},
+		{"docs/", "**/docs/**"},
+		{"/docs/", "docs/**"},
+		{"src/api", "src/api/**"},
+		{"docs/*", "docs/*"},
+		{"**/logs", "**/logs/**"},
+	}
+	for _, tt := range tests {
+		if got := codeownersGlob(tt.pattern); got != tt.want {
+			t.Errorf("codeownersGlob(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+)
+
+// replaceCompanyContributions rolls up the component contributions of
+// people, bots left out, into company_contributions by the company of their
+// email domain: that of the longest matching domain of companies, a map of
+// domains, subdomains included, to company names, or the domain itself.
+// The companies are recorded in report_settings. It only reads
+// component_contributions, so it is done on every run.
+func replaceCompanyContributions(db *sql.DB, companies map[string]string) error {
+	lower := make(map[string]string, len(companies))
+	for domain, company := range companies {
+		lower[strings.ToLower(strings.TrimPrefix(domain, "@"))] = company
+	}
+	encoded, err := json.Marshal(lower)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM company_contributions"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE report_settings SET companies = ? WHERE id = 1", string(encoded)); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO company_contributions (company, component_id, contributor_count,
+			commit_count, total_additions, total_deletions)
+		SELECT COALESCE((
+				SELECT m.value FROM json_each(?) m
+				WHERE d.domain = m.key OR d.domain LIKE '%.' || m.key
+				ORDER BY length(m.key) DESC LIMIT 1
+			), d.domain) AS company,
+			d.component_id, COUNT(DISTINCT lower(d.email)),
+			SUM(d.commit_count), SUM(d.total_additions), SUM(d.total_deletions)
+		FROM (
+			SELECT *, lower(substr(email, instr(email, '@') + 1)) AS domain
+			FROM component_contributions
+			WHERE NOT is_bot AND instr(email, '@') > 0
+		) d
+		GROUP BY company, d.component_id
+	`, string(encoded))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
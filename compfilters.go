@@ -0,0 +1,147 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ComponentFilters limit the commits credited to a component, on top of the
+// filters of the report, e.g. for a component only counting the activity
+// after its ownership was transferred.
+type ComponentFilters struct {
+	// Since and Until are dates, inclusive, in the reporting timezone
+	// unless they have an offset.
+	Since string `yaml:"since" json:"since,omitempty"`
+	Until string `yaml:"until" json:"until,omitempty"`
+	// Authors and ExcludeAuthors are regular expressions matched against
+	// "Name <email>" of the commit author; with Authors, only the commits
+	// of matching authors are credited.
+	Authors        []string `yaml:"authors" json:"authors,omitempty"`
+	ExcludeAuthors []string `yaml:"exclude_authors" json:"exclude_authors,omitempty"`
+	// ExcludePaths are patterns in [repo:]path form, like the paths of
+	// components, of the files not credited to the component.
+	ExcludePaths []string `yaml:"exclude_paths" json:"exclude_paths,omitempty"`
+}
+
+func (f *ComponentFilters) UnmarshalYAML(value *yaml.Node) error {
+	type plain ComponentFilters
+	if err := checkKnownFields(value, f); err != nil {
+		return err
+	}
+	return value.Decode((*plain)(f))
+}
+
+// encode returns the filters as stored in components.filters, empty
+// without any.
+func (f ComponentFilters) encode() (string, error) {
+	encoded, err := json.Marshal(f)
+	if err != nil || string(encoded) == "{}" {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// decodeComponentFilters parses the filters stored in components.filters.
+func decodeComponentFilters(encoded string) (ComponentFilters, error) {
+	var f ComponentFilters
+	if encoded == "" {
+		return f, nil
+	}
+	err := json.Unmarshal([]byte(encoded), &f)
+	return f, err
+}
+
+// componentFilter is the compiled form of ComponentFilters.
+type componentFilter struct {
+	since, until   time.Time
+	authors        []*regexp.Regexp
+	excludeAuthors []*regexp.Regexp
+	// excludePaths maps repository names to their patterns.
+	excludePaths map[string][]string
+	// fold matches excludePaths ignoring case, as the patterns of the
+	// component.
+	fold bool
+}
+
+// compile parses the dates of the filters in loc and compiles their
+// patterns.
+func (f ComponentFilters) compile(loc *time.Location) (*componentFilter, error) {
+	var err error
+	c := &componentFilter{excludePaths: splitComponentPatterns(f.ExcludePaths)}
+	if f.Since != "" {
+		if c.since, _, err = parseComponentDate(f.Since, loc); err != nil {
+			return nil, fmt.Errorf("invalid since date %q", f.Since)
+		}
+	}
+	if f.Until != "" {
+		until, dateOnly, err := parseComponentDate(f.Until, loc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid until date %q", f.Until)
+		}
+		// until is kept as the exclusive end of the range.
+		if dateOnly {
+			c.until = until.AddDate(0, 0, 1)
+		} else {
+			c.until = until.Add(time.Second)
+		}
+	}
+	for _, patterns := range []struct {
+		field string
+		src   []string
+		dst   *[]*regexp.Regexp
+	}{
+		{"authors", f.Authors, &c.authors},
+		{"exclude_authors", f.ExcludeAuthors, &c.excludeAuthors},
+	} {
+		for _, pattern := range patterns.src {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s pattern %q: %v", patterns.field, pattern, err)
+			}
+			*patterns.dst = append(*patterns.dst, re)
+		}
+	}
+	return c, nil
+}
+
+// parseComponentDate parses s in one of the layouts of validFilterDate,
+// reporting whether it has no time.
+func parseComponentDate(s string, loc *time.Location) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation(time.DateOnly, s, loc); err == nil {
+		return t, true, nil
+	}
+	if t, err := time.ParseInLocation(time.DateTime, s, loc); err == nil {
+		return t, false, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	return t, false, err
+}
+
+// commit reports whether a commit of author, dated date, is credited.
+func (c *componentFilter) commit(author, email string, date time.Time) bool {
+	if !c.since.IsZero() && date.Before(c.since) {
+		return false
+	}
+	if !c.until.IsZero() && !date.Before(c.until) {
+		return false
+	}
+	ident := author + " <" + email + ">"
+	matches := func(re *regexp.Regexp) bool { return re.MatchString(ident) }
+	if len(c.authors) > 0 && !slices.ContainsFunc(c.authors, matches) {
+		return false
+	}
+	return !slices.ContainsFunc(c.excludeAuthors, matches)
+}
+
+// path reports whether the changes to path in repoName are credited.
+func (c *componentFilter) path(repoName, path string) bool {
+	return !slices.ContainsFunc(c.excludePaths[repoName], func(pattern string) bool { return matchPathFold(path, pattern, c.fold) })
+}
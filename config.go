@@ -0,0 +1,632 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loadConfig reads the configuration file at path, or from stdin when path
+// is "-".
+func loadConfig(path string) (*Config, error) {
+	return loadConfigs([]string{path})
+}
+
+// loadConfigs reads and merges several configuration files, later files
+// taking precedence, see mergeConfig.
+func loadConfigs(paths []string) (*Config, error) {
+	var config Config
+	for _, path := range paths {
+		if err := includeConfigFile(&config, path, nil); err != nil {
+			if len(paths) > 1 {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+			return nil, err
+		}
+	}
+
+	var err error
+	config.Outputs, err = config.Outputs.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := config.expandRepositoryGlobs(); err != nil {
+		return nil, err
+	}
+	config.nameRemoteRepositories()
+	if err := config.discoverRepositories(config.Discover); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+// includeConfigFile merges the file at path into config, after the files it
+// includes so its own settings take precedence. Stack holds the files being
+// included, to detect cycles.
+func includeConfigFile(config *Config, path string, stack []string) error {
+	file, err := readConfigFile(path)
+	if err != nil {
+		return err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	stack = append(stack, abs)
+	for _, include := range file.Include {
+		if target, err := filepath.Abs(include); err == nil && slices.Contains(stack, target) {
+			return fmt.Errorf("include cycle: %s", include)
+		}
+		if err := includeConfigFile(config, include, stack); err != nil {
+			return fmt.Errorf("include %s: %v", include, err)
+		}
+	}
+	mergeConfig(config, file)
+	return nil
+}
+
+func readConfigFile(path string) (*Config, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		// JSON is valid YAML, but checking first gives JSON error messages.
+		var v any
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+	case ".toml":
+		table, err := parseTOML(string(data))
+		if err != nil {
+			return nil, err
+		}
+		if data, err = yaml.Marshal(table); err != nil {
+			return nil, err
+		}
+	}
+
+	// Unknown keys are rejected, so typos do not silently drop settings.
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	var config Config
+	if err := dec.Decode(&config); err != nil && err != io.EOF {
+		return nil, err
+	}
+	config.applyComponentsKey()
+	dir := ""
+	if path != "-" {
+		dir = filepath.Dir(path)
+	}
+	if err := config.resolvePaths(dir); err != nil {
+		return nil, err
+	}
+	if path == "-" {
+		path = "<stdin>"
+	}
+	config.setSource(path, !strings.EqualFold(filepath.Ext(path), ".toml"))
+	return &config, nil
+}
+
+// resolvePaths expands a leading ~ in the file paths of a configuration and
+// makes relative ones relative to dir, the directory of the configuration
+// file, so it works wherever the tool is run from. An empty dir (stdin)
+// leaves them relative to the working directory.
+func (c *Config) resolvePaths(dir string) error {
+	var err error
+	resolve := func(path *string) {
+		if err != nil || *path == "" || *path == stdoutPath {
+			return
+		}
+		*path, err = resolvePath(dir, *path)
+	}
+
+	for i := range c.Outputs {
+		resolve(&c.Outputs[i].Path)
+	}
+	for i := range c.Repositories {
+		if !isRemoteURL(c.Repositories[i].Path) {
+			resolve(&c.Repositories[i].Path)
+		}
+	}
+	for i := range c.Discover {
+		resolve(&c.Discover[i])
+	}
+	for i := range c.Include {
+		resolve(&c.Include[i])
+	}
+	for i := range c.Templates {
+		resolve(&c.Templates[i].Path)
+		resolve(&c.Templates[i].Output)
+	}
+	resolve(&c.Changelog.Output)
+	resolve(&c.CacheDir)
+	resolve(&c.IgnoreRevsFile)
+	for _, profile := range c.Profiles {
+		for i := range profile.Outputs {
+			resolve(&profile.Outputs[i].Path)
+		}
+	}
+	return err
+}
+
+// resolvePath expands a leading ~ to the home directory and joins relative
+// paths to dir.
+func resolvePath(dir, path string) (string, error) {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(home, path[1:])
+	}
+	if filepath.IsAbs(path) || dir == "" {
+		return path, nil
+	}
+	return filepath.Join(dir, path), nil
+}
+
+// checkKnownFields rejects mapping keys not matching a yaml field of the
+// struct pointed to by v. Custom unmarshalers need it because decoding a
+// yaml.Node does not apply the decoder KnownFields setting.
+func checkKnownFields(node *yaml.Node, v any) error {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	t := reflect.TypeOf(v).Elem()
+	known := make(map[string]bool)
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		known[name] = true
+	}
+	for i := 0; i < len(node.Content); i += 2 {
+		key := node.Content[i]
+		if !known[key.Value] {
+			return fmt.Errorf("yaml: line %d: field %s not found in type %s", key.Line, key.Value, t)
+		}
+	}
+	return nil
+}
+
+// mergeConfig merges src into dst. Repositories, templates and discover
+// directories are appended, components with the same name get their paths
+// combined, their filters and parent replaced and follow and
+// case_insensitive enabled, and every other setting given in src overrides
+// dst.
+func mergeConfig(dst, src *Config) {
+	if len(src.Outputs) > 0 {
+		dst.Outputs = src.Outputs
+	}
+	dst.Repositories = append(dst.Repositories, src.Repositories...)
+	dst.Discover = append(dst.Discover, src.Discover...)
+	dst.Templates = append(dst.Templates, src.Templates...)
+
+	mergeFilters(&dst.Filters, src.Filters)
+
+	for _, comp := range src.Components {
+		i := slices.IndexFunc(dst.Components, func(c Component) bool { return c.Name == comp.Name })
+		if i < 0 {
+			dst.Components = append(dst.Components, comp)
+			continue
+		}
+		for _, path := range comp.Paths {
+			if !slices.Contains(dst.Components[i].Paths, path) {
+				dst.Components[i].Paths = append(dst.Components[i].Paths, path)
+			}
+		}
+		if !reflect.ValueOf(comp.Filters).IsZero() {
+			dst.Components[i].Filters = comp.Filters
+		}
+		if comp.Follow {
+			dst.Components[i].Follow = true
+		}
+		if comp.CaseInsensitive {
+			dst.Components[i].CaseInsensitive = true
+		}
+		if comp.Parent != "" {
+			dst.Components[i].Parent = comp.Parent
+		}
+		if comp.Weight != 0 {
+			dst.Components[i].Weight = comp.Weight
+		}
+		dst.Components[i].Weights = append(dst.Components[i].Weights, comp.Weights...)
+	}
+
+	for _, team := range src.Teams {
+		i := slices.IndexFunc(dst.Teams, func(t Team) bool { return t.Name == team.Name })
+		if i < 0 {
+			dst.Teams = append(dst.Teams, team)
+			continue
+		}
+		for _, member := range team.Members {
+			if !slices.Contains(dst.Teams[i].Members, member) {
+				dst.Teams[i].Members = append(dst.Teams[i].Members, member)
+			}
+		}
+	}
+
+	if src.CacheDir != "" {
+		dst.CacheDir = src.CacheDir
+	}
+	if src.Ingest.Signatures {
+		dst.Ingest.Signatures = true
+	}
+	dst.Identities = append(dst.Identities, src.Identities...)
+	if src.Linguist.Exclude {
+		dst.Linguist.Exclude = true
+	}
+	if src.CaseInsensitive {
+		dst.CaseInsensitive = true
+	}
+	if src.Overlaps != "" {
+		dst.Overlaps = src.Overlaps
+	}
+	if src.BusFactor != 0 {
+		dst.BusFactor = src.BusFactor
+	}
+	dst.Weights = append(dst.Weights, src.Weights...)
+	if src.AutoComponents.Codeowners {
+		dst.AutoComponents.Codeowners = true
+	}
+	if src.AutoComponents.Directories != 0 {
+		dst.AutoComponents.Directories = src.AutoComponents.Directories
+	}
+	if src.AutoComponents.ByLanguage {
+		dst.AutoComponents.ByLanguage = true
+	}
+	if src.IgnoreRevsFile != "" {
+		dst.IgnoreRevsFile = src.IgnoreRevsFile
+	}
+	if src.Outliers.Lines != 0 {
+		dst.Outliers.Lines = src.Outliers.Lines
+	}
+	if src.Outliers.Exclude {
+		dst.Outliers.Exclude = true
+	}
+	if src.Timezone != "" {
+		dst.Timezone = src.Timezone
+	}
+	if src.Calendar.WeekStart != "" {
+		dst.Calendar.WeekStart = src.Calendar.WeekStart
+	}
+	if src.Calendar.FiscalYearStart != 0 {
+		dst.Calendar.FiscalYearStart = src.Calendar.FiscalYearStart
+	}
+	for domain, company := range src.Companies {
+		if dst.Companies == nil {
+			dst.Companies = make(map[string]string)
+		}
+		dst.Companies[domain] = company
+	}
+	if len(src.Organization.Domains) > 0 {
+		dst.Organization.Domains = src.Organization.Domains
+	}
+	if len(src.Bots.Patterns) > 0 {
+		dst.Bots.Patterns = src.Bots.Patterns
+	}
+	if src.Bots.Exclude {
+		dst.Bots.Exclude = true
+	}
+	if src.Ingest.PatchIDs {
+		dst.Ingest.PatchIDs = true
+	}
+	if src.Ingest.Blame {
+		dst.Ingest.Blame = true
+	}
+	if src.Ingest.RenameThreshold != 0 {
+		dst.Ingest.RenameThreshold = src.Ingest.RenameThreshold
+	}
+
+	if src.Changelog.Output != "" {
+		dst.Changelog.Output = src.Changelog.Output
+	}
+	if len(src.Changelog.Ranges) > 0 {
+		if dst.Changelog.Ranges == nil {
+			dst.Changelog.Ranges = make(map[string]string)
+		}
+		maps.Copy(dst.Changelog.Ranges, src.Changelog.Ranges)
+	}
+
+	if src.Email.enabled() {
+		dst.Email = src.Email
+	}
+	if src.Webhook.URL != "" {
+		dst.Webhook = src.Webhook
+	}
+
+	if len(src.Profiles) > 0 {
+		if dst.Profiles == nil {
+			dst.Profiles = make(map[string]Profile)
+		}
+		maps.Copy(dst.Profiles, src.Profiles)
+	}
+}
+
+// mergeFilters overrides the filters in dst with those set in src.
+func mergeFilters(dst *Filters, src Filters) {
+	if src.Since != "" {
+		dst.Since = src.Since
+		dst.loc.copyField(src.loc, "since")
+	}
+	if src.Until != "" {
+		dst.Until = src.Until
+		dst.loc.copyField(src.loc, "until")
+	}
+	if len(src.Authors) > 0 {
+		dst.Authors = src.Authors
+	}
+	if src.Branch != "" {
+		dst.Branch = src.Branch
+	}
+	if src.FirstParent {
+		dst.FirstParent = true
+	}
+	if src.NoMerges {
+		dst.NoMerges = true
+	}
+	if src.IgnoreWhitespace {
+		dst.IgnoreWhitespace = true
+	}
+	if src.Merges != "" {
+		dst.Merges = src.Merges
+		dst.loc.copyField(src.loc, "merges")
+	}
+	if len(src.Paths) > 0 {
+		dst.Paths = src.Paths
+	}
+	if len(src.ExcludePaths) > 0 {
+		dst.ExcludePaths = src.ExcludePaths
+	}
+	if src.ExcludeDefaults {
+		dst.ExcludeDefaults = true
+	}
+	if len(src.ExcludeAuthors) > 0 {
+		dst.ExcludeAuthors = src.ExcludeAuthors
+	}
+	if src.MaxCommits != 0 {
+		dst.MaxCommits = src.MaxCommits
+		dst.loc.copyField(src.loc, "max_commits")
+	}
+	if src.Expr != "" {
+		dst.Expr = src.Expr
+		dst.loc.copyField(src.loc, "expr")
+	}
+}
+
+// applyProfile overrides the configuration with the named profile. Outputs
+// and components given in the profile replace the configured ones, filters
+// are overridden one by one.
+func (c *Config) applyProfile(name string) error {
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return fmt.Errorf("unknown profile: %s", name)
+	}
+	if len(profile.Outputs) > 0 {
+		outputs, err := profile.Outputs.normalize()
+		if err != nil {
+			return fmt.Errorf("profile %s: %v", name, err)
+		}
+		c.Outputs = outputs
+	}
+	mergeFilters(&c.Filters, profile.Filters)
+	if len(profile.Components) > 0 {
+		c.Components = profile.Components
+	}
+	return nil
+}
+
+// located records where the fields of a configuration entry are defined, to
+// point validation errors at them.
+type located struct {
+	// fields maps field names, "name.index" for sequence items and "" for
+	// the entry itself to their location.
+	fields map[string]*location
+}
+
+type location struct {
+	file   string
+	line   int
+	column int
+}
+
+func (l *located) record(node *yaml.Node) {
+	l.fields = map[string]*location{"": {line: node.Line, column: node.Column}}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i].Value, node.Content[i+1]
+		l.fields[key] = &location{line: value.Line, column: value.Column}
+		for j, item := range value.Content {
+			if value.Kind == yaml.SequenceNode {
+				l.fields[fmt.Sprintf("%s.%d", key, j)] = &location{line: item.Line, column: item.Column}
+			}
+		}
+	}
+}
+
+// setFile sets the file of locations recorded while decoding it. Without
+// lines (for formats converted to YAML first) only the file is reported.
+func (l located) setFile(file string, lines bool) {
+	for _, loc := range l.fields {
+		if loc.file == "" {
+			loc.file = file
+			if !lines {
+				loc.line = 0
+			}
+		}
+	}
+}
+
+// copyField takes the location of field from src, when set there.
+func (l *located) copyField(src located, field string) {
+	if loc, ok := src.fields[field]; ok {
+		if l.fields == nil {
+			l.fields = make(map[string]*location)
+		}
+		l.fields[field] = loc
+	}
+}
+
+// at formats the location of field, or of the entry when unknown.
+func (l located) at(field string) string {
+	loc, ok := l.fields[field]
+	if !ok {
+		loc, ok = l.fields[""]
+	}
+	switch {
+	case !ok:
+		return ""
+	case loc.line == 0:
+		return loc.file
+	default:
+		return fmt.Sprintf("%s:%d:%d", loc.file, loc.line, loc.column)
+	}
+}
+
+func (r *Repository) UnmarshalYAML(value *yaml.Node) error {
+	type plain Repository
+	if err := checkKnownFields(value, r); err != nil {
+		return err
+	}
+	if err := value.Decode((*plain)(r)); err != nil {
+		return err
+	}
+	r.loc.record(value)
+	return nil
+}
+
+func (f *Filters) UnmarshalYAML(value *yaml.Node) error {
+	type plain Filters
+	if err := checkKnownFields(value, f); err != nil {
+		return err
+	}
+	if err := value.Decode((*plain)(f)); err != nil {
+		return err
+	}
+	f.loc.record(value)
+	return nil
+}
+
+func (c *Component) UnmarshalYAML(value *yaml.Node) error {
+	type plain Component
+	if err := checkKnownFields(value, c); err != nil {
+		return err
+	}
+	if err := value.Decode((*plain)(c)); err != nil {
+		return err
+	}
+	c.loc.record(value)
+	return nil
+}
+
+// ComponentsKey is the components key of a configuration file: either the
+// list of components or a mapping of it, under list, and of settings of the
+// generated components, e.g.
+//
+//	components:
+//	  by_language: true
+//	  list:
+//	    - name: api
+//	      paths: [api/**]
+type ComponentsKey struct {
+	List []Component `yaml:"list"`
+	// Auto, top-level-dirs, sets auto_components.directories to Depth, 1
+	// unless set.
+	Auto  string `yaml:"auto"`
+	Depth int    `yaml:"depth"`
+	// ByLanguage sets auto_components.by_language.
+	ByLanguage bool `yaml:"by_language"`
+}
+
+// autoTopLevelDirs is the components.auto mode adding a component per
+// directory.
+const autoTopLevelDirs = "top-level-dirs"
+
+func (k *ComponentsKey) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.SequenceNode {
+		return value.Decode(&k.List)
+	}
+	type plain ComponentsKey
+	if err := checkKnownFields(value, k); err != nil {
+		return err
+	}
+	if err := value.Decode((*plain)(k)); err != nil {
+		return err
+	}
+	switch {
+	case k.Auto != "" && k.Auto != autoTopLevelDirs:
+		return fmt.Errorf("yaml: line %d: unknown components.auto %q, want %s", value.Line, k.Auto, autoTopLevelDirs)
+	case k.Depth < 0:
+		return fmt.Errorf("yaml: line %d: components.depth %d is negative", value.Line, k.Depth)
+	case k.Depth > 0 && k.Auto == "":
+		return fmt.Errorf("yaml: line %d: components.depth is set without components.auto", value.Line)
+	}
+	return nil
+}
+
+// applyComponentsKey sets the components, and the generated components
+// enabled, of the components key.
+func (c *Config) applyComponentsKey() {
+	c.Components = c.ComponentsKey.List
+	if c.ComponentsKey.Auto == autoTopLevelDirs {
+		c.AutoComponents.Directories = max(c.ComponentsKey.Depth, 1)
+	}
+	if c.ComponentsKey.ByLanguage {
+		c.AutoComponents.ByLanguage = true
+	}
+}
+
+// setSource sets the file of every location recorded while decoding it.
+func (c *Config) setSource(file string, lines bool) {
+	for _, repo := range c.Repositories {
+		repo.loc.setFile(file, lines)
+	}
+	for _, comp := range c.Components {
+		comp.loc.setFile(file, lines)
+	}
+	c.Filters.loc.setFile(file, lines)
+	for _, profile := range c.Profiles {
+		profile.Filters.loc.setFile(file, lines)
+		for _, comp := range profile.Components {
+			comp.loc.setFile(file, lines)
+		}
+	}
+}
+
+// validationErrors collects every problem found in a configuration.
+type validationErrors []string
+
+func (v *validationErrors) add(loc located, field string, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if at := loc.at(field); at != "" {
+		msg = at + ": " + msg
+	}
+	*v = append(*v, msg)
+}
+
+func (v validationErrors) Error() string {
+	if len(v) == 1 {
+		return v[0]
+	}
+	return fmt.Sprintf("%d problems:\n  %s", len(v), strings.Join(v, "\n  "))
+}
@@ -0,0 +1,83 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"regexp"
+	"strings"
+)
+
+// conventionalSubject matches Conventional Commits subjects, e.g.
+// "feat(api)!: drop v1 endpoints".
+var conventionalSubject = regexp.MustCompile(`^([A-Za-z]+)(?:\(([^()]*)\))?(!)?: \S`)
+
+// parseConventionalCommit returns the type, lowercased, and scope of a
+// Conventional Commits subject, and whether it marks a breaking change with
+// a ! before the colon. The type is empty for other subjects.
+func parseConventionalCommit(subject string) (typ, scope string, breaking bool) {
+	m := conventionalSubject.FindStringSubmatch(strings.TrimSpace(subject))
+	if m == nil {
+		return "", "", false
+	}
+	return strings.ToLower(m[1]), strings.TrimSpace(m[2]), m[3] != ""
+}
+
+// parseCommitTypes sets commit_type, commit_scope and is_breaking on the
+// commits not parsed yet, those with a NULL commit_type: the ones ingested
+// since the previous run or before the columns existed. Only subjects are
+// ingested, so the BREAKING-CHANGE footer is found among the trailers;
+// git does not take "BREAKING CHANGE", with a space, for one.
+func parseCommitTypes(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT c.hash, c.message, EXISTS (
+			SELECT 1 FROM commit_trailers t
+			WHERE t.commit_hash = c.hash AND upper(t.key) = 'BREAKING-CHANGE'
+		)
+		FROM commits c
+		WHERE c.commit_type IS NULL
+	`)
+	if err != nil {
+		return err
+	}
+	type parsed struct {
+		hash, typ, scope string
+		breaking         bool
+	}
+	var commits []parsed
+	for rows.Next() {
+		var p parsed
+		var subject string
+		var footer bool
+		if err := rows.Scan(&p.hash, &subject, &footer); err != nil {
+			rows.Close()
+			return err
+		}
+		p.typ, p.scope, p.breaking = parseConventionalCommit(subject)
+		p.breaking = p.breaking || (p.typ != "" && footer)
+		commits = append(commits, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare("UPDATE commits SET commit_type = ?, commit_scope = ?, is_breaking = ? WHERE hash = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, p := range commits {
+		if _, err := stmt.Exec(p.typ, p.scope, p.breaking, p.hash); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
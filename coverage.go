@@ -0,0 +1,264 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"text/tabwriter"
+)
+
+// uncategorizedComponent names the synthetic component credited with the
+// file changes matching no configured component.
+const uncategorizedComponent = "uncategorized"
+
+// withUncategorized returns components with the uncategorized one
+// appended, unless there are none.
+func withUncategorized(components []Component) []Component {
+	if len(components) == 0 {
+		return components
+	}
+	return append(components[:len(components):len(components)], Component{Name: uncategorizedComponent})
+}
+
+// categorizer tells the file changes matching a component apart from the
+// uncategorized ones.
+type categorizer struct {
+	components []Component
+	patterns   []map[string][]string
+	// excludes holds the exclude_paths of every component by repository.
+	excludes []map[string][]string
+	// followed holds, for every component, the names traced for its
+	// followed files, keyed by repository name, hash and name separated by
+	// NUL bytes.
+	followed []map[string]bool
+}
+
+// newCategorizer returns the categorizer of the file changes of the
+// repositories in repoIDs, the synthetic uncategorized component and the
+// language ones, which break down every file change, left out.
+func newCategorizer(db *sql.DB, components []Component, repoIDs map[string]int) (*categorizer, error) {
+	c := &categorizer{}
+	for _, comp := range components {
+		if comp.Name == uncategorizedComponent || comp.language {
+			continue
+		}
+		patterns := splitComponentPatterns(comp.Paths)
+		c.components = append(c.components, comp)
+		c.patterns = append(c.patterns, patterns)
+		c.excludes = append(c.excludes, splitComponentPatterns(comp.Filters.ExcludePaths))
+		traced := make(map[string]bool)
+		for repoName := range patterns {
+			repoID, ok := repoIDs[repoName]
+			if !ok {
+				continue
+			}
+			followed, err := loadFollowedPaths(db, comp, repoName, repoID)
+			if err != nil {
+				return nil, err
+			}
+			for key := range followed {
+				traced[repoName+"\x00"+key] = true
+			}
+		}
+		c.followed = append(c.followed, traced)
+	}
+	return c, nil
+}
+
+// matches reports whether the change to path in the commit hash of
+// repoName matches the component i, its exclude_paths left out.
+func (c *categorizer) matches(i int, repoName, hash, path string) bool {
+	fold := c.components[i].CaseInsensitive
+	if slices.ContainsFunc(c.excludes[i][repoName], func(pattern string) bool { return matchPathFold(path, pattern, fold) }) {
+		return false
+	}
+	if c.followed[i][repoName+"\x00"+hash+"\x00"+path] {
+		return true
+	}
+	return slices.ContainsFunc(c.patterns[i][repoName], func(pattern string) bool { return matchPathFold(path, pattern, fold) })
+}
+
+// categorized reports whether the change to path in the commit hash of
+// repoName matches a component.
+func (c *categorizer) categorized(repoName, hash, path string) bool {
+	for i := range c.components {
+		if c.matches(i, repoName, hash, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// matching returns the indexes of the components the change to path in the
+// commit hash of repoName matches.
+func (c *categorizer) matching(repoName, hash, path string) []int {
+	var matched []int
+	for i := range c.components {
+		if c.matches(i, repoName, hash, path) {
+			matched = append(matched, i)
+		}
+	}
+	return matched
+}
+
+// replaceCoverage recomputes, per repository, how many of the file changes
+// of its commits, duplicates and ignored ones left out, and of their lines,
+// match a component, so gaps in the component definitions are visible. The
+// paths matching several components are recorded too, and their number
+// returned.
+func replaceCoverage(db *sql.DB, components []Component, repoIDs map[string]int) (int, error) {
+	cat, err := newCategorizer(db, components, repoIDs)
+	if err != nil {
+		return 0, err
+	}
+	resolver := newOverlapResolver(cat, "")
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	for _, table := range []string{"component_coverage", "component_overlaps"} {
+		if _, err := tx.Exec("DELETE FROM " + table); err != nil {
+			return 0, err
+		}
+	}
+	if len(cat.components) == 0 {
+		return 0, tx.Commit()
+	}
+	overlapping := 0
+	for repoName, repoID := range repoIDs {
+		rows, err := tx.Query(`
+			SELECT c.hash, fc.filepath, COALESCE(fc.additions, 0) + COALESCE(fc.deletions, 0)
+			FROM commits c
+			JOIN file_changes fc ON c.hash = fc.commit_hash
+			WHERE c.repository_id = ? AND c.duplicate_of = '' AND NOT c.is_ignored
+		`, repoID)
+		if err != nil {
+			return 0, err
+		}
+		var changes, categorized, lines, categorizedLines int
+		type overlap struct {
+			components []string
+			changes    int
+		}
+		overlaps := make(map[string]*overlap)
+		for rows.Next() {
+			var hash, path string
+			var changed int
+			if err := rows.Scan(&hash, &path, &changed); err != nil {
+				rows.Close()
+				return 0, err
+			}
+			changes++
+			lines += changed
+			matched := cat.matching(repoName, hash, path)
+			if len(matched) == 0 {
+				continue
+			}
+			categorized++
+			categorizedLines += changed
+			if leaves := resolver.leaves(matched); len(leaves) > 1 {
+				o, ok := overlaps[path]
+				if !ok {
+					o = &overlap{}
+					for _, i := range leaves {
+						o.components = append(o.components, cat.components[i].Name)
+					}
+					overlaps[path] = o
+				}
+				o.changes++
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+		_, err = tx.Exec(`
+			INSERT INTO component_coverage (repository_id, file_changes, categorized_changes, lines, categorized_lines)
+			VALUES (?, ?, ?, ?, ?)
+		`, repoID, changes, categorized, lines, categorizedLines)
+		if err != nil {
+			return 0, err
+		}
+		for path, o := range overlaps {
+			names, err := json.Marshal(o.components)
+			if err != nil {
+				return 0, err
+			}
+			_, err = tx.Exec("INSERT INTO component_overlaps (repository_id, filepath, components, file_changes) VALUES (?, ?, ?, ?)",
+				repoID, path, string(names), o.changes)
+			if err != nil {
+				return 0, err
+			}
+		}
+		overlapping += len(overlaps)
+	}
+	return overlapping, tx.Commit()
+}
+
+// CoverageSummary is the share of the file changes of a repository matching
+// a component.
+type CoverageSummary struct {
+	Repository         string
+	FileChanges        int
+	CategorizedChanges int
+	Lines              int
+	CategorizedLines   int
+}
+
+// Percent returns the percentage of the file changes matching a component.
+func (c CoverageSummary) Percent() float64 {
+	if c.FileChanges == 0 {
+		return 0
+	}
+	return 100 * float64(c.CategorizedChanges) / float64(c.FileChanges)
+}
+
+// loadCoverage returns the component coverage of every repository, none
+// for databases written before it was computed.
+func loadCoverage(db *sql.DB) ([]CoverageSummary, error) {
+	var found bool
+	err := db.QueryRow("SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'component_coverage'").Scan(&found)
+	if err != nil || !found {
+		return nil, err
+	}
+	rows, err := db.Query(`
+		SELECT r.name, cv.file_changes, cv.categorized_changes, cv.lines, cv.categorized_lines
+		FROM component_coverage cv
+		JOIN repositories r ON r.id = cv.repository_id
+		ORDER BY r.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var coverage []CoverageSummary
+	for rows.Next() {
+		var c CoverageSummary
+		if err := rows.Scan(&c.Repository, &c.FileChanges, &c.CategorizedChanges, &c.Lines, &c.CategorizedLines); err != nil {
+			return nil, err
+		}
+		coverage = append(coverage, c)
+	}
+	return coverage, rows.Err()
+}
+
+// renderCoverage lists the component coverage of every repository.
+func renderCoverage(w io.Writer, coverage []CoverageSummary) {
+	if len(coverage) == 0 {
+		return
+	}
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "COVERAGE\tCHANGES\tCATEGORIZED\tLINES\tCATEGORIZED LINES\tPERCENT")
+	for _, c := range coverage {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%.1f%%\n", c.Repository, c.FileChanges, c.CategorizedChanges,
+			c.Lines, c.CategorizedLines, c.Percent())
+	}
+	tw.Flush()
+}
@@ -0,0 +1,137 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// csvExports maps each exported file to the query producing its rows. Column
+// names are taken from the query result.
+var csvExports = []struct {
+	name  string
+	query string
+}{
+	{"commits.csv", `
+		SELECT r.name AS repository, c.hash, c.author, c.email, c.date, c.report_date, c.message,
+			COALESCE(c.commit_type, '') AS commit_type, c.commit_scope, c.is_breaking
+		FROM commits c
+		JOIN repositories r ON r.id = c.repository_id
+		ORDER BY r.name, c.date
+	`},
+	{"file_changes.csv", `
+		SELECT r.name AS repository, fc.commit_hash, fc.filepath, fc.additions, fc.deletions, fc.change_type
+		FROM file_changes fc
+		JOIN commits c ON c.hash = fc.commit_hash
+		JOIN repositories r ON r.id = c.repository_id
+		ORDER BY r.name, c.date, fc.filepath
+	`},
+	{"component_contributions.csv", `
+		SELECT co.name AS component, COALESCE(p.name, '') AS parent, r.name AS repository, cc.author, cc.email,
+			cc.commit_count, cc.total_additions, cc.total_deletions
+		FROM component_contributions cc
+		JOIN components co ON co.id = cc.component_id
+		LEFT JOIN components p ON p.id = co.parent_id
+		JOIN repositories r ON r.id = cc.repository_id
+		ORDER BY co.name, r.name, cc.commit_count DESC
+	`},
+	{"team_contributions.csv", `
+		SELECT t.name AS team, co.name AS component, tc.contributor_count,
+			tc.commit_count, tc.total_additions, tc.total_deletions
+		FROM team_contributions tc
+		JOIN teams t ON t.id = tc.team_id
+		JOIN components co ON co.id = tc.component_id
+		ORDER BY t.name, tc.commit_count DESC
+	`},
+	{"company_contributions.csv", `
+		SELECT cc.company, co.name AS component, cc.contributor_count,
+			cc.commit_count, cc.total_additions, cc.total_deletions
+		FROM company_contributions cc
+		JOIN components co ON co.id = cc.component_id
+		ORDER BY cc.company, cc.commit_count DESC
+	`},
+}
+
+// csvFlatQuery joins every file change with its commit and repository, for
+// exports that must fit in a single file.
+const csvFlatQuery = `
+	SELECT r.name AS repository, c.hash, c.author, c.email, c.date, c.message,
+		fc.filepath, fc.additions, fc.deletions, fc.change_type
+	FROM commits c
+	JOIN repositories r ON r.id = c.repository_id
+	LEFT JOIN file_changes fc ON fc.commit_hash = c.hash
+	ORDER BY r.name, c.date, fc.filepath
+`
+
+func writeCSVExport(db *sql.DB, dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, export := range csvExports {
+		f, err := os.Create(filepath.Join(dir, export.name))
+		if err != nil {
+			return err
+		}
+		if err := writeCSVQuery(db, f, export.query); err != nil {
+			f.Close()
+			return fmt.Errorf("%s: %v", export.name, err)
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func renderCSVFlat(db *sql.DB, w io.Writer) error {
+	return writeCSVQuery(db, w, csvFlatQuery)
+}
+
+func writeCSVQuery(db *sql.DB, out io.Writer, query string) error {
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(out)
+	if err := w.Write(columns); err != nil {
+		return err
+	}
+
+	values := make([]sql.NullString, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	record := make([]string, len(columns))
+
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		for i, v := range values {
+			record[i] = v.String
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,182 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"text/tabwriter"
+)
+
+// activityDelta compares the activity of an author or component between two
+// report databases.
+type activityDelta struct {
+	Name       string
+	OldCommits int
+	NewCommits int
+	OldChurn   int
+	NewChurn   int
+}
+
+func (d activityDelta) commitsChange() int { return d.NewCommits - d.OldCommits }
+
+func diffCommand(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	format := fs.String("format", "table", "output format: table, csv or json")
+	all := fs.Bool("all", false, "also list authors and components without changes")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s diff [-format table|csv|json] <old.db> <new.db>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	oldReport, err := loadReportFile(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("Failed to load %s: %v", fs.Arg(0), err)
+	}
+	newReport, err := loadReportFile(fs.Arg(1))
+	if err != nil {
+		log.Fatalf("Failed to load %s: %v", fs.Arg(1), err)
+	}
+
+	authors := diffAuthors(oldReport.Authors, newReport.Authors)
+	components := diffComponents(oldReport.Components, newReport.Components)
+	if !*all {
+		unchanged := func(d activityDelta) bool { return d.OldCommits == d.NewCommits && d.OldChurn == d.NewChurn }
+		authors = slices.DeleteFunc(authors, unchanged)
+		components = slices.DeleteFunc(components, unchanged)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	if *format == "table" {
+		renderActivityDeltas(w, "AUTHOR", authors)
+		fmt.Fprintln(w)
+		renderActivityDeltas(w, "COMPONENT", components)
+		return
+	}
+
+	columns := []string{"kind", "name", "old_commits", "new_commits", "commits_change", "old_churn", "new_churn", "churn_change"}
+	var records [][]any
+	for _, group := range []struct {
+		kind   string
+		deltas []activityDelta
+	}{{"author", authors}, {"component", components}} {
+		for _, d := range group.deltas {
+			records = append(records, []any{group.kind, d.Name, d.OldCommits, d.NewCommits,
+				percentChange(d.OldCommits, d.NewCommits), d.OldChurn, d.NewChurn, percentChange(d.OldChurn, d.NewChurn)})
+		}
+	}
+	if err := writeRecords(w, *format, columns, records); err != nil {
+		log.Fatalf("Failed to print diff: %v", err)
+	}
+}
+
+func loadReportFile(path string) (*Report, error) {
+	db, err := openReportDatabase(path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return loadReport(db)
+}
+
+func diffAuthors(old, new []AuthorSummary) []activityDelta {
+	deltas := make(map[string]*activityDelta)
+	get := func(a AuthorSummary) *activityDelta {
+		d, ok := deltas[a.Email]
+		if !ok {
+			d = &activityDelta{Name: fmt.Sprintf("%s <%s>", a.Author, a.Email)}
+			deltas[a.Email] = d
+		}
+		return d
+	}
+	for _, a := range old {
+		d := get(a)
+		d.OldCommits, d.OldChurn = a.Commits, a.Additions+a.Deletions
+	}
+	for _, a := range new {
+		d := get(a)
+		d.NewCommits, d.NewChurn = a.Commits, a.Additions+a.Deletions
+	}
+	return sortedDeltas(deltas)
+}
+
+func diffComponents(old, new []ComponentSummary) []activityDelta {
+	deltas := make(map[string]*activityDelta)
+	get := func(name string) *activityDelta {
+		d, ok := deltas[name]
+		if !ok {
+			d = &activityDelta{Name: name}
+			deltas[name] = d
+		}
+		return d
+	}
+	for _, c := range old {
+		d := get(c.Name)
+		d.OldCommits, d.OldChurn = c.Commits, c.Additions+c.Deletions
+	}
+	for _, c := range new {
+		d := get(c.Name)
+		d.NewCommits, d.NewChurn = c.Commits, c.Additions+c.Deletions
+	}
+	return sortedDeltas(deltas)
+}
+
+// sortedDeltas orders deltas by the largest gain in commits first.
+func sortedDeltas(deltas map[string]*activityDelta) []activityDelta {
+	list := make([]activityDelta, 0, len(deltas))
+	for _, d := range deltas {
+		list = append(list, *d)
+	}
+	slices.SortFunc(list, func(a, b activityDelta) int {
+		if c := cmp.Compare(b.commitsChange(), a.commitsChange()); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return list
+}
+
+// percentChange returns the relative change from old to new, or nil when
+// there was no previous activity.
+func percentChange(old, new int) any {
+	if old == 0 {
+		return nil
+	}
+	return float64(new-old) * 100 / float64(old)
+}
+
+func formatPercentChange(old, new int) string {
+	switch {
+	case old == new:
+		return "0%"
+	case old == 0:
+		return "new"
+	case new == 0:
+		return "gone"
+	}
+	return fmt.Sprintf("%+.1f%%", percentChange(old, new))
+}
+
+func renderActivityDeltas(w io.Writer, title string, deltas []activityDelta) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\tCOMMITS\tCHANGE\tCHURN\tCHANGE\n", title)
+	for _, d := range deltas {
+		fmt.Fprintf(tw, "%s\t%d -> %d\t%s\t%d -> %d\t%s\n", d.Name,
+			d.OldCommits, d.NewCommits, formatPercentChange(d.OldCommits, d.NewCommits),
+			d.OldChurn, d.NewChurn, formatPercentChange(d.OldChurn, d.NewChurn))
+	}
+	tw.Flush()
+}
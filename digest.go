@@ -0,0 +1,167 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"cmp"
+	"database/sql"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+)
+
+const (
+	digestDays       = 7
+	digestComponents = 5
+)
+
+type digestRepository struct {
+	name       string
+	commits    int
+	authors    []AuthorSummary
+	components []ComponentSummary
+}
+
+// renderDigestReport writes the digest of the last complete week.
+func renderDigestReport(db *sql.DB, w io.Writer) error {
+	cal, err := loadCalendar(db)
+	if err != nil {
+		return err
+	}
+	until := cal.startOfWeek(time.Now())
+	since := until.AddDate(0, 0, -digestDays)
+
+	repos, err := loadDigest(db, since, until)
+	if err != nil {
+		return err
+	}
+	renderDigest(w, repos, since, until.AddDate(0, 0, -1))
+	return nil
+}
+
+func loadDigest(db *sql.DB, since, until time.Time) ([]*digestRepository, error) {
+	components, err := loadComponentPatterns(db)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT r.name, c.hash, c.author, c.email, COALESCE(fc.filepath, ''),
+			COALESCE(fc.additions, 0), COALESCE(fc.deletions, 0)
+		FROM repositories r
+		LEFT JOIN commits c ON c.repository_id = r.id AND c.report_date >= ? AND c.report_date < ?
+		LEFT JOIN file_changes fc ON fc.commit_hash = c.hash
+		ORDER BY r.name
+	`, since, until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var repos []*digestRepository
+	byName := make(map[string]*digestRepository)
+	authors := make(map[string]map[string]*AuthorSummary)
+	comps := make(map[string]map[string]*ComponentSummary)
+	seen := make(map[string]bool)
+	seenComponent := make(map[string]bool)
+
+	for rows.Next() {
+		var repoName, path string
+		var hash, author, email sql.NullString
+		var additions, deletions int
+		if err := rows.Scan(&repoName, &hash, &author, &email, &path, &additions, &deletions); err != nil {
+			return nil, err
+		}
+
+		repo, ok := byName[repoName]
+		if !ok {
+			repo = &digestRepository{name: repoName}
+			byName[repoName] = repo
+			repos = append(repos, repo)
+			authors[repoName] = make(map[string]*AuthorSummary)
+			comps[repoName] = make(map[string]*ComponentSummary)
+		}
+		if !hash.Valid {
+			continue
+		}
+
+		a, ok := authors[repoName][email.String]
+		if !ok {
+			a = &AuthorSummary{Author: author.String, Email: email.String}
+			authors[repoName][email.String] = a
+		}
+		if !seen[hash.String] {
+			seen[hash.String] = true
+			repo.commits++
+			a.Commits++
+		}
+		a.Additions += additions
+		a.Deletions += deletions
+
+		for _, comp := range components {
+			if !comp.matches(repoName, path) {
+				continue
+			}
+			c, ok := comps[repoName][comp.name]
+			if !ok {
+				c = &ComponentSummary{Name: comp.name}
+				comps[repoName][comp.name] = c
+			}
+			if key := comp.name + "\x00" + hash.String; !seenComponent[key] {
+				seenComponent[key] = true
+				c.Commits++
+			}
+			c.Additions += additions
+			c.Deletions += deletions
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, repo := range repos {
+		for _, a := range authors[repo.name] {
+			repo.authors = append(repo.authors, *a)
+		}
+		slices.SortFunc(repo.authors, func(a, b AuthorSummary) int {
+			if a.Commits != b.Commits {
+				return b.Commits - a.Commits
+			}
+			return cmp.Compare(a.Email, b.Email)
+		})
+		for _, c := range comps[repo.name] {
+			repo.components = append(repo.components, *c)
+		}
+		slices.SortFunc(repo.components, func(a, b ComponentSummary) int {
+			if churn := (b.Additions + b.Deletions) - (a.Additions + a.Deletions); churn != 0 {
+				return churn
+			}
+			return cmp.Compare(a.Name, b.Name)
+		})
+	}
+	return repos, nil
+}
+
+func renderDigest(w io.Writer, repos []*digestRepository, since, until time.Time) {
+	fmt.Fprintf(w, "# Weekly digest: %s to %s\n", formatDate(since), formatDate(until))
+	for _, repo := range repos {
+		fmt.Fprintf(w, "\n## %s\n\n", repo.name)
+		if repo.commits == 0 {
+			fmt.Fprintf(w, "No commits.\n")
+			continue
+		}
+		fmt.Fprintf(w, "%d commits by %d authors.\n\n", repo.commits, len(repo.authors))
+		for _, a := range repo.authors {
+			fmt.Fprintf(w, "- %s: %d commits (+%d -%d)\n", a.Author, a.Commits, a.Additions, a.Deletions)
+		}
+		if len(repo.components) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\nMost changed components:\n\n")
+		for _, c := range repo.components[:min(digestComponents, len(repo.components))] {
+			fmt.Fprintf(w, "- %s: %d commits (+%d -%d)\n", c.Name, c.Commits, c.Additions, c.Deletions)
+		}
+	}
+}
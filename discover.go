@@ -0,0 +1,126 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// findRepositories walks root looking for git work trees, up to maxDepth
+// directories below it (unlimited when negative). Hidden directories are
+// skipped and repositories are not searched for nested ones.
+func findRepositories(root string, maxDepth int) ([]string, error) {
+	var paths []string
+	root = filepath.Clean(root)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != root && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if _, err := os.Stat(filepath.Join(path, ".git")); err == nil {
+			paths = append(paths, path)
+			return filepath.SkipDir
+		}
+		if rel, _ := filepath.Rel(root, path); maxDepth >= 0 && rel != "." && strings.Count(rel, string(filepath.Separator))+1 >= maxDepth {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return paths, err
+}
+
+// discoverRepositories adds the repositories found below each root that are
+// not configured yet and have commits. Names are the paths relative to the
+// root, or the root directory name for a repository at the root itself.
+func (c *Config) discoverRepositories(roots []string) error {
+	known := make(map[string]bool)
+	for _, repo := range c.Repositories {
+		if abs, err := filepath.Abs(repo.Path); err == nil {
+			known[abs] = true
+		}
+	}
+	for _, root := range roots {
+		paths, err := findRepositories(root, -1)
+		if err != nil {
+			return fmt.Errorf("discover %s: %v", root, err)
+		}
+		for _, path := range paths {
+			abs, err := filepath.Abs(path)
+			if err != nil {
+				return err
+			}
+			if known[abs] || !hasCommits(path) {
+				continue
+			}
+			known[abs] = true
+			name, err := filepath.Rel(root, path)
+			if err != nil || name == "." {
+				name = filepath.Base(abs)
+			}
+			c.Repositories = append(c.Repositories, Repository{Path: path, Name: filepath.ToSlash(name)})
+		}
+	}
+	return nil
+}
+
+// expandRepositoryGlobs replaces repositories whose path is a glob pattern
+// with one repository per matching git work tree with commits, named after
+// its directory.
+func (c *Config) expandRepositoryGlobs() error {
+	var repos []Repository
+	for _, repo := range c.Repositories {
+		if !strings.ContainsAny(repo.Path, "*?[") || isRemoteURL(repo.Path) {
+			repos = append(repos, repo)
+			continue
+		}
+		if repo.Name != "" {
+			return fmt.Errorf("%s: repository name cannot be set for glob path %q", repo.loc.at("name"), repo.Path)
+		}
+		matches, err := filepath.Glob(repo.Path)
+		if err != nil {
+			return fmt.Errorf("%s: invalid repository path %q: %v", repo.loc.at("path"), repo.Path, err)
+		}
+		for _, path := range matches {
+			if _, err := os.Stat(filepath.Join(path, ".git")); err != nil || !hasCommits(path) {
+				continue
+			}
+			repos = append(repos, Repository{Path: path, Name: filepath.Base(path), loc: repo.loc})
+		}
+	}
+	c.Repositories = repos
+	return nil
+}
+
+// hasCommits reports whether the repository at path has a HEAD commit, so
+// freshly initialized repositories are not discovered.
+func hasCommits(path string) bool {
+	return gitCommand(path, "rev-parse", "--verify", "--quiet", "HEAD").Run() == nil
+}
+
+// repositoryName derives a unique repository name from its path.
+func repositoryName(path string, taken map[string]bool) string {
+	name := filepath.Base(path)
+	if abs, err := filepath.Abs(path); err == nil {
+		name = filepath.Base(abs)
+	}
+	unique := name
+	for i := 2; taken[unique]; i++ {
+		unique = name + "-" + strconv.Itoa(i)
+	}
+	taken[unique] = true
+	return unique
+}
@@ -0,0 +1,99 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Email struct {
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+	// Username enables SMTP authentication; the password is read from the
+	// environment variable named by PasswordEnv.
+	Username    string   `yaml:"username"`
+	PasswordEnv string   `yaml:"password_env"`
+	From        string   `yaml:"from"`
+	To          []string `yaml:"to"`
+	Subject     string   `yaml:"subject"`
+	// Format is the report sent as message body: html (default) or markdown.
+	Format string `yaml:"format"`
+}
+
+func (e Email) enabled() bool {
+	return e.Host != ""
+}
+
+func validateEmail(e Email) error {
+	if e.From == "" {
+		return fmt.Errorf("email from is required")
+	}
+	if len(e.To) == 0 {
+		return fmt.Errorf("email recipients are required")
+	}
+	switch e.Format {
+	case "", "html", "markdown":
+	default:
+		return fmt.Errorf("unsupported email format: %s", e.Format)
+	}
+	if e.Username != "" && e.PasswordEnv == "" {
+		return fmt.Errorf("email password_env is required with username")
+	}
+	return nil
+}
+
+// sendEmail renders the report and sends it to the configured recipients.
+func sendEmail(db *sql.DB, e Email) error {
+	var body bytes.Buffer
+	contentType := "text/html; charset=utf-8"
+	render := renderHTMLReport
+	if e.Format == "markdown" {
+		contentType = "text/markdown; charset=utf-8"
+		render = renderMarkdownReport
+	}
+	if err := render(db, &body); err != nil {
+		return err
+	}
+
+	subject := e.Subject
+	if subject == "" {
+		subject = "git-report " + time.Now().Format(time.DateOnly)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: %s\r\n", contentType)
+	fmt.Fprintf(&msg, "Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(&msg)
+	qp.Write(body.Bytes())
+	qp.Close()
+
+	port := e.Port
+	if port == 0 {
+		port = 587
+	}
+	addr := net.JoinHostPort(e.Host, strconv.Itoa(port))
+
+	var auth smtp.Auth
+	if e.Username != "" {
+		auth = smtp.PlainAuth("", e.Username, os.Getenv(e.PasswordEnv), e.Host)
+	}
+	slog.Info("Sending report email", "to", strings.Join(e.To, ", "), "server", addr)
+	return smtp.SendMail(addr, auth, e.From, e.To, msg.Bytes())
+}
@@ -0,0 +1,525 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expressions of filters.expr are a small, typed language over the fields
+// of a commit, in the spirit of CEL:
+//
+//	additions + deletions < 2000 && !author.endsWith("[bot]")
+//
+// Values are integers, strings and booleans. Operators, by increasing
+// precedence: ||, &&, comparisons (== != < <= > >=), + - (+ also joins
+// strings), * / %, and unary ! and -. Strings have the methods contains,
+// startsWith, endsWith, matches (a regular expression literal), lower,
+// upper and size. Expressions are type checked when compiled, so a
+// configuration with an invalid one is rejected before ingesting.
+
+// exprType is the type of an expression value.
+type exprType int
+
+const (
+	exprInt exprType = iota
+	exprString
+	exprBool
+)
+
+func (t exprType) String() string {
+	return [...]string{"int", "string", "bool"}[t]
+}
+
+// exprFields are the commit fields expressions can use.
+var exprFields = map[string]struct {
+	typ   exprType
+	value func(c *Commit) any
+}{
+	"hash":      {exprString, func(c *Commit) any { return c.Hash }},
+	"author":    {exprString, func(c *Commit) any { return c.Author }},
+	"email":     {exprString, func(c *Commit) any { return c.Email }},
+	"message":   {exprString, func(c *Commit) any { return c.Message }},
+	"additions": {exprInt, func(c *Commit) any { return c.Additions }},
+	"deletions": {exprInt, func(c *Commit) any { return c.Deletions }},
+	"files":     {exprInt, func(c *Commit) any { return int64(c.FilesChanged) }},
+	"parents":   {exprInt, func(c *Commit) any { return int64(len(c.Parents)) }},
+	"merge":     {exprBool, func(c *Commit) any { return len(c.Parents) > 1 }},
+}
+
+// exprNode is a compiled expression: its type and a function computing its
+// value, an int64, string or bool. literal is set for string literals.
+type exprNode struct {
+	typ     exprType
+	eval    func(c *Commit) any
+	literal *string
+}
+
+// exprError is the error of evaluating an expression, e.g. a division by
+// zero, raised as a panic and returned by match.
+type exprError struct{ msg string }
+
+// commitExpr is a compiled filters.expr.
+type commitExpr struct {
+	source string
+	root   exprNode
+}
+
+// compileExpr parses and type checks a boolean expression.
+func compileExpr(source string) (*commitExpr, error) {
+	tokens, err := lexExpr(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at offset %d", tok.text, tok.pos)
+	}
+	if root.typ != exprBool {
+		return nil, fmt.Errorf("expression is %s, expected bool", root.typ)
+	}
+	return &commitExpr{source: source, root: root}, nil
+}
+
+// match reports whether c satisfies the expression.
+func (e *commitExpr) match(c *Commit) (ok bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			exprErr, isExprErr := r.(exprError)
+			if !isExprErr {
+				panic(r)
+			}
+			err = fmt.Errorf("filters.expr %q on %s: %s", e.source, c.Hash, exprErr.msg)
+		}
+	}()
+	return e.root.eval(c).(bool), nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokInt
+	tokString
+	tokIdent
+	tokOp
+)
+
+type exprToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// exprOperators are matched longest first.
+var exprOperators = []string{"||", "&&", "==", "!=", "<=", ">=", "<", ">", "+", "-", "*", "/", "%", "!", "(", ")", ".", ","}
+
+func lexExpr(source string) ([]exprToken, error) {
+	var tokens []exprToken
+	for i := 0; i < len(source); {
+		c := rune(source[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(source) && source[i] >= '0' && source[i] <= '9' {
+				i++
+			}
+			tokens = append(tokens, exprToken{tokInt, source[start:i], start})
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			for i < len(source) && (source[i] == '_' || unicode.IsLetter(rune(source[i])) || unicode.IsDigit(rune(source[i]))) {
+				i++
+			}
+			tokens = append(tokens, exprToken{tokIdent, source[start:i], start})
+		case c == '"' || c == '\'':
+			// Go escapes, in double or single quotes.
+			start := i
+			var text strings.Builder
+			rest := source[i+1:]
+			for len(rest) > 0 && rest[0] != source[start] {
+				r, _, tail, err := strconv.UnquoteChar(rest, source[start])
+				if err != nil {
+					return nil, fmt.Errorf("invalid string at offset %d", start)
+				}
+				text.WriteRune(r)
+				rest = tail
+			}
+			if len(rest) == 0 {
+				return nil, fmt.Errorf("unterminated string at offset %d", start)
+			}
+			i = len(source) - len(rest) + 1
+			tokens = append(tokens, exprToken{tokString, text.String(), start})
+		default:
+			op := ""
+			for _, candidate := range exprOperators {
+				if strings.HasPrefix(source[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at offset %d", c, i)
+			}
+			tokens = append(tokens, exprToken{tokOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(tokens, exprToken{tokEOF, "end of expression", len(source)}), nil
+}
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept consumes the next token if it is one of the operators ops.
+func (p *exprParser) accept(ops ...string) (exprToken, bool) {
+	tok := p.peek()
+	for _, op := range ops {
+		if tok.kind == tokOp && tok.text == op {
+			p.pos++
+			return tok, true
+		}
+	}
+	return tok, false
+}
+
+func (p *exprParser) expect(op string) error {
+	if tok, ok := p.accept(op); !ok {
+		return fmt.Errorf("expected %q at offset %d, found %q", op, tok.pos, tok.text)
+	}
+	return nil
+}
+
+func operandError(op exprToken, types ...exprType) error {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = t.String()
+	}
+	return fmt.Errorf("invalid operand types %s for %q at offset %d", strings.Join(names, " and "), op.text, op.pos)
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return left, err
+	}
+	for {
+		op, ok := p.accept("||")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return right, err
+		}
+		if left.typ != exprBool || right.typ != exprBool {
+			return left, operandError(op, left.typ, right.typ)
+		}
+		l, r := left.eval, right.eval
+		left = exprNode{typ: exprBool, eval: func(c *Commit) any { return l(c).(bool) || r(c).(bool) }}
+	}
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return left, err
+	}
+	for {
+		op, ok := p.accept("&&")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseComparison()
+		if err != nil {
+			return right, err
+		}
+		if left.typ != exprBool || right.typ != exprBool {
+			return left, operandError(op, left.typ, right.typ)
+		}
+		l, r := left.eval, right.eval
+		left = exprNode{typ: exprBool, eval: func(c *Commit) any { return l(c).(bool) && r(c).(bool) }}
+	}
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseSum()
+	if err != nil {
+		return left, err
+	}
+	op, ok := p.accept("==", "!=", "<=", ">=", "<", ">")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.parseSum()
+	if err != nil {
+		return right, err
+	}
+	if left.typ != right.typ || (left.typ == exprBool && op.text != "==" && op.text != "!=") {
+		return left, operandError(op, left.typ, right.typ)
+	}
+	l, r := left.eval, right.eval
+	if op.text == "==" || op.text == "!=" {
+		equal := op.text == "=="
+		return exprNode{typ: exprBool, eval: func(c *Commit) any { return (l(c) == r(c)) == equal }}, nil
+	}
+	compare := func(c *Commit) int {
+		if left.typ == exprInt {
+			return cmp.Compare(l(c).(int64), r(c).(int64))
+		}
+		return cmp.Compare(l(c).(string), r(c).(string))
+	}
+	var holds func(int) bool
+	switch op.text {
+	case "<":
+		holds = func(n int) bool { return n < 0 }
+	case "<=":
+		holds = func(n int) bool { return n <= 0 }
+	case ">":
+		holds = func(n int) bool { return n > 0 }
+	default:
+		holds = func(n int) bool { return n >= 0 }
+	}
+	return exprNode{typ: exprBool, eval: func(c *Commit) any { return holds(compare(c)) }}, nil
+}
+
+func (p *exprParser) parseSum() (exprNode, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return left, err
+	}
+	for {
+		op, ok := p.accept("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseProduct()
+		if err != nil {
+			return right, err
+		}
+		l, r := left.eval, right.eval
+		switch {
+		case left.typ == exprInt && right.typ == exprInt && op.text == "+":
+			left = exprNode{typ: exprInt, eval: func(c *Commit) any { return l(c).(int64) + r(c).(int64) }}
+		case left.typ == exprInt && right.typ == exprInt:
+			left = exprNode{typ: exprInt, eval: func(c *Commit) any { return l(c).(int64) - r(c).(int64) }}
+		case left.typ == exprString && right.typ == exprString && op.text == "+":
+			left = exprNode{typ: exprString, eval: func(c *Commit) any { return l(c).(string) + r(c).(string) }}
+		default:
+			return left, operandError(op, left.typ, right.typ)
+		}
+	}
+}
+
+func (p *exprParser) parseProduct() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return left, err
+	}
+	for {
+		op, ok := p.accept("*", "/", "%")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return right, err
+		}
+		if left.typ != exprInt || right.typ != exprInt {
+			return left, operandError(op, left.typ, right.typ)
+		}
+		l, r := left.eval, right.eval
+		switch op.text {
+		case "*":
+			left = exprNode{typ: exprInt, eval: func(c *Commit) any { return l(c).(int64) * r(c).(int64) }}
+		default:
+			modulo := op.text == "%"
+			left = exprNode{typ: exprInt, eval: func(c *Commit) any {
+				a, b := l(c).(int64), r(c).(int64)
+				if b == 0 {
+					panic(exprError{"division by zero"})
+				}
+				if modulo {
+					return a % b
+				}
+				return a / b
+			}}
+		}
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	op, ok := p.accept("!", "-")
+	if !ok {
+		return p.parsePostfix()
+	}
+	operand, err := p.parseUnary()
+	if err != nil {
+		return operand, err
+	}
+	eval := operand.eval
+	switch {
+	case op.text == "!" && operand.typ == exprBool:
+		return exprNode{typ: exprBool, eval: func(c *Commit) any { return !eval(c).(bool) }}, nil
+	case op.text == "-" && operand.typ == exprInt:
+		return exprNode{typ: exprInt, eval: func(c *Commit) any { return -eval(c).(int64) }}, nil
+	}
+	return operand, operandError(op, operand.typ)
+}
+
+// parsePostfix parses a primary expression followed by method calls.
+func (p *exprParser) parsePostfix() (exprNode, error) {
+	node, err := p.parsePrimary()
+	if err != nil {
+		return node, err
+	}
+	for {
+		if _, ok := p.accept("."); !ok {
+			return node, nil
+		}
+		name := p.next()
+		if name.kind != tokIdent {
+			return node, fmt.Errorf("expected a method name at offset %d, found %q", name.pos, name.text)
+		}
+		if err := p.expect("("); err != nil {
+			return node, err
+		}
+		var args []exprNode
+		if _, ok := p.accept(")"); !ok {
+			for {
+				arg, err := p.parseOr()
+				if err != nil {
+					return arg, err
+				}
+				args = append(args, arg)
+				if _, ok := p.accept(","); !ok {
+					break
+				}
+			}
+			if err := p.expect(")"); err != nil {
+				return node, err
+			}
+		}
+		if node, err = stringMethod(node, name, args); err != nil {
+			return node, err
+		}
+	}
+}
+
+// stringMethod returns the call of a string method on recv.
+func stringMethod(recv exprNode, name exprToken, args []exprNode) (exprNode, error) {
+	if recv.typ != exprString {
+		return recv, fmt.Errorf("method %s at offset %d called on %s, expected string", name.text, name.pos, recv.typ)
+	}
+	s := recv.eval
+	wantArgs := func(n int) error {
+		if len(args) != n {
+			return fmt.Errorf("method %s at offset %d takes %d arguments, got %d", name.text, name.pos, n, len(args))
+		}
+		if n == 1 && args[0].typ != exprString {
+			return fmt.Errorf("method %s at offset %d takes a string, got %s", name.text, name.pos, args[0].typ)
+		}
+		return nil
+	}
+	var test func(string, string) bool
+	switch name.text {
+	case "contains":
+		test = strings.Contains
+	case "startsWith":
+		test = strings.HasPrefix
+	case "endsWith":
+		test = strings.HasSuffix
+	case "matches":
+		if err := wantArgs(1); err != nil {
+			return recv, err
+		}
+		if args[0].literal == nil {
+			return recv, fmt.Errorf("method matches at offset %d takes a regular expression literal", name.pos)
+		}
+		re, err := regexp.Compile(*args[0].literal)
+		if err != nil {
+			return recv, fmt.Errorf("invalid regular expression at offset %d: %v", name.pos, err)
+		}
+		return exprNode{typ: exprBool, eval: func(c *Commit) any { return re.MatchString(s(c).(string)) }}, nil
+	case "lower", "upper":
+		if err := wantArgs(0); err != nil {
+			return recv, err
+		}
+		convert := strings.ToLower
+		if name.text == "upper" {
+			convert = strings.ToUpper
+		}
+		return exprNode{typ: exprString, eval: func(c *Commit) any { return convert(s(c).(string)) }}, nil
+	case "size":
+		if err := wantArgs(0); err != nil {
+			return recv, err
+		}
+		return exprNode{typ: exprInt, eval: func(c *Commit) any { return int64(len([]rune(s(c).(string)))) }}, nil
+	default:
+		return recv, fmt.Errorf("unknown method %s at offset %d", name.text, name.pos)
+	}
+	if err := wantArgs(1); err != nil {
+		return recv, err
+	}
+	arg := args[0].eval
+	return exprNode{typ: exprBool, eval: func(c *Commit) any { return test(s(c).(string), arg(c).(string)) }}, nil
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokInt:
+		n, err := strconv.ParseInt(tok.text, 10, 64)
+		if err != nil {
+			return exprNode{}, fmt.Errorf("invalid integer %s at offset %d", tok.text, tok.pos)
+		}
+		return exprNode{typ: exprInt, eval: func(*Commit) any { return n }}, nil
+	case tokString:
+		return exprNode{typ: exprString, eval: func(*Commit) any { return tok.text }, literal: &tok.text}, nil
+	case tokIdent:
+		switch tok.text {
+		case "true", "false":
+			b := tok.text == "true"
+			return exprNode{typ: exprBool, eval: func(*Commit) any { return b }}, nil
+		}
+		field, ok := exprFields[tok.text]
+		if !ok {
+			return exprNode{}, fmt.Errorf("unknown field %s at offset %d", tok.text, tok.pos)
+		}
+		return exprNode{typ: field.typ, eval: field.value}, nil
+	case tokOp:
+		if tok.text == "(" {
+			node, err := p.parseOr()
+			if err != nil {
+				return node, err
+			}
+			return node, p.expect(")")
+		}
+	}
+	return exprNode{}, fmt.Errorf("unexpected %q at offset %d", tok.text, tok.pos)
+}
@@ -0,0 +1,156 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// followedFiles returns, by repository name, the patterns of a component
+// with follow set that name single files, those whose history is traced
+// across renames.
+func (comp Component) followedFiles() map[string][]string {
+	files := make(map[string][]string)
+	if !comp.Follow {
+		return files
+	}
+	for repoName, patterns := range splitComponentPatterns(comp.Paths) {
+		for _, pattern := range patterns {
+			if !isRegexPattern(pattern) && !strings.ContainsAny(pattern, "*?[{") {
+				files[repoName] = append(files[repoName], pattern)
+			}
+		}
+	}
+	return files
+}
+
+// gitFollow returns the commits of revision changing the file at path,
+// renames followed, with the name of the file in each of them.
+func gitFollow(ctx context.Context, repo Repository, revision, path string) (map[string][]string, error) {
+	output, err := gitCommandContext(ctx, repo.Path, "log", "--follow", "--name-only", "--format=%x00%H", revision, "--", path).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git log --follow %s failed: %v", path, err)
+	}
+	names := make(map[string][]string)
+	for _, entry := range strings.Split(string(output), "\x00") {
+		hash, files, _ := strings.Cut(entry, "\n")
+		if hash == "" {
+			continue
+		}
+		for file := range strings.Lines(files) {
+			if file = strings.TrimSuffix(file, "\n"); file != "" {
+				names[hash] = append(names[hash], file)
+			}
+		}
+	}
+	return names, nil
+}
+
+// replaceFollowedPaths records in followed_paths the names every file
+// followed by a component had in the commits changing it, traced with git
+// log --follow. It reports whether the commits with a rowid up to after,
+// those already aggregated in component contributions, changed.
+func (c *Config) replaceFollowedPaths(ctx context.Context, db *sql.DB, repoIDs map[string]int, after int64) (bool, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	var changed bool
+	err = withTempTable(tx, "followed", "repository_id INTEGER, path TEXT, commit_hash TEXT, filepath TEXT", func() error {
+		for _, repo := range c.Repositories {
+			repoID, ok := repoIDs[repo.Name]
+			if !ok {
+				continue
+			}
+			// Components may follow the same file.
+			seen := make(map[string]bool)
+			for _, comp := range c.Components {
+				for _, path := range comp.followedFiles()[repo.Name] {
+					if seen[path] {
+						continue
+					}
+					seen[path] = true
+					names, err := gitFollow(ctx, repo, c.Filters.revision(), path)
+					if err != nil {
+						return fmt.Errorf("%s: %v", repo.Name, err)
+					}
+					for hash, files := range names {
+						for _, file := range files {
+							_, err := tx.Exec("INSERT INTO temp.followed (repository_id, path, commit_hash, filepath) VALUES (?, ?, ?, ?)",
+								repoID, path, hash, file)
+							if err != nil {
+								return err
+							}
+						}
+					}
+				}
+			}
+		}
+
+		err := tx.QueryRow(`
+			SELECT EXISTS (
+				SELECT 1 FROM (
+					SELECT * FROM (
+						SELECT repository_id, path, commit_hash, filepath FROM temp.followed
+						EXCEPT SELECT repository_id, path, commit_hash, filepath FROM followed_paths
+					)
+					UNION ALL
+					SELECT * FROM (
+						SELECT repository_id, path, commit_hash, filepath FROM followed_paths
+						EXCEPT SELECT repository_id, path, commit_hash, filepath FROM temp.followed
+					)
+				) d
+				JOIN commits c ON c.hash = d.commit_hash
+				WHERE c.rowid <= ?
+			)
+		`, after).Scan(&changed)
+		if err != nil {
+			return err
+		}
+		for _, stmt := range []string{
+			"DELETE FROM followed_paths",
+			`INSERT OR IGNORE INTO followed_paths (repository_id, path, commit_hash, filepath)
+				SELECT repository_id, path, commit_hash, filepath FROM temp.followed`,
+		} {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return changed, tx.Commit()
+}
+
+// loadFollowedPaths returns the commits and file names traced for the files
+// of a repository followed by a component, keyed by hash and name
+// separated by a NUL byte.
+func loadFollowedPaths(db *sql.DB, comp Component, repoName string, repoID int) (map[string]bool, error) {
+	followed := make(map[string]bool)
+	for _, path := range comp.followedFiles()[repoName] {
+		rows, err := db.Query("SELECT commit_hash, filepath FROM followed_paths WHERE repository_id = ? AND path = ?", repoID, path)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var hash, file string
+			if err := rows.Scan(&hash, &file); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			followed[hash+"\x00"+file] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return followed, nil
+}
@@ -0,0 +1,786 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// A small GraphQL subset over the report database: queries with nested
+// selections, aliases, arguments and variables. Fragments, directives and
+// mutations are not supported.
+
+const graphqlSchema = `type Query {
+  repositories: [Repository!]!
+  repository(name: String!): Repository
+  commits(repository: String, author: String, since: String, until: String, limit: Int): [Commit!]!
+  components: [Component!]!
+  component(name: String!): Component
+}
+
+type Repository {
+  name: String!
+  path: String!
+  commits(author: String, since: String, until: String, limit: Int): [Commit!]!
+}
+
+type Commit {
+  hash: String!
+  repository: String!
+  author: String!
+  email: String!
+  date: String!
+  message: String!
+  fileChanges: [FileChange!]!
+}
+
+type FileChange {
+  filepath: String!
+  additions: Int
+  deletions: Int
+  changeType: String!
+  binary: Boolean!
+}
+
+type Component {
+  name: String!
+  pathPatterns: [String!]!
+  contributions(repository: String, author: String): [Contribution!]!
+}
+
+type Contribution {
+  repository: String!
+  author: String!
+  email: String!
+  commitCount: Int!
+  totalAdditions: Int!
+  totalDeletions: Int!
+}
+`
+
+// gqlArgument is an argument declared in the schema, with its type name
+// and whether it is required (non-null).
+type gqlArgument struct {
+	typ      string
+	required bool
+}
+
+// gqlSchemaArgs maps the type and field names of the schema to the
+// arguments of the field, which queries are checked against.
+var gqlSchemaArgs = parseGQLSchema(graphqlSchema)
+
+// parseGQLSchema reads the arguments of the fields of graphqlSchema, one
+// field per line.
+func parseGQLSchema(schema string) map[string]map[string]map[string]gqlArgument {
+	types := make(map[string]map[string]map[string]gqlArgument)
+	var fields map[string]map[string]gqlArgument
+	for line := range strings.Lines(schema) {
+		line = strings.TrimSpace(line)
+		if name, ok := strings.CutPrefix(line, "type "); ok {
+			fields = make(map[string]map[string]gqlArgument)
+			types[strings.TrimSuffix(name, " {")] = fields
+			continue
+		}
+		if line == "" || line == "}" {
+			continue
+		}
+		args := make(map[string]gqlArgument)
+		name, params, ok := strings.Cut(line, "(")
+		if ok {
+			params, _, _ = strings.Cut(params, ")")
+			for param := range strings.SplitSeq(params, ",") {
+				arg, typ, _ := strings.Cut(param, ":")
+				typ = strings.TrimSpace(typ)
+				args[strings.TrimSpace(arg)] = gqlArgument{strings.TrimSuffix(typ, "!"), strings.HasSuffix(typ, "!")}
+			}
+		} else {
+			name, _, _ = strings.Cut(line, ":")
+		}
+		fields[name] = args
+	}
+	return types
+}
+
+// gqlCheckArgs checks the arguments of a field of typename against the
+// schema: their names, their types and the required ones. Limits are not
+// negative.
+func gqlCheckArgs(typename string, f gqlField) error {
+	declared, ok := gqlSchemaArgs[typename][f.name]
+	if !ok {
+		return gqlUnknownField(typename, f.name)
+	}
+	for name, value := range f.args {
+		arg, ok := declared[name]
+		if !ok {
+			return fmt.Errorf("unknown argument %s on field %s.%s", name, typename, f.name)
+		}
+		if value == nil {
+			continue
+		}
+		valid := false
+		switch arg.typ {
+		case "String":
+			_, valid = value.(string)
+		case "Int":
+			n, ok := value.(float64)
+			valid = ok && n == float64(int(n))
+		case "Boolean":
+			_, valid = value.(bool)
+		}
+		if !valid {
+			return fmt.Errorf("argument %s on field %s.%s expects a value of type %s", name, typename, f.name, arg.typ)
+		}
+		if n, ok := value.(float64); ok && name == "limit" && n < 0 {
+			return fmt.Errorf("argument limit on field %s.%s expects a non-negative value", typename, f.name)
+		}
+	}
+	for name, arg := range declared {
+		if arg.required && f.args[name] == nil {
+			return fmt.Errorf("argument %s of type %s! is required on field %s.%s", name, arg.typ, typename, f.name)
+		}
+	}
+	return nil
+}
+
+type gqlField struct {
+	alias      string
+	name       string
+	args       map[string]any
+	selections []gqlField
+}
+
+// gqlObject resolves the fields of a GraphQL object type.
+type gqlObject interface {
+	typename() string
+	resolve(field string, args map[string]any) (any, error)
+}
+
+type gqlParser struct {
+	src  string
+	pos  int
+	vars map[string]any
+}
+
+func (p *gqlParser) skip() {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		case c == ',' || unicode.IsSpace(rune(c)):
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *gqlParser) peek() byte {
+	p.skip()
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *gqlParser) expect(c byte) error {
+	if p.peek() != c {
+		return fmt.Errorf("expected %q at offset %d", c, p.pos)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *gqlParser) name() (string, error) {
+	p.skip()
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || p.pos > start && c >= '0' && c <= '9' {
+			p.pos++
+			continue
+		}
+		break
+	}
+	if start == p.pos {
+		return "", fmt.Errorf("expected name at offset %d", p.pos)
+	}
+	return p.src[start:p.pos], nil
+}
+
+// document parses a single operation and returns its top level selections.
+func (p *gqlParser) document() ([]gqlField, error) {
+	if p.peek() != '{' {
+		op, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if op != "query" {
+			return nil, fmt.Errorf("unsupported operation: %s", op)
+		}
+		if c := p.peek(); c != '{' && c != '(' {
+			if _, err := p.name(); err != nil {
+				return nil, err
+			}
+		}
+		if p.peek() == '(' {
+			if err := p.variableDefinitions(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	fields, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() != 0 {
+		return nil, fmt.Errorf("unexpected input at offset %d", p.pos)
+	}
+	return fields, nil
+}
+
+// variableDefinitions skips the declared variable types; values come from
+// the request and missing ones resolve to null.
+func (p *gqlParser) variableDefinitions() error {
+	if err := p.expect('('); err != nil {
+		return err
+	}
+	for p.peek() != ')' {
+		if p.peek() == 0 {
+			return fmt.Errorf("unterminated variable definitions")
+		}
+		p.pos++
+	}
+	p.pos++
+	return nil
+}
+
+func (p *gqlParser) selectionSet() ([]gqlField, error) {
+	if err := p.expect('{'); err != nil {
+		return nil, err
+	}
+	var fields []gqlField
+	for p.peek() != '}' {
+		if p.peek() == '.' {
+			return nil, fmt.Errorf("fragments are not supported")
+		}
+		field, err := p.field()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+	p.pos++
+	return fields, nil
+}
+
+func (p *gqlParser) field() (gqlField, error) {
+	var f gqlField
+	name, err := p.name()
+	if err != nil {
+		return f, err
+	}
+	f.alias, f.name = name, name
+	if p.peek() == ':' {
+		p.pos++
+		if f.name, err = p.name(); err != nil {
+			return f, err
+		}
+	}
+	if p.peek() == '(' {
+		p.pos++
+		f.args = make(map[string]any)
+		for p.peek() != ')' {
+			arg, err := p.name()
+			if err != nil {
+				return f, err
+			}
+			if err := p.expect(':'); err != nil {
+				return f, err
+			}
+			if f.args[arg], err = p.value(); err != nil {
+				return f, err
+			}
+		}
+		p.pos++
+	}
+	if p.peek() == '{' {
+		if f.selections, err = p.selectionSet(); err != nil {
+			return f, err
+		}
+	}
+	return f, nil
+}
+
+func (p *gqlParser) value() (any, error) {
+	switch c := p.peek(); {
+	case c == '$':
+		p.pos++
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		return p.vars[name], nil
+	case c == '"':
+		start := p.pos
+		p.pos++
+		for p.pos < len(p.src) && p.src[p.pos] != '"' {
+			if p.src[p.pos] == '\\' {
+				p.pos++
+			}
+			p.pos++
+		}
+		p.pos++
+		return strconv.Unquote(p.src[start:min(p.pos, len(p.src))])
+	case c == '-' || c >= '0' && c <= '9':
+		start := p.pos
+		p.pos++
+		for p.pos < len(p.src) && strings.IndexByte("0123456789.eE+-", p.src[p.pos]) >= 0 {
+			p.pos++
+		}
+		return strconv.ParseFloat(p.src[start:p.pos], 64)
+	default:
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return name, nil
+	}
+}
+
+// gqlResult keeps the response fields in selection order.
+type gqlResult struct {
+	keys   []string
+	values map[string]any
+}
+
+func (r *gqlResult) set(key string, value any) {
+	if _, ok := r.values[key]; !ok {
+		r.keys = append(r.keys, key)
+	}
+	r.values[key] = value
+}
+
+func (r *gqlResult) MarshalJSON() ([]byte, error) {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, key := range r.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(r.values[key])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return []byte(b.String()), nil
+}
+
+func gqlExecute(obj gqlObject, fields []gqlField) (*gqlResult, error) {
+	result := &gqlResult{values: make(map[string]any, len(fields))}
+	for _, f := range fields {
+		if f.name == "__typename" {
+			result.set(f.alias, obj.typename())
+			continue
+		}
+		if err := gqlCheckArgs(obj.typename(), f); err != nil {
+			return nil, err
+		}
+		value, err := obj.resolve(f.name, f.args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.name, err)
+		}
+		completed, err := gqlComplete(value, f)
+		if err != nil {
+			return nil, err
+		}
+		result.set(f.alias, completed)
+	}
+	return result, nil
+}
+
+func gqlComplete(value any, f gqlField) (any, error) {
+	switch v := value.(type) {
+	case gqlObject:
+		if v == nil {
+			return nil, nil
+		}
+		if len(f.selections) == 0 {
+			return nil, fmt.Errorf("%s: field of type %s needs a selection", f.name, v.typename())
+		}
+		return gqlExecute(v, f.selections)
+	case []gqlObject:
+		list := make([]any, len(v))
+		for i, item := range v {
+			var err error
+			if list[i], err = gqlComplete(item, f); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	default:
+		if len(f.selections) > 0 {
+			return nil, fmt.Errorf("%s: scalar field has no selections", f.name)
+		}
+		return value, nil
+	}
+}
+
+func gqlString(args map[string]any, name string) string {
+	s, _ := args[name].(string)
+	return s
+}
+
+func gqlInt(args map[string]any, name string) int {
+	f, _ := args[name].(float64)
+	return int(f)
+}
+
+func gqlUnknownField(typename, field string) error {
+	return fmt.Errorf("unknown field %s on type %s", field, typename)
+}
+
+type gqlQuery struct{ db *sql.DB }
+
+func (q gqlQuery) typename() string { return "Query" }
+
+func (q gqlQuery) resolve(field string, args map[string]any) (any, error) {
+	switch field {
+	case "repositories":
+		return gqlRepositories(q.db, "")
+	case "repository":
+		repos, err := gqlRepositories(q.db, gqlString(args, "name"))
+		if err != nil || len(repos) == 0 {
+			return nil, err
+		}
+		return repos[0], nil
+	case "commits":
+		return gqlCommits(q.db, args)
+	case "components":
+		return gqlComponents(q.db, "")
+	case "component":
+		comps, err := gqlComponents(q.db, gqlString(args, "name"))
+		if err != nil || len(comps) == 0 {
+			return nil, err
+		}
+		return comps[0], nil
+	}
+	return nil, gqlUnknownField("Query", field)
+}
+
+type gqlRepository struct {
+	db   *sql.DB
+	name string
+	path string
+}
+
+func (r *gqlRepository) typename() string { return "Repository" }
+
+func (r *gqlRepository) resolve(field string, args map[string]any) (any, error) {
+	switch field {
+	case "name":
+		return r.name, nil
+	case "path":
+		return r.path, nil
+	case "commits":
+		withRepo := map[string]any{"repository": r.name}
+		for k, v := range args {
+			withRepo[k] = v
+		}
+		return gqlCommits(r.db, withRepo)
+	}
+	return nil, gqlUnknownField("Repository", field)
+}
+
+func gqlRepositories(db *sql.DB, name string) ([]gqlObject, error) {
+	rows, err := db.Query("SELECT name, path FROM repositories WHERE ? = '' OR name = ? ORDER BY name", name, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []gqlObject{}
+	for rows.Next() {
+		r := &gqlRepository{db: db}
+		if err := rows.Scan(&r.name, &r.path); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+type gqlCommit struct {
+	db         *sql.DB
+	hash       string
+	repository string
+	author     string
+	email      string
+	date       time.Time
+	message    string
+}
+
+func (c *gqlCommit) typename() string { return "Commit" }
+
+func (c *gqlCommit) resolve(field string, args map[string]any) (any, error) {
+	switch field {
+	case "hash":
+		return c.hash, nil
+	case "repository":
+		return c.repository, nil
+	case "author":
+		return c.author, nil
+	case "email":
+		return c.email, nil
+	case "date":
+		return c.date.Format(time.RFC3339), nil
+	case "message":
+		return c.message, nil
+	case "fileChanges":
+		return gqlFileChanges(c.db, c.hash)
+	}
+	return nil, gqlUnknownField("Commit", field)
+}
+
+func gqlCommits(db *sql.DB, args map[string]any) ([]gqlObject, error) {
+	commits, err := loadCommits(db, commitFilter{
+		Repository: gqlString(args, "repository"),
+		Author:     gqlString(args, "author"),
+		Since:      gqlString(args, "since"),
+		Until:      gqlString(args, "until"),
+		Limit:      gqlInt(args, "limit"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	list := make([]gqlObject, len(commits))
+	for i, c := range commits {
+		list[i] = &gqlCommit{db, c.Hash, c.Repository, c.Author, c.Email, c.Date, c.Message}
+	}
+	return list, nil
+}
+
+// gqlFileChange has null line counts for binary files.
+type gqlFileChange struct {
+	filepath   string
+	additions  *int
+	deletions  *int
+	changeType string
+}
+
+func (f *gqlFileChange) typename() string { return "FileChange" }
+
+func (f *gqlFileChange) resolve(field string, args map[string]any) (any, error) {
+	switch field {
+	case "filepath":
+		return f.filepath, nil
+	case "additions":
+		if f.additions == nil {
+			return nil, nil
+		}
+		return *f.additions, nil
+	case "deletions":
+		if f.deletions == nil {
+			return nil, nil
+		}
+		return *f.deletions, nil
+	case "changeType":
+		return f.changeType, nil
+	case "binary":
+		return f.additions == nil, nil
+	}
+	return nil, gqlUnknownField("FileChange", field)
+}
+
+func gqlFileChanges(db *sql.DB, hash string) ([]gqlObject, error) {
+	rows, err := db.Query("SELECT filepath, additions, deletions, change_type FROM file_changes WHERE commit_hash = ? ORDER BY id", hash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []gqlObject{}
+	for rows.Next() {
+		f := &gqlFileChange{}
+		if err := rows.Scan(&f.filepath, &f.additions, &f.deletions, &f.changeType); err != nil {
+			return nil, err
+		}
+		list = append(list, f)
+	}
+	return list, rows.Err()
+}
+
+type gqlComponent struct {
+	db       *sql.DB
+	id       int
+	name     string
+	patterns []string
+}
+
+func (c *gqlComponent) typename() string { return "Component" }
+
+func (c *gqlComponent) resolve(field string, args map[string]any) (any, error) {
+	switch field {
+	case "name":
+		return c.name, nil
+	case "pathPatterns":
+		return c.patterns, nil
+	case "contributions":
+		return gqlContributions(c.db, c.id, gqlString(args, "repository"), gqlString(args, "author"))
+	}
+	return nil, gqlUnknownField("Component", field)
+}
+
+func gqlComponents(db *sql.DB, name string) ([]gqlObject, error) {
+	rows, err := db.Query("SELECT id, name, path_patterns FROM components WHERE ? = '' OR name = ? ORDER BY name", name, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []gqlObject{}
+	for rows.Next() {
+		c := &gqlComponent{db: db}
+		var patterns string
+		if err := rows.Scan(&c.id, &c.name, &patterns); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(patterns), &c.patterns); err != nil {
+			return nil, err
+		}
+		list = append(list, c)
+	}
+	return list, rows.Err()
+}
+
+type gqlContribution struct {
+	repository     string
+	author         string
+	email          string
+	commitCount    int
+	totalAdditions int
+	totalDeletions int
+}
+
+func (c *gqlContribution) typename() string { return "Contribution" }
+
+func (c *gqlContribution) resolve(field string, args map[string]any) (any, error) {
+	switch field {
+	case "repository":
+		return c.repository, nil
+	case "author":
+		return c.author, nil
+	case "email":
+		return c.email, nil
+	case "commitCount":
+		return c.commitCount, nil
+	case "totalAdditions":
+		return c.totalAdditions, nil
+	case "totalDeletions":
+		return c.totalDeletions, nil
+	}
+	return nil, gqlUnknownField("Contribution", field)
+}
+
+func gqlContributions(db *sql.DB, componentID int, repo, email string) ([]gqlObject, error) {
+	rows, err := db.Query(`
+		SELECT r.name, cc.author, cc.email, cc.commit_count, cc.total_additions, cc.total_deletions
+		FROM component_contributions cc
+		JOIN repositories r ON r.id = cc.repository_id
+		WHERE cc.component_id = ? AND (? = '' OR r.name = ?) AND (? = '' OR cc.email = ?)
+		ORDER BY cc.commit_count DESC, cc.email
+	`, componentID, repo, repo, email, email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []gqlObject{}
+	for rows.Next() {
+		c := &gqlContribution{}
+		if err := rows.Scan(&c.repository, &c.author, &c.email, &c.commitCount, &c.totalAdditions, &c.totalDeletions); err != nil {
+			return nil, err
+		}
+		list = append(list, c)
+	}
+	return list, rows.Err()
+}
+
+type gqlRequest struct {
+	Query     string         `json:"query"`
+	Variables map[string]any `json:"variables"`
+}
+
+// graphqlHandler serves queries sent as POST JSON bodies or as the query
+// GET parameter. GET without a query returns the schema.
+func graphqlHandler(db *sql.DB) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req gqlRequest
+		switch r.Method {
+		case http.MethodGet:
+			req.Query = r.URL.Query().Get("query")
+			if req.Query == "" {
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				fmt.Fprint(w, graphqlSchema)
+				return
+			}
+			if vars := r.URL.Query().Get("variables"); vars != "" {
+				if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+					gqlErrors(w, http.StatusBadRequest, fmt.Errorf("invalid variables: %v", err))
+					return
+				}
+			}
+		case http.MethodPost:
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				gqlErrors(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+				return
+			}
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		p := &gqlParser{src: req.Query, vars: req.Variables}
+		fields, err := p.document()
+		if err != nil {
+			gqlErrors(w, http.StatusOK, err)
+			return
+		}
+		data, err := gqlExecute(gqlQuery{db}, fields)
+		if err != nil {
+			gqlErrors(w, http.StatusOK, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"data": data})
+	})
+}
+
+// gqlErrors replies with a GraphQL error response.
+func gqlErrors(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"errors": []map[string]string{{"message": err.Error()}}})
+}
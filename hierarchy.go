@@ -0,0 +1,62 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"slices"
+)
+
+// componentAncestors returns the names of the ancestors of a component,
+// from its parent up, stopping before a cycle.
+func componentAncestors(components []Component, name string) []string {
+	parents := make(map[string]string)
+	for _, comp := range components {
+		parents[comp.Name] = comp.Parent
+	}
+	var ancestors []string
+	for parent := parents[name]; parent != "" && parent != name && !slices.Contains(ancestors, parent); parent = parents[parent] {
+		ancestors = append(ancestors, parent)
+	}
+	return ancestors
+}
+
+// rollUpComponents returns components with the path patterns of every
+// component added to those of its ancestors, so the contributions of
+// children are rolled up to their parents, a commit touching several
+// children counting once.
+func rollUpComponents(components []Component) []Component {
+	rolled := slices.Clone(components)
+	for _, comp := range components {
+		for _, ancestor := range componentAncestors(components, comp.Name) {
+			i := slices.IndexFunc(rolled, func(c Component) bool { return c.Name == ancestor })
+			if i < 0 {
+				continue
+			}
+			paths := slices.Clone(rolled[i].Paths)
+			for _, path := range comp.Paths {
+				if !slices.Contains(paths, path) {
+					paths = append(paths, path)
+				}
+			}
+			rolled[i].Paths = paths
+		}
+	}
+	return rolled
+}
+
+// setComponentParents sets the parent_id of the inserted components, once
+// all of them have an id.
+func setComponentParents(db *sql.DB, components []Component) error {
+	for _, comp := range components {
+		if comp.Parent == "" {
+			continue
+		}
+		_, err := db.Exec("UPDATE components SET parent_id = (SELECT id FROM components WHERE name = ?) WHERE name = ?", comp.Parent, comp.Name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"html/template"
+	"io"
+)
+
+var htmlTemplate = template.Must(template.New("report").Funcs(templateFuncs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>git-report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.6em; }
+h2 { font-size: 1.3em; margin-top: 2em; border-bottom: 1px solid #ccc; }
+h3 { font-size: 1.1em; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { padding: 0.3em 0.8em; border: 1px solid #ddd; text-align: left; }
+th { background: #f4f4f4; }
+td.num { text-align: right; }
+.chart { margin: 1em 0; }
+.add { color: #080; }
+.del { color: #b00; }
+footer { margin-top: 3em; font-size: 0.8em; color: #888; }
+</style>
+</head>
+<body>
+<h1>git-report</h1>
+
+<h2>Repositories</h2>
+<table>
+<tr><th>Name</th><th>Path</th><th>Commits</th><th>Authors</th><th>Additions</th><th>Deletions</th><th>First commit</th><th>Last commit</th></tr>
+{{- range .Repositories}}
+<tr><td>{{.Name}}</td><td>{{.Path}}</td><td class="num">{{.Commits}}</td><td class="num">{{.Authors}}</td><td class="num add">+{{.Additions}}</td><td class="num del">-{{.Deletions}}</td><td>{{date .FirstCommit}}</td><td>{{date .LastCommit}}</td></tr>
+{{- end}}
+</table>
+{{- range .Repositories}}
+{{- if .Activity}}
+
+<h3>{{.Name}}</h3>
+<div class="chart">{{commitsChart .Activity}}</div>
+<div class="chart">{{linesChart .Activity}}</div>
+{{- end}}
+{{- end}}
+
+<h2>Authors</h2>
+<table>
+<tr><th>Author</th><th>Email</th><th>Commits</th><th>Additions</th><th>Deletions</th></tr>
+{{- range .Authors}}
+<tr><td>{{.Author}}</td><td>{{.Email}}</td><td class="num">{{.Commits}}</td><td class="num add">+{{.Additions}}</td><td class="num del">-{{.Deletions}}</td></tr>
+{{- end}}
+</table>
+
+{{- if .Teams}}
+
+<h2>Teams</h2>
+<table>
+<tr><th>Team</th><th>Component</th><th>Commits</th><th>Contributors</th><th>Additions</th><th>Deletions</th></tr>
+{{- range .Teams}}
+<tr><td>{{.Team}}</td><td>{{.Component}}</td><td class="num">{{.Commits}}</td><td class="num">{{.Contributors}}</td><td class="num add">+{{.Additions}}</td><td class="num del">-{{.Deletions}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+
+{{- if .CommitTypes}}
+
+<h2>Commit types</h2>
+<table>
+<tr><th>Type</th><th>Commits</th><th>Breaking</th><th>Additions</th><th>Deletions</th></tr>
+{{- range .CommitTypes}}
+<tr><td>{{.Type}}</td><td class="num">{{.Commits}}</td><td class="num">{{.Breaking}}</td><td class="num add">+{{.Additions}}</td><td class="num del">-{{.Deletions}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+
+{{- if .Components}}
+
+<h2>Components</h2>
+<table>
+<tr><th>Component</th><th>Commits</th><th>Contributors</th><th>Additions</th><th>Deletions</th></tr>
+{{- range .Components}}
+<tr><td>{{.Name}}</td><td class="num">{{.Commits}}</td><td class="num">{{len .Contributors}}</td><td class="num add">+{{.Additions}}</td><td class="num del">-{{.Deletions}}</td></tr>
+{{- end}}
+</table>
+{{- range .Components}}
+{{- if .Contributors}}
+
+<h3>{{.Name}}</h3>
+{{- if .Activity}}
+<div class="chart">{{commitsChart .Activity}}</div>
+<div class="chart">{{linesChart .Activity}}</div>
+{{- end}}
+<table>
+<tr><th>Author</th><th>Email</th><th>Commits</th><th>Additions</th><th>Deletions</th></tr>
+{{- range .Contributors}}
+<tr><td>{{.Author}}</td><td>{{.Email}}</td><td class="num">{{.Commits}}</td><td class="num add">+{{.Additions}}</td><td class="num del">-{{.Deletions}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- end}}
+{{- end}}
+
+<footer>Generated {{date .GeneratedAt}}</footer>
+</body>
+</html>
+`))
+
+func renderHTMLReport(db *sql.DB, w io.Writer) error {
+	report, err := loadReport(db)
+	if err != nil {
+		return err
+	}
+	return htmlTemplate.Execute(w, report)
+}
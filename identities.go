@@ -0,0 +1,67 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Identity is a person known under several emails or names, e.g. personal
+// and work ones, credited as one contributor.
+type Identity struct {
+	Name  string `yaml:"name" json:"name"`
+	Email string `yaml:"email" json:"email"`
+	// Aliases are the other emails, those containing @, and names of the
+	// person.
+	Aliases []string `yaml:"aliases" json:"aliases,omitempty"`
+}
+
+// identitiesKey encodes identities for contributionOptions, empty when there
+// are none.
+func identitiesKey(identities []Identity) string {
+	if len(identities) == 0 {
+		return ""
+	}
+	encoded, _ := json.Marshal(identities)
+	return string(encoded)
+}
+
+// identityResolver returns a function mapping an author to the canonical
+// name and email of their identity, emails matched case-insensitively before
+// names; authors of no identity are returned unchanged. key is an
+// identitiesKey.
+func identityResolver(key string) (func(author, email string) (string, string), error) {
+	var identities []Identity
+	if key != "" {
+		if err := json.Unmarshal([]byte(key), &identities); err != nil {
+			return nil, err
+		}
+	}
+	emails := make(map[string]int)
+	names := make(map[string]int)
+	for i, identity := range identities {
+		emails[strings.ToLower(identity.Email)] = i
+		for _, alias := range identity.Aliases {
+			if strings.Contains(alias, "@") {
+				emails[strings.ToLower(alias)] = i
+			} else {
+				names[alias] = i
+			}
+		}
+	}
+	return func(author, email string) (string, string) {
+		i, ok := emails[strings.ToLower(email)]
+		if !ok {
+			if i, ok = names[author]; !ok {
+				return author, email
+			}
+		}
+		identity := identities[i]
+		if identity.Name != "" {
+			author = identity.Name
+		}
+		return author, identity.Email
+	}, nil
+}
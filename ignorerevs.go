@@ -0,0 +1,124 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// defaultIgnoreRevsFile is the file of a repository listing the commits
+// git blame is usually told to ignore, read unless the repository sets
+// ignore_revs_file.
+const defaultIgnoreRevsFile = ".git-blame-ignore-revs"
+
+// parseIgnoreRevs returns the revisions listed in a .git-blame-ignore-revs
+// style file: one per line, # starting a comment.
+func parseIgnoreRevs(data string) []string {
+	var revs []string
+	for line := range strings.Lines(data) {
+		line, _, _ = strings.Cut(line, "#")
+		if line = strings.TrimSpace(line); line != "" {
+			revs = append(revs, line)
+		}
+	}
+	return revs
+}
+
+// repositoryIgnoreRevs returns the revisions listed in the ignore revs file
+// of a repository, read from the revision ingested so bare clones have one
+// too. The default file may be missing.
+func repositoryIgnoreRevs(ctx context.Context, repo Repository, revision string) ([]string, error) {
+	path := repo.IgnoreRevsFile
+	if path == "" {
+		path = defaultIgnoreRevsFile
+	}
+	output, err := gitCommandContext(ctx, repo.Path, "show", revision+":"+path).Output()
+	if err != nil {
+		if repo.IgnoreRevsFile == "" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("git show %s failed: %v", path, err)
+	}
+	return parseIgnoreRevs(string(output)), nil
+}
+
+// resolveCommits returns the full hashes of the revisions naming commits of
+// a repository, e.g. abbreviated hashes; the others are skipped, as the
+// revisions of a shared file may belong to other repositories.
+func resolveCommits(ctx context.Context, repo Repository, revs []string) ([]string, error) {
+	if len(revs) == 0 {
+		return nil, nil
+	}
+	cmd := gitCommandContext(ctx, repo.Path, "cat-file", "--batch-check=%(objectname) %(objecttype)")
+	cmd.Stdin = strings.NewReader(strings.Join(revs, "\n") + "\n")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git cat-file failed: %v", err)
+	}
+	var hashes []string
+	for line := range strings.Lines(string(output)) {
+		// "<name> missing" for unknown revisions.
+		if hash, kind, _ := strings.Cut(strings.TrimSpace(line), " "); kind == "commit" {
+			hashes = append(hashes, hash)
+		}
+	}
+	return hashes, nil
+}
+
+// flagIgnoredCommits sets is_ignored on the commits of every repository
+// listed in its ignore revs file or in the ignore_revs_file of the
+// configuration, and clears it on the others, so edited files also apply
+// to commits ingested before. It reports whether the commits with a rowid
+// up to after, those already aggregated in component contributions,
+// changed.
+func (c *Config) flagIgnoredCommits(ctx context.Context, db *sql.DB, after int64) (bool, error) {
+	var shared []string
+	if c.IgnoreRevsFile != "" {
+		data, err := os.ReadFile(c.IgnoreRevsFile)
+		if err != nil {
+			return false, err
+		}
+		shared = parseIgnoreRevs(string(data))
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	var changed bool
+	err = withTempTable(tx, "ignored_commits", "hash TEXT PRIMARY KEY", func() error {
+		for _, repo := range c.Repositories {
+			revs, err := repositoryIgnoreRevs(ctx, repo, c.Filters.revision())
+			if err != nil {
+				return fmt.Errorf("%s: %v", repo.Name, err)
+			}
+			hashes, err := resolveCommits(ctx, repo, append(revs, shared...))
+			if err != nil {
+				return fmt.Errorf("%s: %v", repo.Name, err)
+			}
+			for _, hash := range hashes {
+				if _, err := tx.Exec("INSERT OR IGNORE INTO temp.ignored_commits (hash) VALUES (?)", hash); err != nil {
+					return err
+				}
+			}
+		}
+
+		const ignored = "(hash IN (SELECT hash FROM temp.ignored_commits))"
+		err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM commits WHERE rowid <= ? AND is_ignored != "+ignored+")", after).Scan(&changed)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE commits SET is_ignored = " + ignored + " WHERE is_ignored != " + ignored)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return changed, tx.Commit()
+}
@@ -0,0 +1,515 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ingestBatch is the number of commits inserted per transaction. The last
+// commit of each batch is recorded as the checkpoint a failed or interrupted
+// run resumes from.
+const ingestBatch = 1000
+
+// ingestPlan tells how a repository is ingested.
+type ingestPlan struct {
+	// skip is set for repositories completely ingested by the run being
+	// resumed.
+	skip bool
+	// resume is set to only ingest revisions, the commits after the
+	// checkpoint of the run being resumed.
+	resume    bool
+	revisions []string
+	// tip is the commit the branch points to, resolved once so commits
+	// added while ingesting are left for the next run. base is the tip
+	// ingested by a previous run when it is an ancestor of tip; only the
+	// commits since then are ingested.
+	tip  string
+	base string
+}
+
+// revisionRange returns the git log revision argument of the plan.
+func (p ingestPlan) revisionRange() string {
+	if p.base != "" {
+		return p.base + ".." + p.tip
+	}
+	return p.tip
+}
+
+// fingerprint identifies the filters a repository was ingested with, as a
+// checkpoint is only valid for the same ones.
+func (f Filters) fingerprint() string {
+	s := fmt.Sprintf("since=%s until=%s branch=%s authors=%s", f.Since, f.Until, f.Branch, strings.Join(f.Authors, ","))
+	// Filters added later only appear when set, so databases ingested
+	// before them can still be appended to.
+	if f.FirstParent {
+		s += " first_parent"
+	}
+	if f.NoMerges {
+		s += " no_merges"
+	}
+	if f.IgnoreWhitespace {
+		s += " ignore_whitespace"
+	}
+	if f.Merges != "" && f.Merges != "ignore" {
+		s += " merges=" + f.Merges
+	}
+	if len(f.Paths) > 0 {
+		s += " paths=" + strings.Join(f.Paths, ",")
+	}
+	if len(f.ExcludePaths) > 0 {
+		s += " exclude_paths=" + strings.Join(f.ExcludePaths, ",")
+	}
+	if f.ExcludeDefaults {
+		s += " exclude_defaults"
+	}
+	if len(f.ExcludeAuthors) > 0 {
+		s += " exclude_authors=" + strings.Join(f.ExcludeAuthors, ",")
+	}
+	if f.MaxCommits > 0 {
+		s += fmt.Sprintf(" max_commits=%d", f.MaxCommits)
+	}
+	if f.Expr != "" {
+		s += " expr=" + f.Expr
+	}
+	return s
+}
+
+// authorExcluder returns a function reporting whether the commits of an
+// author are left out by filters.exclude_authors. Like git log --author,
+// the patterns are matched against "Name <email>".
+func (f Filters) authorExcluder() (func(author, email string) bool, error) {
+	var patterns []*regexp.Regexp
+	for _, pattern := range f.ExcludeAuthors {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude_authors pattern %q: %v", pattern, err)
+		}
+		patterns = append(patterns, re)
+	}
+	return func(author, email string) bool {
+		ident := author + " <" + email + ">"
+		return slices.ContainsFunc(patterns, func(re *regexp.Regexp) bool { return re.MatchString(ident) })
+	}, nil
+}
+
+// commitExpr returns the compiled filters.expr, nil without one.
+func (f Filters) commitExpr() (*commitExpr, error) {
+	if f.Expr == "" {
+		return nil, nil
+	}
+	expr, err := compileExpr(f.Expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expr %q: %v", f.Expr, err)
+	}
+	return expr, nil
+}
+
+// revision returns the branch to ingest.
+func (f Filters) revision() string {
+	if f.Branch == "" {
+		return "HEAD"
+	}
+	return f.Branch
+}
+
+// hasIncompleteIngest reports whether the database at path was left by a
+// failed or interrupted run with the same filters, so it can be resumed.
+func hasIncompleteIngest(path string, filters Filters) bool {
+	if _, err := os.Stat(path); err != nil {
+		return false
+	}
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return false
+	}
+	defer db.Close()
+	var n int
+	err = db.QueryRow("SELECT COUNT(*) FROM ingest_state WHERE NOT complete AND filters = ?", filters.fingerprint()).Scan(&n)
+	return err == nil && n > 0
+}
+
+// planIngest decides how to ingest a repository from the state recorded by
+// previous runs. Complete repositories are only skipped when skipComplete
+// is set, i.e. when resuming rather than appending.
+func planIngest(ctx context.Context, db *sql.DB, repo Repository, repoID int, filters Filters, skipComplete bool) (ingestPlan, error) {
+	var lastCommit, stateFilters string
+	var complete bool
+	err := db.QueryRow("SELECT last_commit, complete, filters FROM ingest_state WHERE repository_id = ?", repoID).
+		Scan(&lastCommit, &complete, &stateFilters)
+	switch {
+	case err == sql.ErrNoRows || (err == nil && stateFilters != filters.fingerprint()):
+		lastCommit, complete = "", true
+	case err != nil:
+		return ingestPlan{}, err
+	case complete && skipComplete:
+		return ingestPlan{skip: true}, nil
+	}
+
+	var plan ingestPlan
+	output, err := gitCommandContext(ctx, repo.Path, "rev-parse", "--verify", filters.revision()+"^{commit}").Output()
+	if err != nil {
+		return plan, fmt.Errorf("git rev-parse %s failed: %v", filters.revision(), err)
+	}
+	plan.tip = strings.TrimSpace(string(output))
+
+	if !complete && lastCommit != "" {
+		args := append([]string{"rev-list"}, gitFilterArgs(filters)...)
+		args = append(append(args, plan.tip), pathspecArgs(filters)...)
+		output, err := gitCommandContext(ctx, repo.Path, args...).Output()
+		if err != nil {
+			return plan, fmt.Errorf("git rev-list failed: %v", err)
+		}
+		revisions := strings.Fields(string(output))
+		if i := slices.Index(revisions, lastCommit); i >= 0 {
+			plan.resume, plan.revisions = true, revisions[i+1:]
+			return plan, nil
+		}
+		slog.Warn("Checkpoint not found, ingesting the whole repository", "repo", repo.Name, "commit", lastCommit)
+		return plan, nil
+	}
+
+	var base string
+	err = db.QueryRow(
+		"SELECT tip FROM repository_tips WHERE repository_id = ? AND branch = ? AND filters = ?",
+		repoID, filters.revision(), filters.fingerprint(),
+	).Scan(&base)
+	if err == sql.ErrNoRows {
+		return plan, nil
+	}
+	if err != nil {
+		return plan, err
+	}
+	// A base no longer in the history (e.g. after a force push) ingests
+	// the whole repository, skipping the commits already present.
+	if gitCommandContext(ctx, repo.Path, "merge-base", "--is-ancestor", base, plan.tip).Run() == nil {
+		plan.base = base
+	} else if ctx.Err() == nil {
+		slog.Warn("Previous tip not found, ingesting the whole repository", "repo", repo.Name, "commit", base)
+	}
+	return plan, nil
+}
+
+// loadCoAuthors returns the co-authors of the commits inserted after the
+// given rowid, by commit hash.
+func loadCoAuthors(db *sql.DB, after int64) (map[string][]CoAuthor, error) {
+	rows, err := db.Query(`
+		SELECT ca.commit_hash, ca.author, ca.email, ca.is_bot
+		FROM commit_coauthors ca
+		JOIN commits c ON c.hash = ca.commit_hash
+		WHERE c.rowid > ?
+	`, after)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	coAuthors := make(map[string][]CoAuthor)
+	for rows.Next() {
+		var hash string
+		var coAuthor CoAuthor
+		if err := rows.Scan(&hash, &coAuthor.Author, &coAuthor.Email, &coAuthor.isBot); err != nil {
+			return nil, err
+		}
+		coAuthors[hash] = append(coAuthors[hash], coAuthor)
+	}
+	return coAuthors, rows.Err()
+}
+
+// componentsUnchanged reports whether the database has the same components,
+// with the same patterns and filters, so their contributions can be updated
+// instead of recomputed.
+func componentsUnchanged(db *sql.DB, components []Component) (bool, error) {
+	rows, err := db.Query(`
+		SELECT c.name, c.path_patterns, c.filters, c.follow, c.case_insensitive, COALESCE(p.name, ''),
+			c.weight, c.path_weights, c.is_language
+		FROM components c
+		LEFT JOIN components p ON p.id = c.parent_id
+		ORDER BY c.id
+	`)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	i := 0
+	for ; rows.Next(); i++ {
+		var name, patterns, filters, parent, weights string
+		var follow, caseInsensitive, language bool
+		var weight float64
+		if err := rows.Scan(&name, &patterns, &filters, &follow, &caseInsensitive, &parent, &weight, &weights, &language); err != nil {
+			return false, err
+		}
+		if i >= len(components) || components[i].Name != name || components[i].Follow != follow ||
+			components[i].CaseInsensitive != caseInsensitive || components[i].Parent != parent ||
+			components[i].weight() != weight || components[i].language != language {
+			return false, nil
+		}
+		if encoded, err := encodePathWeights(components[i].Weights); err != nil {
+			return false, err
+		} else if encoded != weights {
+			return false, nil
+		}
+		encoded, err := json.Marshal(components[i].Paths)
+		if err != nil {
+			return false, err
+		}
+		if string(encoded) != patterns {
+			return false, nil
+		}
+		if encoded, err := components[i].Filters.encode(); err != nil {
+			return false, err
+		} else if encoded != filters {
+			return false, nil
+		}
+	}
+	return i == len(components), rows.Err()
+}
+
+// contributionOptions tells which commits, or which of their lines, are
+// left out of component contributions.
+type contributionOptions struct {
+	excludeBots bool
+	// outlierLines, when set, leaves the lines of outlier commits out; it
+	// is the threshold they were flagged with, see flagOutliers.
+	outlierLines int
+	// excludeGenerated leaves the file changes to generated and vendored
+	// files out, see flagGeneratedFiles.
+	excludeGenerated bool
+	// identities is the identitiesKey of the identities authors are
+	// credited as.
+	identities string
+	// overlaps is the overlaps mode, empty for "double-count".
+	overlaps string
+}
+
+// overlapMode returns the overlaps mode of the options.
+func (o contributionOptions) overlapMode() string {
+	if o.overlaps == "" {
+		return overlapModes[0]
+	}
+	return o.overlaps
+}
+
+// contributionOptions returns the options component contributions are
+// computed with.
+func (c *Config) contributionOptions() contributionOptions {
+	opts := contributionOptions{
+		excludeBots:      c.Bots.Exclude,
+		excludeGenerated: c.Linguist.Exclude,
+		identities:       identitiesKey(c.Identities),
+	}
+	if c.Overlaps != overlapModes[0] {
+		opts.overlaps = c.Overlaps
+	}
+	if c.Outliers.Exclude {
+		opts.outlierLines = c.Outliers.Lines
+	}
+	return opts
+}
+
+// contributionsComputed returns the greatest commit rowid when component
+// contributions were last computed, 0 if never, and the options used then.
+// Commits inserted since then have a greater rowid.
+func contributionsComputed(db *sql.DB) (int64, contributionOptions, error) {
+	var rowid int64
+	var opts contributionOptions
+	err := db.QueryRow(`
+		SELECT last_commit_rowid, exclude_bots, outlier_lines, exclude_generated, identities, overlaps
+		FROM contribution_state WHERE id = 1
+	`).Scan(&rowid, &opts.excludeBots, &opts.outlierLines, &opts.excludeGenerated, &opts.identities, &opts.overlaps)
+	if err == sql.ErrNoRows {
+		return 0, opts, nil
+	}
+	return rowid, opts, err
+}
+
+// flagOutliers sets is_outlier on the commits changing more than lines
+// lines, or on none when 0. Like the threshold, it applies to every commit,
+// those ingested before included.
+func flagOutliers(db *sql.DB, lines int) error {
+	_, err := db.Exec(`
+		UPDATE commits SET is_outlier = (? > 0 AND total_additions + total_deletions > ?)
+		WHERE is_outlier != (? > 0 AND total_additions + total_deletions > ?)
+	`, lines, lines, lines, lines)
+	return err
+}
+
+// withTempTable creates the temporary table name with columns in tx, runs
+// fn to fill and use it as temp.name, and drops it. Temporary tables belong
+// to the connection, that of the transaction, so fn must go through tx.
+func withTempTable(tx *sql.Tx, name, columns string, fn func() error) error {
+	if _, err := tx.Exec("CREATE TEMP TABLE " + name + " (" + columns + ")"); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	_, err := tx.Exec("DROP TABLE temp." + name)
+	return err
+}
+
+// startIngest records that a repository is being ingested, keeping its
+// checkpoint when resuming.
+func startIngest(db *sql.DB, repoID int, filters Filters, resume bool) error {
+	_, err := db.Exec(`
+		INSERT INTO ingest_state (repository_id, last_commit, complete, filters) VALUES (?, '', 0, ?)
+		ON CONFLICT (repository_id) DO UPDATE SET
+			complete = 0,
+			filters = excluded.filters,
+			last_commit = CASE WHEN ? THEN last_commit ELSE '' END
+	`, repoID, filters.fingerprint(), resume)
+	return err
+}
+
+// finishIngest marks a repository complete and records its tip, for the
+// next run to only ingest the commits since then.
+func finishIngest(db *sql.DB, repoID int, filters Filters, tip string) error {
+	if _, err := db.Exec("UPDATE ingest_state SET complete = 1 WHERE repository_id = ?", repoID); err != nil {
+		return err
+	}
+	_, err := db.Exec(`
+		INSERT INTO repository_tips (repository_id, branch, tip, filters, updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (repository_id, branch) DO UPDATE SET
+			tip = excluded.tip,
+			filters = excluded.filters,
+			updated_at = excluded.updated_at
+	`, repoID, filters.revision(), tip, filters.fingerprint(), time.Now())
+	return err
+}
+
+// logBatch inserts parsed commits in transactions of ingestBatch commits.
+type logBatch struct {
+	ctx    context.Context
+	db     *sql.DB
+	repoID int
+
+	tx           *sql.Tx
+	commitStmt   *sql.Stmt
+	parentStmt   *sql.Stmt
+	coAuthorStmt *sql.Stmt
+	trailerStmt  *sql.Stmt
+	fileStmt     *sql.Stmt
+	statsStmt    *sql.Stmt
+	ownerStmt    *sql.Stmt
+	// commits counts the commits seen in the current transaction, last is
+	// the hash of the last one.
+	commits int
+	last    string
+}
+
+func (b *logBatch) begin() error {
+	tx, err := b.db.BeginTx(b.ctx, nil)
+	if err != nil {
+		return err
+	}
+	b.tx = tx
+	b.commits = 0
+	b.commitStmt, err = tx.Prepare(`INSERT OR IGNORE INTO commits (hash, repository_id, author, email, date, message, is_merge, signature_status, signer, signing_key)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	b.parentStmt, err = tx.Prepare("INSERT OR IGNORE INTO commit_parents (commit_hash, parent_hash, position) VALUES (?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	b.coAuthorStmt, err = tx.Prepare("INSERT OR IGNORE INTO commit_coauthors (commit_hash, author, email) VALUES (?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	b.trailerStmt, err = tx.Prepare("INSERT OR IGNORE INTO commit_trailers (commit_hash, position, key, value) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	b.fileStmt, err = tx.Prepare(`INSERT INTO file_changes (commit_hash, filepath, additions, deletions, change_type, old_path, binary, old_mode, new_mode)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	b.statsStmt, err = tx.Prepare("UPDATE commits SET files_changed = ?, total_additions = ?, total_deletions = ? WHERE hash = ?")
+	if err != nil {
+		return err
+	}
+	b.ownerStmt, err = tx.Prepare(`SELECT c.repository_id, r.name FROM commits c
+		JOIN repositories r ON r.id = c.repository_id WHERE c.hash = ?`)
+	return err
+}
+
+// ingested checks that the commit hash, already in the database, was
+// ingested from the repository of the batch. Commits are keyed by hash
+// alone, so one shared with another repository, such as a fork or a
+// mirror, would otherwise be silently left out of this one.
+func (b *logBatch) ingested(hash string) error {
+	var repoID int
+	var repoName string
+	if err := b.ownerStmt.QueryRow(hash).Scan(&repoID, &repoName); err != nil {
+		return err
+	}
+	if repoID != b.repoID {
+		return fmt.Errorf("commit %s was already ingested from repository %q, repositories sharing history are not supported", hash, repoName)
+	}
+	return nil
+}
+
+// finish records the totals of the file changes of c, known once all of
+// them were read, or removes c when it does not match expr, if any. It
+// reports whether c was removed.
+func (b *logBatch) finish(c *Commit, expr *commitExpr) (bool, error) {
+	if c == nil {
+		return false, nil
+	}
+	if expr != nil {
+		ok, err := expr.match(c)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			for _, table := range []string{"file_changes", "commit_parents", "commit_trailers", "commit_coauthors"} {
+				if _, err := b.tx.Exec("DELETE FROM "+table+" WHERE commit_hash = ?", c.Hash); err != nil {
+					return false, err
+				}
+			}
+			_, err := b.tx.Exec("DELETE FROM commits WHERE hash = ?", c.Hash)
+			return true, err
+		}
+	}
+	if c.FilesChanged == 0 {
+		return false, nil
+	}
+	_, err := b.statsStmt.Exec(c.FilesChanged, c.Additions, c.Deletions, c.Hash)
+	return false, err
+}
+
+// commit commits the current transaction, recording the last commit seen as
+// the checkpoint.
+func (b *logBatch) commit() error {
+	if b.last != "" {
+		if _, err := b.tx.Exec("UPDATE ingest_state SET last_commit = ? WHERE repository_id = ?", b.last, b.repoID); err != nil {
+			return err
+		}
+	}
+	return b.tx.Commit()
+}
+
+// checkpoint commits the current transaction and begins the next one.
+func (b *logBatch) checkpoint() error {
+	if err := b.commit(); err != nil {
+		return err
+	}
+	return b.begin()
+}
+
+func (b *logBatch) rollback() {
+	if b.tx != nil {
+		b.tx.Rollback()
+	}
+}
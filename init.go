@@ -0,0 +1,184 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// starterConfig is the subset of Config written by init.
+type starterConfig struct {
+	Output       string       `yaml:"output"`
+	Repositories []Repository `yaml:"repositories"`
+	Components   []Component  `yaml:"components,omitempty"`
+}
+
+// componentSkipDirs are top-level directories not proposed as components.
+var componentSkipDirs = []string{"vendor", "node_modules", "third_party"}
+
+func initCommand(args []string) {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	dir := fs.String("dir", ".", "directory to scan for git repositories")
+	depth := fs.Int("depth", 2, "maximum directory depth to scan, -1 for unlimited")
+	output := fs.String("o", "report.yaml", "configuration file to write")
+	yes := fs.Bool("y", false, "accept every proposal without asking")
+	force := fs.Bool("force", false, "overwrite an existing configuration file")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s init [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if _, err := os.Stat(*output); err == nil && !*force {
+		log.Fatalf("Configuration file already exists: %s (use -force to overwrite)", *output)
+	}
+
+	paths, err := findRepositories(*dir, *depth)
+	if err != nil {
+		log.Fatalf("Failed to scan %s: %v", *dir, err)
+	}
+	if len(paths) == 0 {
+		log.Fatalf("No git repositories found in %s", *dir)
+	}
+
+	var in io.Reader = os.Stdin
+	if *yes {
+		in = strings.NewReader("")
+	}
+	w := &initWizard{in: bufio.NewScanner(in), out: os.Stdout, yes: *yes}
+	config, err := w.run(paths)
+	if err != nil {
+		log.Fatalf("Failed to build configuration: %v", err)
+	}
+
+	// Repository paths are resolved relative to the configuration file.
+	configDir, err := filepath.Abs(filepath.Dir(*output))
+	if err != nil {
+		log.Fatalf("Failed to write configuration: %v", err)
+	}
+	for i, repo := range config.Repositories {
+		if abs, err := filepath.Abs(repo.Path); err == nil {
+			if rel, err := filepath.Rel(configDir, abs); err == nil {
+				config.Repositories[i].Path = rel
+			}
+		}
+	}
+
+	f, err := os.Create(*output)
+	if err != nil {
+		log.Fatalf("Failed to write configuration: %v", err)
+	}
+	enc := yaml.NewEncoder(f)
+	enc.SetIndent(2)
+	if err := enc.Encode(config); err != nil {
+		f.Close()
+		log.Fatalf("Failed to write configuration: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatalf("Failed to write configuration: %v", err)
+	}
+	fmt.Printf("Wrote %s with %d repositories and %d components\n", *output, len(config.Repositories), len(config.Components))
+}
+
+type initWizard struct {
+	in  *bufio.Scanner
+	out io.Writer
+	// yes accepts every proposal without reading answers.
+	yes bool
+}
+
+// confirm asks a yes/no question, defaulting to yes.
+func (w *initWizard) confirm(format string, args ...any) bool {
+	if w.yes {
+		return true
+	}
+	fmt.Fprintf(w.out, format+" [Y/n] ", args...)
+	if !w.in.Scan() {
+		return true
+	}
+	answer := strings.ToLower(strings.TrimSpace(w.in.Text()))
+	return answer == "" || answer == "y" || answer == "yes"
+}
+
+// ask prompts for a value, returning def for an empty answer.
+func (w *initWizard) ask(prompt, def string) string {
+	if w.yes {
+		return def
+	}
+	fmt.Fprintf(w.out, "%s [%s] ", prompt, def)
+	if !w.in.Scan() {
+		return def
+	}
+	if answer := strings.TrimSpace(w.in.Text()); answer != "" {
+		return answer
+	}
+	return def
+}
+
+func (w *initWizard) run(paths []string) (*starterConfig, error) {
+	config := &starterConfig{}
+	config.Output = w.ask("Output database", "report.db")
+
+	taken := make(map[string]bool)
+	for _, path := range paths {
+		name := repositoryName(path, taken)
+		if !w.confirm("Include repository %s (%s)?", name, path) {
+			continue
+		}
+		config.Repositories = append(config.Repositories, Repository{Path: path, Name: name})
+	}
+	if len(config.Repositories) == 0 {
+		return nil, fmt.Errorf("no repositories selected")
+	}
+
+	for _, repo := range config.Repositories {
+		dirs, err := topLevelDirs(repo.Path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", repo.Name, err)
+		}
+		for _, dir := range dirs {
+			pattern := repo.Name + ":" + dir + "/**"
+			i := slices.IndexFunc(config.Components, func(c Component) bool { return c.Name == dir })
+			if i < 0 {
+				config.Components = append(config.Components, Component{Name: dir})
+				i = len(config.Components) - 1
+			}
+			config.Components[i].Paths = append(config.Components[i].Paths, pattern)
+		}
+	}
+	config.Components = slices.DeleteFunc(config.Components, func(c Component) bool {
+		return !w.confirm("Add component %s (%s)?", c.Name, strings.Join(c.Paths, ", "))
+	})
+	return config, nil
+}
+
+// topLevelDirs lists the directories tracked at the root of a repository.
+func topLevelDirs(repoPath string) ([]string, error) {
+	output, err := gitCommand(repoPath, "ls-tree", "-d", "--name-only", "HEAD").Output()
+	if err != nil {
+		// Repositories without commits have no HEAD yet.
+		return nil, nil
+	}
+	var dirs []string
+	for _, dir := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if dir == "" || strings.HasPrefix(dir, ".") || slices.Contains(componentSkipDirs, dir) {
+			continue
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs, nil
+}
@@ -0,0 +1,280 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+type jsonExport struct {
+	GeneratedAt  time.Time        `json:"generated_at"`
+	Repositories []jsonRepository `json:"repositories"`
+	Components   []jsonComponent  `json:"components"`
+	Teams        []jsonTeam       `json:"teams"`
+}
+
+type jsonRepository struct {
+	Name    string       `json:"name"`
+	Path    string       `json:"path"`
+	Commits []jsonCommit `json:"commits"`
+}
+
+type jsonCommit struct {
+	Hash        string           `json:"hash"`
+	Author      string           `json:"author"`
+	Email       string           `json:"email"`
+	Date        time.Time        `json:"date"`
+	Message     string           `json:"message"`
+	FileChanges []jsonFileChange `json:"file_changes"`
+}
+
+// jsonFileChange has null line counts for binary files.
+type jsonFileChange struct {
+	Filepath   string `json:"filepath"`
+	Additions  *int   `json:"additions"`
+	Deletions  *int   `json:"deletions"`
+	ChangeType string `json:"change_type"`
+	Binary     bool   `json:"binary,omitempty"`
+}
+
+type jsonComponent struct {
+	Name          string             `json:"name"`
+	Parent        string             `json:"parent,omitempty"`
+	PathPatterns  []string           `json:"path_patterns"`
+	Contributions []jsonContribution `json:"contributions"`
+}
+
+type jsonContribution struct {
+	Repository     string `json:"repository"`
+	Author         string `json:"author"`
+	Email          string `json:"email"`
+	CommitCount    int    `json:"commit_count"`
+	TotalAdditions int    `json:"total_additions"`
+	TotalDeletions int    `json:"total_deletions"`
+}
+
+type jsonTeam struct {
+	Name          string                 `json:"name"`
+	Members       []string               `json:"members"`
+	Contributions []jsonTeamContribution `json:"contributions"`
+}
+
+type jsonTeamContribution struct {
+	Component        string `json:"component"`
+	ContributorCount int    `json:"contributor_count"`
+	CommitCount      int    `json:"commit_count"`
+	TotalAdditions   int    `json:"total_additions"`
+	TotalDeletions   int    `json:"total_deletions"`
+}
+
+func renderJSONExport(db *sql.DB, w io.Writer) error {
+	export, err := loadJSONExport(db)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(export)
+}
+
+func loadJSONExport(db *sql.DB) (*jsonExport, error) {
+	export := &jsonExport{
+		GeneratedAt:  time.Now(),
+		Repositories: []jsonRepository{},
+		Components:   []jsonComponent{},
+	}
+
+	repoIndex := make(map[int]int)
+	rows, err := db.Query("SELECT id, name, path FROM repositories ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id int
+		repo := jsonRepository{Commits: []jsonCommit{}}
+		if err := rows.Scan(&id, &repo.Name, &repo.Path); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		repoIndex[id] = len(export.Repositories)
+		export.Repositories = append(export.Repositories, repo)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	type commitRef struct{ repo, commit int }
+	commitIndex := make(map[string]commitRef)
+	rows, err = db.Query("SELECT hash, repository_id, author, email, date, message FROM commits ORDER BY date DESC")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var repoID int
+		commit := jsonCommit{FileChanges: []jsonFileChange{}}
+		if err := rows.Scan(&commit.Hash, &repoID, &commit.Author, &commit.Email, &commit.Date, &commit.Message); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		i, ok := repoIndex[repoID]
+		if !ok {
+			continue
+		}
+		repo := &export.Repositories[i]
+		commitIndex[commit.Hash] = commitRef{i, len(repo.Commits)}
+		repo.Commits = append(repo.Commits, commit)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query("SELECT commit_hash, filepath, additions, deletions, change_type, additions IS NULL FROM file_changes ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var hash string
+		var fc jsonFileChange
+		if err := rows.Scan(&hash, &fc.Filepath, &fc.Additions, &fc.Deletions, &fc.ChangeType, &fc.Binary); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ref, ok := commitIndex[hash]
+		if !ok {
+			continue
+		}
+		commit := &export.Repositories[ref.repo].Commits[ref.commit]
+		commit.FileChanges = append(commit.FileChanges, fc)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	componentIndex := make(map[int]int)
+	rows, err = db.Query(`
+		SELECT c.id, c.name, COALESCE(p.name, ''), c.path_patterns
+		FROM components c
+		LEFT JOIN components p ON p.id = c.parent_id
+		ORDER BY c.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id int
+		var patterns string
+		comp := jsonComponent{Contributions: []jsonContribution{}}
+		if err := rows.Scan(&id, &comp.Name, &comp.Parent, &patterns); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(patterns), &comp.PathPatterns); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		componentIndex[id] = len(export.Components)
+		export.Components = append(export.Components, comp)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`
+		SELECT cc.component_id, r.name, cc.author, cc.email,
+			cc.commit_count, cc.total_additions, cc.total_deletions
+		FROM component_contributions cc
+		JOIN repositories r ON r.id = cc.repository_id
+		ORDER BY cc.commit_count DESC, cc.email
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var componentID int
+		var c jsonContribution
+		if err := rows.Scan(&componentID, &c.Repository, &c.Author, &c.Email,
+			&c.CommitCount, &c.TotalAdditions, &c.TotalDeletions); err != nil {
+			return nil, err
+		}
+		i, ok := componentIndex[componentID]
+		if !ok {
+			continue
+		}
+		export.Components[i].Contributions = append(export.Components[i].Contributions, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	teams, err := loadJSONTeams(db)
+	if err != nil {
+		return nil, err
+	}
+	export.Teams = teams
+	return export, nil
+}
+
+func loadJSONTeams(db *sql.DB) ([]jsonTeam, error) {
+	teams := []jsonTeam{}
+	teamIndex := make(map[int]int)
+	rows, err := db.Query("SELECT id, name, members FROM teams ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id int
+		var members string
+		team := jsonTeam{Contributions: []jsonTeamContribution{}}
+		if err := rows.Scan(&id, &team.Name, &members); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(members), &team.Members); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		teamIndex[id] = len(teams)
+		teams = append(teams, team)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`
+		SELECT tc.team_id, co.name, tc.contributor_count,
+			tc.commit_count, tc.total_additions, tc.total_deletions
+		FROM team_contributions tc
+		JOIN components co ON co.id = tc.component_id
+		ORDER BY tc.commit_count DESC, co.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var teamID int
+		var c jsonTeamContribution
+		if err := rows.Scan(&teamID, &c.Component, &c.ContributorCount,
+			&c.CommitCount, &c.TotalAdditions, &c.TotalDeletions); err != nil {
+			return nil, err
+		}
+		i, ok := teamIndex[teamID]
+		if !ok {
+			continue
+		}
+		teams[i].Contributions = append(teams[i].Contributions, c)
+	}
+	return teams, rows.Err()
+}
@@ -0,0 +1,126 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+)
+
+// language is a language component of auto_components.by_language and the
+// base name patterns of its files, mostly extensions.
+type language struct {
+	name     string
+	patterns []string
+}
+
+// languages are the known languages. Ambiguous files, such as .h ones, go
+// to the first language listing them.
+var languages = []language{
+	{"Go", []string{"*.go"}},
+	{"TypeScript", []string{"*.{ts,tsx,mts,cts}"}},
+	{"JavaScript", []string{"*.{js,jsx,mjs,cjs}"}},
+	{"Python", []string{"*.{py,pyi}"}},
+	{"Java", []string{"*.java"}},
+	{"Kotlin", []string{"*.{kt,kts}"}},
+	{"Scala", []string{"*.{scala,sc}"}},
+	{"C", []string{"*.{c,h}"}},
+	{"C++", []string{"*.{cc,cpp,cxx,hh,hpp,hxx}"}},
+	{"C#", []string{"*.cs"}},
+	{"Objective-C", []string{"*.{m,mm}"}},
+	{"Swift", []string{"*.swift"}},
+	{"Rust", []string{"*.rs"}},
+	{"Ruby", []string{"*.rb", "Gemfile", "Rakefile"}},
+	{"PHP", []string{"*.php"}},
+	{"Perl", []string{"*.{pl,pm}"}},
+	{"Lua", []string{"*.lua"}},
+	{"R", []string{"*.{r,R}"}},
+	{"Dart", []string{"*.dart"}},
+	{"Elixir", []string{"*.{ex,exs}"}},
+	{"Erlang", []string{"*.{erl,hrl}"}},
+	{"Haskell", []string{"*.hs"}},
+	{"Clojure", []string{"*.{clj,cljs,cljc}"}},
+	{"Shell", []string{"*.{sh,bash,zsh}"}},
+	{"PowerShell", []string{"*.{ps1,psm1}"}},
+	{"SQL", []string{"*.sql"}},
+	{"HTML", []string{"*.{html,htm}"}},
+	{"CSS", []string{"*.{css,scss,sass,less}"}},
+	{"Vue", []string{"*.vue"}},
+	{"Svelte", []string{"*.svelte"}},
+	{"Protocol Buffers", []string{"*.proto"}},
+	{"Terraform", []string{"*.{tf,tfvars}"}},
+	{"Dockerfile", []string{"Dockerfile", "*.dockerfile"}},
+	{"Makefile", []string{"Makefile", "*.mk"}},
+	{"Markdown", []string{"*.{md,markdown}"}},
+	{"YAML", []string{"*.{yaml,yml}"}},
+	{"JSON", []string{"*.json"}},
+	{"TOML", []string{"*.toml"}},
+	{"XML", []string{"*.xml"}},
+}
+
+// fileLanguage returns the index in languages of the language of a file,
+// -1 for an unknown one.
+func fileLanguage(file string) int {
+	name := path.Base(file)
+	return slices.IndexFunc(languages, func(l language) bool {
+		return slices.ContainsFunc(l.patterns, func(pattern string) bool { return matchPath(name, pattern) })
+	})
+}
+
+// repositoryFiles returns the files of a repository at revision.
+func repositoryFiles(repo Repository, revision string) ([]string, error) {
+	output, err := gitCommand(repo.Path, "ls-tree", "-r", "--name-only", revision).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git ls-tree failed: %v", err)
+	}
+	var files []string
+	for file := range strings.Lines(string(output)) {
+		files = append(files, strings.TrimSuffix(file, "\n"))
+	}
+	return files, nil
+}
+
+// addLanguageComponents adds a component per language of the files of the
+// repositories at the ingested revision, named after it, e.g. Go or SQL,
+// matching its files at any depth. Configured components with the same
+// name are kept as they are.
+func (c *Config) addLanguageComponents() error {
+	configured := make(map[string]bool)
+	for _, comp := range c.Components {
+		configured[comp.Name] = true
+	}
+	var generated []Component
+	for _, repo := range c.Repositories {
+		files, err := repositoryFiles(repo, c.Filters.revision())
+		if err != nil {
+			return fmt.Errorf("%s: %v", repo.Name, err)
+		}
+		found := make(map[int]bool)
+		for _, file := range files {
+			if l := fileLanguage(file); l >= 0 {
+				found[l] = true
+			}
+		}
+		// Languages keep the order of the table.
+		for l, lang := range languages {
+			if !found[l] || configured[lang.name] {
+				continue
+			}
+			i := slices.IndexFunc(generated, func(comp Component) bool { return comp.Name == lang.name })
+			if i < 0 {
+				generated = append(generated, Component{Name: lang.name, language: true})
+				i = len(generated) - 1
+			}
+			for _, pattern := range lang.patterns {
+				generated[i].Paths = append(generated[i].Paths, repo.Name+":**/"+pattern)
+			}
+		}
+	}
+	slog.Debug("Adding language components", "components", len(generated))
+	c.Components = append(c.Components, generated...)
+	return nil
+}
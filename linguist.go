@@ -0,0 +1,126 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// generatedPaths returns the paths with the linguist-generated or
+// linguist-vendored attribute in the .gitattributes files of a revision.
+// They are read through a temporary index, so bare clones, which have no
+// work tree, are checked like any other repository.
+func generatedPaths(ctx context.Context, repo Repository, revision string, paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	index, err := os.CreateTemp("", "git-report-index-")
+	if err != nil {
+		return nil, err
+	}
+	index.Close()
+	defer os.Remove(index.Name())
+	env := append(os.Environ(), "GIT_INDEX_FILE="+index.Name())
+
+	cmd := gitCommandContext(ctx, repo.Path, "read-tree", revision)
+	cmd.Env = env
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("git read-tree failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	cmd = gitCommandContext(ctx, repo.Path, "check-attr", "--cached", "--stdin", "-z", "linguist-generated", "linguist-vendored")
+	cmd.Env = env
+	cmd.Stdin = strings.NewReader(strings.Join(paths, "\x00") + "\x00")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git check-attr failed: %v", err)
+	}
+
+	// <path> NUL <attribute> NUL <value> NUL, for each attribute.
+	fields := strings.Split(string(output), "\x00")
+	var generated []string
+	for i := 0; i+2 < len(fields); i += 3 {
+		path, value := fields[i], fields[i+2]
+		if value != "set" && value != "true" {
+			continue
+		}
+		// Both attributes may be set.
+		if n := len(generated); n == 0 || generated[n-1] != path {
+			generated = append(generated, path)
+		}
+	}
+	return generated, nil
+}
+
+// flagGeneratedFiles sets generated on the file changes of every repository
+// to generated or vendored paths, according to the attributes of the
+// revision ingested, and clears it on the others. It reports whether the
+// file changes of commits with a rowid up to after, those already
+// aggregated in component contributions, changed.
+func (c *Config) flagGeneratedFiles(ctx context.Context, db *sql.DB, repoIDs map[string]int, after int64) (bool, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	var changed bool
+	err = withTempTable(tx, "generated_paths", "repository_id INTEGER, filepath TEXT, PRIMARY KEY (repository_id, filepath)", func() error {
+		for _, repo := range c.Repositories {
+			repoID := repoIDs[repo.Name]
+			rows, err := tx.Query(`
+				SELECT DISTINCT fc.filepath FROM file_changes fc
+				JOIN commits c ON c.hash = fc.commit_hash
+				WHERE c.repository_id = ?
+			`, repoID)
+			if err != nil {
+				return err
+			}
+			var paths []string
+			for rows.Next() {
+				var path string
+				if err := rows.Scan(&path); err != nil {
+					rows.Close()
+					return err
+				}
+				paths = append(paths, path)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return err
+			}
+
+			generated, err := generatedPaths(ctx, repo, c.Filters.revision(), paths)
+			if err != nil {
+				return fmt.Errorf("%s: %v", repo.Name, err)
+			}
+			for _, path := range generated {
+				if _, err := tx.Exec("INSERT OR IGNORE INTO temp.generated_paths (repository_id, filepath) VALUES (?, ?)", repoID, path); err != nil {
+					return err
+				}
+			}
+		}
+
+		const isGenerated = `EXISTS (SELECT 1 FROM temp.generated_paths g
+			JOIN commits c ON c.repository_id = g.repository_id
+			WHERE c.hash = file_changes.commit_hash AND g.filepath = file_changes.filepath)`
+		err := tx.QueryRow(`
+			SELECT EXISTS (
+				SELECT 1 FROM file_changes
+				JOIN commits c ON c.hash = file_changes.commit_hash
+				WHERE c.rowid <= ? AND file_changes.generated != `+isGenerated+`)
+		`, after).Scan(&changed)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE file_changes SET generated = " + isGenerated + " WHERE generated != " + isGenerated)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return changed, tx.Commit()
+}
@@ -0,0 +1,87 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+var logLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// logOptions holds the logging flags shared by the commands.
+type logOptions struct {
+	level   string
+	format  string
+	verbose bool
+	quiet   bool
+	// effective is the level set up from the flags.
+	effective slog.Level
+}
+
+func addLogFlags(fs *flag.FlagSet) *logOptions {
+	o := &logOptions{}
+	fs.StringVar(&o.level, "log-level", "warn", "log level: debug, info, warn or error")
+	fs.StringVar(&o.format, "log-format", "text", "log format: text or json")
+	fs.BoolVar(&o.verbose, "v", false, "verbose output, same as -log-level=info")
+	fs.BoolVar(&o.quiet, "quiet", false, "only log errors")
+	return o
+}
+
+// setup configures the default logger once the flags are parsed. Quiet wins
+// over the other flags, and -v only raises the default level.
+func (o *logOptions) setup() {
+	name := o.level
+	if o.verbose && name == "warn" {
+		name = "info"
+	}
+	if o.quiet {
+		name = "error"
+	}
+	level, ok := logLevels[name]
+	if !ok {
+		log.Fatalf("Unknown log level: %s", o.level)
+	}
+	o.effective = level
+	switch o.format {
+	case "text":
+		slog.SetLogLoggerLevel(level)
+	case "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+		// The log package now writes through the JSON handler; what is left
+		// using it are fatal errors.
+		slog.SetLogLoggerLevel(slog.LevelError)
+	default:
+		log.Fatalf("Unknown log format: %s", o.format)
+	}
+}
+
+// interactive reports whether the default text logs at warn level are
+// used, so a progress line is not mixed with other log lines.
+func (o *logOptions) interactive() bool {
+	return o.format == "text" && o.effective == slog.LevelWarn
+}
+
+// gitCommand prepares a git command run in dir, logging it at debug level.
+func gitCommand(dir string, args ...string) *exec.Cmd {
+	return gitCommandContext(context.Background(), dir, args...)
+}
+
+// gitCommandContext is like gitCommand, killing git when ctx is done.
+func gitCommandContext(ctx context.Context, dir string, args ...string) *exec.Cmd {
+	slog.Debug("Running git", "dir", dir, "args", strings.Join(args, " "))
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	return cmd
+}
@@ -5,32 +5,161 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"os"
-	"os/exec"
-	"path/filepath"
+	"os/signal"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
-	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Output       string       `yaml:"output"`
+	Outputs      Outputs      `yaml:"output"`
 	Repositories []Repository `yaml:"repositories"`
 	Filters      Filters      `yaml:"filters"`
-	Components   []Component  `yaml:"components"`
+	Components   []Component  `yaml:"-"`
+	// ComponentsKey is the components key as written, see
+	// applyComponentsKey.
+	ComponentsKey ComponentsKey `yaml:"components"`
+	Templates     []Template    `yaml:"templates"`
+	Changelog     Changelog     `yaml:"changelog"`
+	Email         Email         `yaml:"email"`
+	Webhook       Webhook       `yaml:"webhook"`
+	// Discover lists directories searched for repositories to add.
+	Discover []string           `yaml:"discover"`
+	Profiles map[string]Profile `yaml:"profiles"`
+	// Include lists configuration files merged before this one.
+	Include []string `yaml:"include"`
+	// CacheDir is where remote repositories are cloned.
+	CacheDir string        `yaml:"cache_dir"`
+	Ingest   IngestOptions `yaml:"ingest"`
+	Bots     BotOptions    `yaml:"bots"`
+	// Organization tells internal contributors apart from external ones.
+	Organization Organization `yaml:"organization"`
+	Outliers     Outliers     `yaml:"outliers"`
+	// IgnoreRevsFile lists commits, of any repository, left out of
+	// contributions, in addition to those of the repository files.
+	IgnoreRevsFile string   `yaml:"ignore_revs_file"`
+	Linguist       Linguist `yaml:"linguist"`
+	// Identities merge the emails and names of a person into one
+	// contributor.
+	Identities []Identity `yaml:"identities"`
+	// Teams roll up the contributions of their members.
+	Teams []Team `yaml:"teams"`
+	// Timezone is the IANA name of the timezone commits are bucketed into
+	// days, weeks and months by, or Local; UTC by default.
+	Timezone string   `yaml:"timezone"`
+	Calendar Calendar `yaml:"calendar"`
+	// Companies maps email domains, subdomains included, to the company
+	// contributions are attributed to; other domains are their own company.
+	Companies map[string]string `yaml:"companies"`
+	// CaseInsensitive matches the path patterns of every component ignoring
+	// case, see Component.CaseInsensitive.
+	CaseInsensitive bool           `yaml:"case_insensitive"`
+	AutoComponents  AutoComponents `yaml:"auto_components"`
+	// Overlaps tells how the lines of the file changes matching several
+	// components are credited, one of overlapModes; empty is
+	// "double-count", crediting them to every component.
+	Overlaps string `yaml:"overlaps"`
+	// BusFactor is the percentage of the commits, or owned lines, of a
+	// component its bus factor authors cover; 0 is
+	// defaultBusFactorThreshold.
+	BusFactor int `yaml:"bus_factor"`
+	// Weights scale the lines of the file changes matching them in the
+	// effort of every component, after the weights of the component.
+	Weights []PathWeight `yaml:"weights"`
+}
+
+// Linguist tells how the files marked linguist-generated or
+// linguist-vendored in .gitattributes are counted.
+type Linguist struct {
+	// Exclude leaves their file changes out of component contributions.
+	Exclude bool `yaml:"exclude"`
+}
+
+// Outliers flags the commits too large to be regular work, such as vendored
+// imports and formatting sweeps.
+type Outliers struct {
+	// Lines is the number of changed lines, additions plus deletions, a
+	// commit is an outlier above; 0 flags none.
+	Lines int `yaml:"lines"`
+	// Exclude leaves the lines of outliers out of component contributions,
+	// their commits still count.
+	Exclude bool `yaml:"exclude"`
+}
+
+// Organization describes the organization running the report.
+type Organization struct {
+	// Domains are the email domains of internal contributors, subdomains
+	// included, e.g. acme.com.
+	Domains []string `yaml:"domains"`
+}
+
+// BotOptions tells which authors are bots and how their commits are
+// credited.
+type BotOptions struct {
+	// Patterns are regular expressions matched against "Name <email>", in
+	// addition to defaultBotPatterns.
+	Patterns []string `yaml:"patterns"`
+	// Exclude leaves the commits of bots out of component contributions,
+	// instead of crediting them apart.
+	Exclude bool `yaml:"exclude"`
+}
+
+// IngestOptions selects the optional data read from git while ingesting.
+type IngestOptions struct {
+	// Signatures verifies commit signatures, which runs gpg or ssh-keygen
+	// for every signed commit.
+	Signatures bool `yaml:"signatures"`
+	// RenameThreshold is the similarity percentage, from 1 to 100, for a
+	// deleted and an added file to be a rename; 0 keeps the git default of
+	// 50.
+	RenameThreshold int `yaml:"rename_threshold"`
+	// PatchIDs computes the git patch-id of every commit, so cherry-picks
+	// are credited once.
+	PatchIDs bool `yaml:"patch_ids"`
+	// Blame runs git blame on every file at the ingested revision, for the
+	// lines each author currently owns.
+	Blame bool `yaml:"blame"`
+}
+
+// Profile is a named report variant overriding parts of the configuration.
+type Profile struct {
+	Outputs    Outputs     `yaml:"output"`
+	Filters    Filters     `yaml:"filters"`
+	Components []Component `yaml:"components"`
 }
 
 type Repository struct {
 	Path string `yaml:"path"`
 	Name string `yaml:"name"`
+	// Fetch updates the repository from its remotes before reading its
+	// history.
+	Fetch bool `yaml:"fetch"`
+	// Submodules also ingests the checked out submodules, as repositories
+	// of their own.
+	Submodules bool `yaml:"submodules"`
+	// IgnoreRevsFile is the file of the repository listing the commits
+	// left out of contributions, defaultIgnoreRevsFile when empty.
+	IgnoreRevsFile string `yaml:"ignore_revs_file"`
+
+	// url is the remote a repository was cloned from, its Path then being
+	// the clone.
+	url string
+	loc located
 }
 
 type Filters struct {
@@ -38,11 +167,65 @@ type Filters struct {
 	Until   string   `yaml:"until"`
 	Authors []string `yaml:"authors"`
 	Branch  string   `yaml:"branch"`
+	// FirstParent follows only the first parent of merge commits, i.e. the
+	// mainline history.
+	FirstParent bool `yaml:"first_parent"`
+	// NoMerges leaves merge commits out.
+	NoMerges bool `yaml:"no_merges"`
+	// IgnoreWhitespace leaves whitespace-only line changes, and blank
+	// lines, out of the line counts.
+	IgnoreWhitespace bool `yaml:"ignore_whitespace"`
+	// Merges tells how the file changes of merge commits are counted, one of
+	// mergeModes; empty is "ignore".
+	Merges string `yaml:"merges"`
+	// Paths and ExcludePaths are git pathspecs limiting the file changes,
+	// and the commits, read from git log, see pathspecArgs.
+	Paths        []string `yaml:"paths"`
+	ExcludePaths []string `yaml:"exclude_paths"`
+	// ExcludeDefaults also excludes defaultExcludePaths.
+	ExcludeDefaults bool `yaml:"exclude_defaults"`
+	// ExcludeAuthors are regular expressions matched against "Name
+	// <email>"; the commits of matching authors are not ingested.
+	ExcludeAuthors []string `yaml:"exclude_authors"`
+	// MaxCommits limits the commits read from each repository to the most
+	// recent ones; 0 reads them all.
+	MaxCommits int `yaml:"max_commits"`
+	// Expr is an expression over the fields of a commit, see expr.go; the
+	// commits it is false for are not ingested.
+	Expr string `yaml:"expr"`
+
+	loc located
 }
 
 type Component struct {
-	Name  string   `yaml:"name"`
+	Name string `yaml:"name"`
+	// Paths are patterns in [repo:]path form, those without a repository,
+	// or with *, applying to every repository.
 	Paths []string `yaml:"paths"`
+	// Filters limit the commits credited to the component.
+	Filters ComponentFilters `yaml:"filters,omitempty"`
+	// Follow traces the history of the paths naming single files across
+	// renames, with git log --follow, so their earlier names are credited
+	// too.
+	Follow bool `yaml:"follow,omitempty"`
+	// CaseInsensitive matches the path patterns ignoring case, for
+	// repositories developed on case-insensitive filesystems where the
+	// casing of paths drifts.
+	CaseInsensitive bool `yaml:"case_insensitive,omitempty"`
+	// Parent names the component the contributions of this one are rolled
+	// up to.
+	Parent string `yaml:"parent,omitempty"`
+	// Weight scales the lines credited to the component in its effort; 0
+	// is 1.
+	Weight float64 `yaml:"weight,omitempty"`
+	// Weights scale the lines of the file changes matching them, the
+	// first matching one applying.
+	Weights []PathWeight `yaml:"weights,omitempty"`
+
+	// language marks the components of auto_components.by_language, a
+	// breakdown apart from the others, see categorizer.
+	language bool
+	loc      located
 }
 
 type Commit struct {
@@ -52,6 +235,44 @@ type Commit struct {
 	Email        string
 	Date         time.Time
 	Message      string
+	Parents      []string
+	CoAuthors    []CoAuthor
+	Trailers     []Trailer
+	// SignatureStatus is the %G? verification status, empty when
+	// signatures are not verified; Signer and SigningKey identify the
+	// signature.
+	SignatureStatus string
+	Signer          string
+	SigningKey      string
+	// FilesChanged, Additions and Deletions total the file changes.
+	FilesChanged int
+	Additions    int64
+	Deletions    int64
+}
+
+// Trailer is a "Key: value" line of the trailer block ending a commit
+// message, such as Signed-off-by or Fixes.
+type Trailer struct {
+	Key   string
+	Value string
+}
+
+// CoAuthor is a person credited with a commit by a Co-authored-by trailer.
+type CoAuthor struct {
+	Author string
+	Email  string
+	// isBot is loaded from the database, see tagBots.
+	isBot bool
+}
+
+// parseCoAuthor parses a "Name <email>" trailer value.
+func parseCoAuthor(value string) (CoAuthor, bool) {
+	name, rest, ok := strings.Cut(value, "<")
+	email, _, closed := strings.Cut(rest, ">")
+	if !ok || !closed || strings.TrimSpace(email) == "" {
+		return CoAuthor{}, false
+	}
+	return CoAuthor{Author: strings.TrimSpace(name), Email: strings.TrimSpace(email)}, true
 }
 
 type FileChange struct {
@@ -63,46 +284,277 @@ type FileChange struct {
 }
 
 func main() {
-	configPath := flag.String("c", "report.yaml", "path to configuration file")
-	configFlag := flag.String("config", "", "path to configuration file")
-	verbose := flag.Bool("v", false, "verbose output")
-	verboseFlag := flag.Bool("verbose", false, "verbose output")
-	dryRun := flag.Bool("dry-run", false, "validate config without generating report")
-	flag.Parse()
+	args := os.Args[1:]
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") || isConfigFile(args[0]) {
+		// No subcommand: generate, as in earlier versions.
+		generateCommand(args)
+		return
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			cmd.run(args[1:])
+			return
+		}
+	}
+	if args[0] != "help" {
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n", args[0])
+	}
+	usage()
+	if args[0] != "help" {
+		os.Exit(2)
+	}
+}
 
-	if *configFlag != "" {
-		configPath = configFlag
+func generateCommand(args []string) {
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	var configPaths stringList
+	fs.Var(&configPaths, "c", "path to configuration file, repeatable (default report.yaml)")
+	fs.Var(&configPaths, "config", "path to configuration file, repeatable")
+	logOpts := addLogFlags(fs)
+	fs.BoolVar(&logOpts.verbose, "verbose", false, "same as -v")
+	htmlFlag := fs.Bool("html", false, "also render an HTML report")
+	markdownFlag := fs.Bool("markdown", false, "also render a Markdown report")
+	csvFlag := fs.Bool("csv", false, "also export tables as CSV files")
+	jsonFlag := fs.Bool("json", false, "also export the dataset as JSON")
+	pdfFlag := fs.Bool("pdf", false, "also render a PDF report")
+	xlsxFlag := fs.Bool("xlsx", false, "also export contributions as an Excel workbook")
+	sqlFlag := fs.Bool("sql", false, "also write a plain SQL dump")
+	siteFlag := fs.Bool("site", false, "also generate a static multi-page site")
+	badgesFlag := fs.Bool("badges", false, "also generate SVG badges")
+	digestFlag := fs.Bool("digest", false, "also write a weekly digest")
+	changelogRange := fs.String("changelog", "", "write a changelog for the given revision range in every repository")
+	noSummary := fs.Bool("no-summary", false, "do not print a summary after generating the report")
+	var appendMode bool
+	fs.BoolVar(&appendMode, "append", false, "add new commits to the existing database instead of rebuilding it")
+	fs.BoolVar(&appendMode, "update", false, "same as -append")
+	showProgress := fs.Bool("progress", false, "show progress with an estimated time remaining on stderr (default when stderr is a terminal)")
+	profile := fs.String("profile", "", "apply a profile from the configuration")
+	fetch := fs.Bool("fetch", false, "fetch every repository from its remotes before reading its history")
+	cacheDir := fs.String("cache-dir", "", "override cache_dir, where remote repositories are cloned")
+	discoverDir := fs.String("discover", "", "also add the git repositories found below this directory")
+	since := fs.String("since", "", "override filters.since")
+	until := fs.String("until", "", "override filters.until")
+	branch := fs.String("branch", "", "override filters.branch")
+	firstParent := fs.Bool("first-parent", false, "set filters.first_parent")
+	signatures := fs.Bool("signatures", false, "set ingest.signatures, verifying commit signatures")
+	patchIDs := fs.Bool("patch-ids", false, "set ingest.patch_ids, crediting cherry-picked commits once")
+	blame := fs.Bool("blame", false, "set ingest.blame, computing the lines each author owns")
+	excludeBots := fs.Bool("exclude-bots", false, "set bots.exclude, leaving bot commits out of contributions")
+	outlierLines := fs.Int("outlier-lines", 0, "override outliers.lines, the changed lines above which a commit is an outlier")
+	excludeOutliers := fs.Bool("exclude-outliers", false, "set outliers.exclude, leaving the lines of outliers out of contributions")
+	excludeGenerated := fs.Bool("exclude-generated", false, "set linguist.exclude, leaving generated and vendored files out of contributions")
+	noMerges := fs.Bool("no-merges", false, "set filters.no_merges")
+	ignoreWhitespace := fs.Bool("ignore-whitespace", false, "set filters.ignore_whitespace")
+	merges := fs.String("merges", "", "override filters.merges: ignore, first-parent or full")
+	maxCommits := fs.Int("max-commits", 0, "override filters.max_commits, the commits read from each repository")
+	expr := fs.String("expr", "", "override filters.expr, an expression commits must match to be ingested")
+	timezone := fs.String("timezone", "", "override timezone, the IANA timezone commits are bucketed into days by")
+	var authors stringList
+	fs.Var(&authors, "author", "override filters.authors (repeatable)")
+	var paths, excludePaths stringList
+	fs.Var(&paths, "path", "override filters.paths (repeatable)")
+	fs.Var(&excludePaths, "exclude-path", "override filters.exclude_paths (repeatable)")
+	excludeDefaults := fs.Bool("exclude-defaults", false, "set filters.exclude_defaults, excluding vendored, built and lock files")
+	var excludeAuthors stringList
+	fs.Var(&excludeAuthors, "exclude-author", "override filters.exclude_authors (repeatable)")
+	var outputs stringList
+	fs.Var(&outputs, "o", "override output (repeatable)")
+	fs.Var(&outputs, "output", "override output (repeatable)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s generate [flags] [config.yaml...]\n", os.Args[0])
+		fs.PrintDefaults()
 	}
-	isVerbose := *verbose || *verboseFlag
+	fs.Parse(args)
+	logOpts.setup()
+	progressSet := false
+	fs.Visit(func(f *flag.Flag) {
+		progressSet = progressSet || f.Name == "progress"
+	})
 
-	args := flag.Args()
-	if len(args) > 0 {
-		configPath = &args[0]
+	if fs.NArg() > 0 {
+		if len(configPaths) > 0 {
+			log.Fatalf("Config files given both as arguments and with -c")
+		}
+		configPaths = fs.Args()
+	}
+	if len(configPaths) == 0 {
+		configPaths = stringList{"report.yaml"}
 	}
 
-	config, err := loadConfig(*configPath)
+	config, err := loadConfigs(configPaths)
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	if err := validateConfig(config); err != nil {
-		log.Fatalf("Invalid config: %v", err)
+	if *profile != "" {
+		if err := config.applyProfile(*profile); err != nil {
+			log.Fatalf("Failed to apply profile: %v", err)
+		}
 	}
 
-	if *dryRun {
-		fmt.Println("Configuration is valid")
-		return
+	if *discoverDir != "" {
+		if err := config.discoverRepositories([]string{*discoverDir}); err != nil {
+			log.Fatalf("Failed to discover repositories: %v", err)
+		}
+	}
+
+	if len(outputs) > 0 {
+		config.Outputs = nil
+		for _, path := range outputs {
+			config.Outputs = append(config.Outputs, Output{Path: path})
+		}
+		if config.Outputs, err = config.Outputs.normalize(); err != nil {
+			log.Fatalf("Invalid output: %v", err)
+		}
+	}
+	if *since != "" {
+		config.Filters.Since = *since
+	}
+	if *until != "" {
+		config.Filters.Until = *until
+	}
+	if *branch != "" {
+		config.Filters.Branch = *branch
+	}
+	if len(authors) > 0 {
+		config.Filters.Authors = authors
+	}
+	if len(paths) > 0 {
+		config.Filters.Paths = paths
+	}
+	if len(excludePaths) > 0 {
+		config.Filters.ExcludePaths = excludePaths
+	}
+	if *excludeDefaults {
+		config.Filters.ExcludeDefaults = true
+	}
+	if len(excludeAuthors) > 0 {
+		config.Filters.ExcludeAuthors = excludeAuthors
+	}
+	if *firstParent {
+		config.Filters.FirstParent = true
+	}
+	if *noMerges {
+		config.Filters.NoMerges = true
+	}
+	if *ignoreWhitespace {
+		config.Filters.IgnoreWhitespace = true
+	}
+	if *signatures {
+		config.Ingest.Signatures = true
+	}
+	if *patchIDs {
+		config.Ingest.PatchIDs = true
+	}
+	if *blame {
+		config.Ingest.Blame = true
+	}
+	if *excludeBots {
+		config.Bots.Exclude = true
+	}
+	if *outlierLines != 0 {
+		config.Outliers.Lines = *outlierLines
+	}
+	if *excludeOutliers {
+		config.Outliers.Exclude = true
+	}
+	if *excludeGenerated {
+		config.Linguist.Exclude = true
+	}
+	if *timezone != "" {
+		config.Timezone = *timezone
+	}
+	if *merges != "" {
+		config.Filters.Merges = *merges
+	}
+	if *maxCommits != 0 {
+		config.Filters.MaxCommits = *maxCommits
+	}
+	if *expr != "" {
+		config.Filters.Expr = *expr
 	}
 
-	if config.Output == "" {
-		config.Output = "report.db"
+	if *cacheDir != "" {
+		config.CacheDir = *cacheDir
 	}
 
-	if isVerbose {
-		log.Printf("Generating report: %s", config.Output)
+	if err := validateConfig(config); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	if err := config.resolveDatePresets(time.Now()); err != nil {
+		log.Fatalf("Failed to resolve date presets: %v", err)
+	}
+	if err := config.cloneRemoteRepositories(); err != nil {
+		log.Fatalf("Failed to clone repository: %v", err)
+	}
+	if err := config.fetchRepositories(*fetch); err != nil {
+		log.Fatalf("Failed to fetch repository: %v", err)
+	}
+	if err := config.addSubmodules(); err != nil {
+		log.Fatalf("Failed to add submodules: %v", err)
+	}
+	if err := config.addAutoComponents(); err != nil {
+		log.Fatalf("Failed to generate components: %v", err)
+	}
+	config.expandComponentPatterns()
+	if config.CaseInsensitive {
+		for i := range config.Components {
+			config.Components[i].CaseInsensitive = true
+		}
+	}
+	config.Components = rollUpComponents(config.Components)
+
+	formatFlags := []struct {
+		format  string
+		enabled bool
+	}{
+		{"html", *htmlFlag},
+		{"markdown", *markdownFlag},
+		{"csv", *csvFlag},
+		{"json", *jsonFlag},
+		{"pdf", *pdfFlag},
+		{"xlsx", *xlsxFlag},
+		{"sql", *sqlFlag},
+		{"site", *siteFlag},
+		{"badges", *badgesFlag},
+		{"digest", *digestFlag},
+	}
+	for _, f := range formatFlags {
+		if f.enabled {
+			config.Outputs = config.Outputs.add(f.format)
+		}
+	}
+	if *changelogRange != "" {
+		config.Changelog.Ranges = make(map[string]string)
+		for _, repo := range config.Repositories {
+			config.Changelog.Ranges[repo.Name] = *changelogRange
+		}
+	}
+	if len(config.Changelog.Ranges) > 0 && config.Changelog.Output == "" {
+		config.Changelog.Output = "CHANGELOG.md"
 	}
 
-	db, err := initDatabase(config.Output)
+	dbPath := config.Outputs.databasePath()
+	start := time.Now()
+	slog.Info("Generating report", "output", dbPath, "repositories", len(config.Repositories))
+
+	if err := config.Outputs.createDirs(); err != nil {
+		log.Fatalf("Failed to create output directory: %v", err)
+	}
+
+	// A database left by a failed or interrupted run is resumed instead of
+	// rebuilt.
+	resume := !appendMode && dbPath != ":memory:" && hasIncompleteIngest(dbPath, config.Filters)
+	if appendMode {
+		if dbPath == ":memory:" {
+			log.Fatalf("Appending needs a sqlite output")
+		}
+	} else if resume {
+		slog.Info("Resuming interrupted run", "output", dbPath)
+	} else if dbPath != ":memory:" {
+		os.Remove(dbPath)
+	}
+	db, err := initDatabase(dbPath)
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
@@ -119,136 +571,963 @@ func main() {
 			log.Fatalf("Failed to insert repository %s: %v", repo.Name, err)
 		}
 		repoIDs[repo.Name] = id
-		if isVerbose {
-			log.Printf("Processing repository: %s", repo.Name)
+	}
+
+	// SIGINT and SIGTERM cancel ctx, killing git and rolling back the
+	// repository being ingested. A second signal kills the process.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	plans := make([]ingestPlan, len(config.Repositories))
+	for i, repo := range config.Repositories {
+		plans[i], err = planIngest(ctx, db, repo, repoIDs[repo.Name], config.Filters, resume)
+		if err != nil {
+			if ctx.Err() != nil {
+				exitInterrupted(db, config.Repositories, repoIDs)
+			}
+			log.Fatalf("Failed to resume repository %s: %v", repo.Name, err)
 		}
 	}
 
-	if err := insertComponents(db, config.Components); err != nil {
-		log.Fatalf("Failed to insert components: %v", err)
+	var p *progress
+	if *showProgress || (!progressSet && isTerminal(os.Stderr) && logOpts.interactive()) {
+		p = newProgress(os.Stderr, len(config.Repositories))
+		for i, repo := range config.Repositories {
+			switch {
+			case plans[i].skip:
+			case plans[i].resume:
+				p.addTotal(len(plans[i].revisions))
+			default:
+				commits, err := countCommits(ctx, repo, config.Filters, plans[i])
+				if err != nil {
+					if ctx.Err() != nil {
+						exitInterrupted(db, config.Repositories, repoIDs)
+					}
+					log.Fatalf("Failed to count commits of repository %s: %v", repo.Name, err)
+				}
+				p.addTotal(commits)
+			}
+		}
 	}
+	for i, repo := range config.Repositories {
+		if plans[i].skip {
+			slog.Info("Skipping repository ingested by the resumed run", "repo", repo.Name)
+			p.finishRepository()
+			continue
+		}
+		slog.Info("Processing repository", "repo", repo.Name, "resume", plans[i].resume)
+		p.startRepository(repo.Name)
+		if err := processRepository(ctx, db, repo, repoIDs[repo.Name], config.Filters, config.Ingest, plans[i], p); err != nil {
+			p.finish()
+			if ctx.Err() != nil {
+				exitInterrupted(db, config.Repositories[i:], repoIDs)
+			}
+			log.Fatalf("Failed to process repository %s: %v", repo.Name, err)
+		}
+		p.finishRepository()
+	}
+	p.finish()
 
 	for _, repo := range config.Repositories {
-		if err := processRepository(db, repo, repoIDs[repo.Name], config.Filters, isVerbose); err != nil {
-			log.Fatalf("Failed to process repository %s: %v", repo.Name, err)
+		err := ingestTags(ctx, db, repo, repoIDs[repo.Name])
+		if err == nil {
+			err = ingestBranches(ctx, db, repo, repoIDs[repo.Name], config.Filters)
+		}
+		if err == nil && config.Ingest.PatchIDs {
+			err = ingestPatchIDs(ctx, db, repo, repoIDs[repo.Name])
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				exitInterrupted(db, nil, repoIDs)
+			}
+			log.Fatalf("Failed to ingest tags and branches of %s: %v", repo.Name, err)
+		}
+	}
+	if config.Ingest.PatchIDs {
+		if err := markDuplicates(db); err != nil {
+			log.Fatalf("Failed to mark duplicate commits: %v", err)
 		}
 	}
 
-	if err := computeComponentContributions(db, config.Components, config.Repositories, repoIDs, isVerbose); err != nil {
+	// Components are replaced only now, so an interrupted run keeps those
+	// of the database being appended to. When they did not change, only
+	// the contributions of the commits added since they were computed are
+	// added.
+	computed, computedOpts, err := contributionsComputed(db)
+	if err != nil {
+		log.Fatalf("Failed to load contributions state: %v", err)
+	}
+	isBot, err := config.Bots.botMatcher()
+	if err != nil {
+		log.Fatalf("Invalid bots: %v", err)
+	}
+	// Contributions already computed are stale when authors aggregated in
+	// them became, or stopped being, bots.
+	botsChanged, err := tagBots(db, isBot, computed)
+	if err != nil {
+		log.Fatalf("Failed to tag bots: %v", err)
+	}
+	if err := flagOutliers(db, config.Outliers.Lines); err != nil {
+		log.Fatalf("Failed to flag outliers: %v", err)
+	}
+	loc, err := time.LoadLocation(config.Timezone)
+	if err != nil {
+		log.Fatalf("Failed to load timezone: %v", err)
+	}
+	if err := normalizeDates(db, loc); err != nil {
+		log.Fatalf("Failed to normalize commit dates: %v", err)
+	}
+	if err := saveCalendar(db, config.Timezone, config.Calendar); err != nil {
+		log.Fatalf("Failed to save calendar: %v", err)
+	}
+	if err := parseCommitTypes(db); err != nil {
+		log.Fatalf("Failed to parse commit types: %v", err)
+	}
+	ignoredChanged, err := config.flagIgnoredCommits(ctx, db, computed)
+	if err != nil {
+		if ctx.Err() != nil {
+			exitInterrupted(db, nil, repoIDs)
+		}
+		log.Fatalf("Failed to flag ignored commits: %v", err)
+	}
+	generatedChanged, err := config.flagGeneratedFiles(ctx, db, repoIDs, computed)
+	if err != nil {
+		if ctx.Err() != nil {
+			exitInterrupted(db, nil, repoIDs)
+		}
+		log.Fatalf("Failed to flag generated files: %v", err)
+	}
+	followedChanged, err := config.replaceFollowedPaths(ctx, db, repoIDs, computed)
+	if err != nil {
+		if ctx.Err() != nil {
+			exitInterrupted(db, nil, repoIDs)
+		}
+		log.Fatalf("Failed to follow component files: %v", err)
+	}
+	contribOpts := config.contributionOptions()
+	if botsChanged || ignoredChanged || followedChanged || (generatedChanged && contribOpts.excludeGenerated) || computedOpts != contribOpts {
+		computed = 0
+	}
+	components := withWeights(withUncategorized(config.Components), config.Weights)
+	unchanged, err := componentsUnchanged(db, components)
+	if err != nil {
+		log.Fatalf("Failed to load components: %v", err)
+	}
+	if !unchanged || computed == 0 {
+		if err := replaceComponents(db, components); err != nil {
+			log.Fatalf("Failed to insert components: %v", err)
+		}
+		computed = 0
+	}
+	if err := computeComponentContributions(db, components, repoIDs, computed, contribOpts); err != nil {
 		log.Fatalf("Failed to compute component contributions: %v", err)
 	}
+	overlapping, err := replaceCoverage(db, config.Components, repoIDs)
+	if err != nil {
+		log.Fatalf("Failed to compute component coverage: %v", err)
+	}
+	if overlapping > 0 {
+		slog.Warn("Files match several components", "files", overlapping, "overlaps", contribOpts.overlapMode())
+	}
+	if err := config.replaceFileOwnership(ctx, db, repoIDs, isBot); err != nil {
+		if ctx.Err() != nil {
+			exitInterrupted(db, nil, repoIDs)
+		}
+		log.Fatalf("Failed to blame files: %v", err)
+	}
+	if err := replaceOwnership(db, components, repoIDs, contribOpts); err != nil {
+		log.Fatalf("Failed to compute component ownership: %v", err)
+	}
+	if err := replaceBusFactors(db, config.BusFactor); err != nil {
+		log.Fatalf("Failed to compute bus factors: %v", err)
+	}
+	if err := classifyAffiliations(db, config.Organization.Domains); err != nil {
+		log.Fatalf("Failed to classify contributors: %v", err)
+	}
+	teams, err := resolveTeamMembers(config.Teams, contribOpts.identities)
+	if err != nil {
+		log.Fatalf("Failed to resolve team members: %v", err)
+	}
+	if err := replaceTeams(db, teams); err != nil {
+		log.Fatalf("Failed to compute team contributions: %v", err)
+	}
+	if err := replaceCompanyContributions(db, config.Companies); err != nil {
+		log.Fatalf("Failed to compute company contributions: %v", err)
+	}
 
-	if isVerbose {
-		log.Printf("Report generated successfully: %s", config.Output)
+	for _, output := range config.Outputs {
+		if ctx.Err() != nil {
+			exitInterrupted(db, nil, repoIDs)
+		}
+		if err := writeReport(db, output); err != nil {
+			log.Fatalf("Failed to write %s report: %v", output.Format, err)
+		}
+	}
+	if ctx.Err() != nil {
+		exitInterrupted(db, nil, repoIDs)
 	}
-}
 
-func loadConfig(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
+	if err := renderTemplates(db, config.Templates); err != nil {
+		log.Fatalf("Failed to render templates: %v", err)
 	}
 
-	var config Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, err
+	if len(config.Changelog.Ranges) > 0 {
+		if err := writeChangelog(db, config); err != nil {
+			log.Fatalf("Failed to write changelog: %v", err)
+		}
+	}
+
+	for _, output := range config.Outputs {
+		if output.Upload == "" {
+			continue
+		}
+		if err := uploadOutput(output); err != nil {
+			log.Fatalf("Failed to upload %s: %v", output.Path, err)
+		}
+	}
+
+	if config.Email.enabled() {
+		if err := sendEmail(db, config.Email); err != nil {
+			log.Fatalf("Failed to send report email: %v", err)
+		}
 	}
 
-	return &config, nil
+	if config.Webhook.URL != "" {
+		if err := notifyWebhook(db, config.Webhook); err != nil {
+			log.Fatalf("Failed to notify webhook: %v", err)
+		}
+	}
+
+	slog.Info("Report generated successfully", "output", dbPath, "duration", time.Since(start))
+
+	if !*noSummary && !config.Outputs.streaming() {
+		if err := printSummary(db, os.Stdout); err != nil {
+			log.Fatalf("Failed to print summary: %v", err)
+		}
+	}
+}
+
+// exitInterrupted ends generate after SIGINT or SIGTERM. The pending
+// repositories whose ingest did not start are removed unless they have
+// commits from a previous run; the one being ingested keeps its checkpoint,
+// so running again resumes from it.
+func exitInterrupted(db *sql.DB, pending []Repository, repoIDs map[string]int) {
+	for _, repo := range pending {
+		id := repoIDs[repo.Name]
+		_, err := db.Exec(`
+			DELETE FROM repositories
+			WHERE id = ?
+				AND NOT EXISTS (SELECT 1 FROM commits WHERE repository_id = ?)
+				AND NOT EXISTS (SELECT 1 FROM ingest_state WHERE repository_id = ?)
+		`, id, id, id)
+		if err != nil {
+			slog.Error("Failed to remove incomplete repository", "repo", repo.Name, "err", err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		slog.Error("Failed to close database", "err", err)
+	}
+	slog.Error("Interrupted", "incomplete_repositories", len(pending))
+	os.Exit(130)
 }
 
 func validateConfig(config *Config) error {
+	var problems validationErrors
 	if len(config.Repositories) == 0 {
-		return fmt.Errorf("no repositories specified")
+		problems.add(located{}, "", "no repositories specified")
 	}
 
+	names := make(map[string]Repository)
 	for _, repo := range config.Repositories {
 		if repo.Name == "" {
-			return fmt.Errorf("repository name is required")
+			problems.add(repo.loc, "", "repository name is required")
+		} else if first, ok := names[repo.Name]; ok {
+			problems.add(repo.loc, "name", "duplicate repository name %q (first defined at %s)", repo.Name, first.loc.at("name"))
+		} else {
+			names[repo.Name] = repo
 		}
 		if repo.Path == "" {
-			return fmt.Errorf("repository path is required")
+			problems.add(repo.loc, "", "repository path is required")
+		} else if !isRemoteURL(repo.Path) && !isGitRepository(repo.Path) {
+			problems.add(repo.loc, "path", "invalid git repository %q", repo.Path)
 		}
-		if _, err := os.Stat(filepath.Join(repo.Path, ".git")); err != nil {
-			return fmt.Errorf("invalid git repository: %s", repo.Path)
+	}
+
+	for _, field := range []struct{ name, value string }{
+		{"since", config.Filters.Since},
+		{"until", config.Filters.Until},
+	} {
+		if field.value != "" && !validFilterDate(field.value) && !isDatePreset(field.value) {
+			problems.add(config.Filters.loc, field.name, "invalid %s date %q (expected YYYY-MM-DD or a preset such as last-month)", field.name, field.value)
+		}
+	}
+	if t := config.Ingest.RenameThreshold; t < 0 || t > 100 {
+		problems.add(located{}, "", "invalid ingest.rename_threshold %d (expected 1 to 100)", t)
+	}
+	if _, ok := mergeModes[config.Filters.Merges]; !ok && config.Filters.Merges != "" {
+		problems.add(config.Filters.loc, "merges", "invalid merges mode %q (expected ignore, first-parent or full)", config.Filters.Merges)
+	}
+	if config.Filters.MaxCommits < 0 {
+		problems.add(config.Filters.loc, "max_commits", "invalid max_commits %d (expected 0 or more)", config.Filters.MaxCommits)
+	}
+	if _, err := config.Filters.commitExpr(); err != nil {
+		problems.add(config.Filters.loc, "expr", "%v", err)
+	}
+	for _, field := range []struct {
+		name  string
+		paths []string
+	}{
+		{"paths", config.Filters.Paths},
+		{"exclude_paths", config.Filters.ExcludePaths},
+	} {
+		for i, path := range field.paths {
+			if path == "" {
+				problems.add(config.Filters.loc, fmt.Sprintf("%s.%d", field.name, i), "empty pathspec in %s", field.name)
+			}
+		}
+	}
+	if config.IgnoreRevsFile != "" {
+		if _, err := os.Stat(config.IgnoreRevsFile); err != nil {
+			problems.add(located{}, "", "invalid ignore_revs_file: %v", err)
+		}
+	}
+	if config.Overlaps != "" && !slices.Contains(overlapModes, config.Overlaps) {
+		problems.add(located{}, "", "invalid overlaps mode %q (expected %s)", config.Overlaps, strings.Join(overlapModes, ", "))
+	}
+	if config.BusFactor < 0 || config.BusFactor > 100 {
+		problems.add(located{}, "", "invalid bus_factor %d (expected 1 to 100)", config.BusFactor)
+	}
+	if config.AutoComponents.Directories < 0 {
+		problems.add(located{}, "", "invalid auto_components.directories %d (expected 0 or more)", config.AutoComponents.Directories)
+	}
+	if config.Outliers.Lines < 0 {
+		problems.add(located{}, "", "invalid outliers.lines %d (expected 0 or more)", config.Outliers.Lines)
+	}
+	aliases := make(map[string]string)
+	for i, identity := range config.Identities {
+		if identity.Email == "" {
+			problems.add(located{}, "", "identities[%d] %q has no email", i, identity.Name)
+		}
+		for _, alias := range append([]string{identity.Email}, identity.Aliases...) {
+			key := alias
+			if strings.Contains(alias, "@") {
+				key = strings.ToLower(alias)
+			}
+			if other, ok := aliases[key]; ok && other != identity.Email {
+				problems.add(located{}, "", "identities: %q is both %s and %s", alias, other, identity.Email)
+			}
+			aliases[key] = identity.Email
+		}
+	}
+	teamNames := make(map[string]bool)
+	for i, team := range config.Teams {
+		if team.Name == "" {
+			problems.add(located{}, "", "teams[%d] has no name", i)
+		} else if teamNames[team.Name] {
+			problems.add(located{}, "", "duplicate team name %q", team.Name)
+		}
+		teamNames[team.Name] = true
+		if len(team.Members) == 0 {
+			problems.add(located{}, "", "team %q has no members", team.Name)
+		}
+	}
+	if _, err := time.LoadLocation(config.Timezone); err != nil {
+		problems.add(located{}, "", "invalid timezone %q: %v", config.Timezone, err)
+	}
+	if _, err := config.Calendar.weekday(); err != nil {
+		problems.add(located{}, "", "invalid calendar.week_start: %v", err)
+	}
+	if start := config.Calendar.FiscalYearStart; start < 0 || start > 12 {
+		problems.add(located{}, "", "invalid calendar.fiscal_year_start %d (expected a month from 1 to 12)", start)
+	}
+	for domain, company := range config.Companies {
+		if d := strings.TrimPrefix(domain, "@"); d == "" || strings.ContainsAny(d, "@/ ") {
+			problems.add(located{}, "", "invalid companies domain %q (expected a domain such as example.com)", domain)
+		}
+		if company == "" {
+			problems.add(located{}, "", "companies domain %q has no company", domain)
+		}
+	}
+	for i, domain := range config.Organization.Domains {
+		if d := strings.TrimPrefix(domain, "@"); d == "" || strings.ContainsAny(d, "@/ ") {
+			problems.add(located{}, "", "invalid organization.domains[%d] %q (expected a domain such as example.com)", i, domain)
+		}
+	}
+	for i, pattern := range config.Bots.Patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			problems.add(located{}, "", "invalid bots.patterns[%d] %q: %v", i, pattern, err)
+		}
+	}
+	for i, pattern := range config.Filters.ExcludeAuthors {
+		if _, err := regexp.Compile(pattern); err != nil {
+			problems.add(config.Filters.loc, fmt.Sprintf("exclude_authors.%d", i), "invalid exclude_authors pattern %q: %v", pattern, err)
 		}
 	}
 
+	parents := make(map[string]string)
+	for _, comp := range config.Components {
+		parents[comp.Name] = comp.Parent
+	}
+	for _, comp := range config.Components {
+		if comp.Name == "" {
+			problems.add(comp.loc, "", "component name is required")
+		} else if comp.Name == uncategorizedComponent {
+			problems.add(comp.loc, "name", "component name %q is reserved for the file changes matching no component", comp.Name)
+		}
+		// Parents may only group their children.
+		hasChildren := slices.ContainsFunc(config.Components, func(c Component) bool { return c.Parent == comp.Name })
+		if len(comp.Paths) == 0 && !hasChildren {
+			problems.add(comp.loc, "", "component %q has no paths", comp.Name)
+		}
+		if comp.Parent != "" {
+			if _, ok := parents[comp.Parent]; !ok {
+				problems.add(comp.loc, "parent", "component %q parent %q is not a component", comp.Name, comp.Parent)
+			}
+			seen := map[string]bool{comp.Name: true}
+			for parent := comp.Parent; parent != ""; parent = parents[parent] {
+				if seen[parent] {
+					problems.add(comp.loc, "parent", "component %q is its own ancestor", comp.Name)
+					break
+				}
+				seen[parent] = true
+			}
+		}
+		for i, pattern := range comp.Paths {
+			if repo, path := splitRepoPattern(pattern); repo == "" || path == "" {
+				problems.add(comp.loc, fmt.Sprintf("paths.%d", i), "component %q pattern %q is not in [repo:]path form", comp.Name, pattern)
+			} else if err := validatePattern(path); err != nil {
+				problems.add(comp.loc, fmt.Sprintf("paths.%d", i), "component %q pattern %q: %v", comp.Name, pattern, err)
+			}
+		}
+		if _, err := comp.Filters.compile(time.UTC); err != nil {
+			problems.add(comp.loc, "filters", "component %q filters: %v", comp.Name, err)
+		}
+		for _, pattern := range comp.Filters.ExcludePaths {
+			if repo, path := splitRepoPattern(pattern); repo == "" || path == "" {
+				problems.add(comp.loc, "filters", "component %q exclude_paths pattern %q is not in [repo:]path form", comp.Name, pattern)
+			} else if err := validatePattern(path); err != nil {
+				problems.add(comp.loc, "filters", "component %q exclude_paths pattern %q: %v", comp.Name, pattern, err)
+			}
+		}
+		if comp.Weight < 0 {
+			problems.add(comp.loc, "weight", "component %q weight %v is negative", comp.Name, comp.Weight)
+		}
+		validateWeights(&problems, comp.loc, fmt.Sprintf("component %q ", comp.Name), comp.Weights)
+	}
+	validateWeights(&problems, located{}, "", config.Weights)
+
+	for name := range config.Changelog.Ranges {
+		if _, ok := names[name]; !ok {
+			problems.add(located{}, "", "changelog range for unknown repository %q", name)
+		}
+	}
+
+	for _, tmpl := range config.Templates {
+		if tmpl.Path == "" {
+			problems.add(located{}, "", "template path is required")
+			continue
+		}
+		if tmpl.Output == "" {
+			problems.add(located{}, "", "template output is required: %s", tmpl.Path)
+		}
+		if _, err := parseTemplate(tmpl.Path); err != nil {
+			problems.add(located{}, "", "invalid template: %v", err)
+		}
+	}
+
+	if config.Email.enabled() {
+		if err := validateEmail(config.Email); err != nil {
+			problems.add(located{}, "", "%v", err)
+		}
+	}
+
+	if config.Webhook.URL != "" {
+		if err := validateWebhook(config.Webhook); err != nil {
+			problems.add(located{}, "", "%v", err)
+		}
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
 	return nil
 }
 
+// validFilterDate reports whether s is a date, optionally with a time, as
+// expected by the since and until filters.
+func validFilterDate(s string) bool {
+	for _, layout := range []string{time.DateOnly, time.DateTime, time.RFC3339} {
+		if _, err := time.Parse(layout, s); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// initDatabase opens the database at path, keeping its contents. Callers
+// building a new database remove the file first.
 func initDatabase(path string) (*sql.DB, error) {
-	os.Remove(path)
 	db, err := sql.Open("sqlite3", path)
 	if err != nil {
 		return nil, err
 	}
+	// Every new connection to :memory: opens a separate empty database.
+	db.SetMaxOpenConns(1)
 	return db, nil
 }
 
 func createSchema(db *sql.DB) error {
 	schema := `
-	CREATE TABLE repositories (
+	CREATE TABLE IF NOT EXISTS repositories (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		name TEXT UNIQUE NOT NULL,
 		path TEXT NOT NULL
 	);
 
-	CREATE TABLE commits (
-		hash TEXT PRIMARY KEY,
+	CREATE TABLE IF NOT EXISTS commits (
+		hash TEXT PRIMARY KEY,
+		repository_id INTEGER NOT NULL,
+		author TEXT NOT NULL,
+		email TEXT NOT NULL,
+		date DATETIME NOT NULL,
+		message TEXT NOT NULL,
+		is_merge INTEGER NOT NULL DEFAULT 0,
+		signature_status TEXT NOT NULL DEFAULT '',
+		signer TEXT NOT NULL DEFAULT '',
+		signing_key TEXT NOT NULL DEFAULT '',
+		files_changed INTEGER NOT NULL DEFAULT 0,
+		total_additions INTEGER NOT NULL DEFAULT 0,
+		total_deletions INTEGER NOT NULL DEFAULT 0,
+		patch_id TEXT NOT NULL DEFAULT '',
+		duplicate_of TEXT NOT NULL DEFAULT '',
+		is_bot INTEGER NOT NULL DEFAULT 0,
+		is_outlier INTEGER NOT NULL DEFAULT 0,
+		is_ignored INTEGER NOT NULL DEFAULT 0,
+		report_date DATETIME NOT NULL DEFAULT '',
+		commit_type TEXT,
+		commit_scope TEXT NOT NULL DEFAULT '',
+		is_breaking INTEGER NOT NULL DEFAULT 0,
+		FOREIGN KEY (repository_id) REFERENCES repositories(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS commit_parents (
+		commit_hash TEXT NOT NULL,
+		parent_hash TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		PRIMARY KEY (commit_hash, position),
+		FOREIGN KEY (commit_hash) REFERENCES commits(hash)
+	);
+
+	CREATE TABLE IF NOT EXISTS commit_coauthors (
+		commit_hash TEXT NOT NULL,
+		author TEXT NOT NULL,
+		email TEXT NOT NULL,
+		is_bot INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (commit_hash, email),
+		FOREIGN KEY (commit_hash) REFERENCES commits(hash)
+	);
+
+	CREATE TABLE IF NOT EXISTS commit_trailers (
+		commit_hash TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		key TEXT NOT NULL,
+		value TEXT NOT NULL,
+		PRIMARY KEY (commit_hash, position),
+		FOREIGN KEY (commit_hash) REFERENCES commits(hash)
+	);
+
+	CREATE TABLE IF NOT EXISTS file_changes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		commit_hash TEXT NOT NULL,
+		filepath TEXT NOT NULL,
+		additions INTEGER,
+		deletions INTEGER,
+		change_type TEXT NOT NULL,
+		old_path TEXT NOT NULL DEFAULT '',
+		binary INTEGER NOT NULL DEFAULT 0,
+		old_mode TEXT NOT NULL DEFAULT '',
+		new_mode TEXT NOT NULL DEFAULT '',
+		generated INTEGER NOT NULL DEFAULT 0,
+		FOREIGN KEY (commit_hash) REFERENCES commits(hash)
+	);
+
+	CREATE TABLE IF NOT EXISTS components (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT UNIQUE NOT NULL,
+		path_patterns TEXT NOT NULL,
+		filters TEXT NOT NULL DEFAULT '',
+		follow INTEGER NOT NULL DEFAULT 0,
+		case_insensitive INTEGER NOT NULL DEFAULT 0,
+		parent_id INTEGER REFERENCES components(id),
+		weight REAL NOT NULL DEFAULT 1,
+		path_weights TEXT NOT NULL DEFAULT '',
+		is_language INTEGER NOT NULL DEFAULT 0
+	);
+
+	CREATE TABLE IF NOT EXISTS followed_paths (
+		repository_id INTEGER NOT NULL,
+		path TEXT NOT NULL,
+		commit_hash TEXT NOT NULL,
+		filepath TEXT NOT NULL,
+		PRIMARY KEY (repository_id, path, commit_hash, filepath),
+		FOREIGN KEY (repository_id) REFERENCES repositories(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS component_coverage (
+		repository_id INTEGER PRIMARY KEY,
+		file_changes INTEGER NOT NULL,
+		categorized_changes INTEGER NOT NULL,
+		lines INTEGER NOT NULL,
+		categorized_lines INTEGER NOT NULL,
+		FOREIGN KEY (repository_id) REFERENCES repositories(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS component_overlaps (
+		repository_id INTEGER NOT NULL,
+		filepath TEXT NOT NULL,
+		components TEXT NOT NULL,
+		file_changes INTEGER NOT NULL,
+		PRIMARY KEY (repository_id, filepath),
+		FOREIGN KEY (repository_id) REFERENCES repositories(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS file_ownership (
+		repository_id INTEGER NOT NULL,
+		filepath TEXT NOT NULL,
+		author TEXT NOT NULL,
+		email TEXT NOT NULL,
+		lines INTEGER NOT NULL,
+		is_bot INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (repository_id, filepath, email, author),
+		FOREIGN KEY (repository_id) REFERENCES repositories(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS component_ownership (
+		component_id INTEGER NOT NULL,
+		repository_id INTEGER NOT NULL,
+		author TEXT NOT NULL,
+		email TEXT NOT NULL,
+		lines INTEGER NOT NULL,
+		is_bot INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (component_id, repository_id, email),
+		FOREIGN KEY (component_id) REFERENCES components(id),
+		FOREIGN KEY (repository_id) REFERENCES repositories(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS component_bus_factors (
+		component_id INTEGER PRIMARY KEY,
+		threshold INTEGER NOT NULL,
+		commit_authors INTEGER NOT NULL DEFAULT 0,
+		line_authors INTEGER NOT NULL DEFAULT 0,
+		FOREIGN KEY (component_id) REFERENCES components(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS component_contributions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		component_id INTEGER NOT NULL,
+		repository_id INTEGER NOT NULL,
+		author TEXT NOT NULL,
+		email TEXT NOT NULL,
+		commit_count INTEGER NOT NULL,
+		total_additions INTEGER NOT NULL,
+		total_deletions INTEGER NOT NULL,
+		co_authored_count INTEGER NOT NULL DEFAULT 0,
+		signed_count INTEGER NOT NULL DEFAULT 0,
+		mode_change_count INTEGER NOT NULL DEFAULT 0,
+		is_bot INTEGER NOT NULL DEFAULT 0,
+		affiliation TEXT NOT NULL DEFAULT '',
+		weighted_lines REAL NOT NULL DEFAULT 0,
+		FOREIGN KEY (component_id) REFERENCES components(id),
+		FOREIGN KEY (repository_id) REFERENCES repositories(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS teams (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT UNIQUE NOT NULL,
+		members TEXT NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS team_contributions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		team_id INTEGER NOT NULL,
+		component_id INTEGER NOT NULL,
+		contributor_count INTEGER NOT NULL,
+		commit_count INTEGER NOT NULL,
+		total_additions INTEGER NOT NULL,
+		total_deletions INTEGER NOT NULL,
+		FOREIGN KEY (team_id) REFERENCES teams(id),
+		FOREIGN KEY (component_id) REFERENCES components(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS company_contributions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		company TEXT NOT NULL,
+		component_id INTEGER NOT NULL,
+		contributor_count INTEGER NOT NULL,
+		commit_count INTEGER NOT NULL,
+		total_additions INTEGER NOT NULL,
+		total_deletions INTEGER NOT NULL,
+		FOREIGN KEY (component_id) REFERENCES components(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS report_settings (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		timezone TEXT NOT NULL,
+		week_start INTEGER NOT NULL,
+		fiscal_year_start INTEGER NOT NULL,
+		companies TEXT NOT NULL DEFAULT '{}'
+	);
+
+	CREATE TABLE IF NOT EXISTS ingest_state (
+		repository_id INTEGER PRIMARY KEY,
+		last_commit TEXT NOT NULL,
+		complete INTEGER NOT NULL,
+		filters TEXT NOT NULL,
+		FOREIGN KEY (repository_id) REFERENCES repositories(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS repository_tips (
 		repository_id INTEGER NOT NULL,
-		author TEXT NOT NULL,
-		email TEXT NOT NULL,
-		date DATETIME NOT NULL,
-		message TEXT NOT NULL,
+		branch TEXT NOT NULL,
+		tip TEXT NOT NULL,
+		filters TEXT NOT NULL,
+		updated_at DATETIME NOT NULL,
+		PRIMARY KEY (repository_id, branch),
 		FOREIGN KEY (repository_id) REFERENCES repositories(id)
 	);
 
-	CREATE TABLE file_changes (
+	CREATE TABLE IF NOT EXISTS tags (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		repository_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
 		commit_hash TEXT NOT NULL,
-		filepath TEXT NOT NULL,
-		additions INTEGER NOT NULL,
-		deletions INTEGER NOT NULL,
-		change_type TEXT NOT NULL,
-		FOREIGN KEY (commit_hash) REFERENCES commits(hash)
+		date DATETIME NOT NULL,
+		position INTEGER NOT NULL,
+		UNIQUE (repository_id, name),
+		FOREIGN KEY (repository_id) REFERENCES repositories(id)
 	);
 
-	CREATE TABLE components (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT UNIQUE NOT NULL,
-		path_patterns TEXT NOT NULL
+	CREATE TABLE IF NOT EXISTS tag_commits (
+		tag_id INTEGER NOT NULL,
+		commit_hash TEXT NOT NULL,
+		PRIMARY KEY (tag_id, commit_hash),
+		FOREIGN KEY (tag_id) REFERENCES tags(id)
 	);
 
-	CREATE TABLE component_contributions (
+	CREATE TABLE IF NOT EXISTS branches (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		component_id INTEGER NOT NULL,
 		repository_id INTEGER NOT NULL,
-		author TEXT NOT NULL,
-		email TEXT NOT NULL,
-		commit_count INTEGER NOT NULL,
-		total_additions INTEGER NOT NULL,
-		total_deletions INTEGER NOT NULL,
-		FOREIGN KEY (component_id) REFERENCES components(id),
+		name TEXT NOT NULL,
+		tip TEXT NOT NULL,
+		last_commit_date DATETIME NOT NULL,
+		ahead INTEGER NOT NULL,
+		behind INTEGER NOT NULL,
+		is_default INTEGER NOT NULL,
+		UNIQUE (repository_id, name),
 		FOREIGN KEY (repository_id) REFERENCES repositories(id)
 	);
 
-	CREATE INDEX idx_commits_repo ON commits(repository_id);
-	CREATE INDEX idx_file_changes_commit ON file_changes(commit_hash);
-	CREATE INDEX idx_component_contributions_component ON component_contributions(component_id);
+	CREATE TABLE IF NOT EXISTS contribution_state (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		last_commit_rowid INTEGER NOT NULL,
+		exclude_bots INTEGER NOT NULL DEFAULT 0,
+		outlier_lines INTEGER NOT NULL DEFAULT 0,
+		exclude_generated INTEGER NOT NULL DEFAULT 0,
+		identities TEXT NOT NULL DEFAULT '',
+		overlaps TEXT NOT NULL DEFAULT ''
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_commits_repo ON commits(repository_id);
+	CREATE INDEX IF NOT EXISTS idx_file_changes_commit ON file_changes(commit_hash);
+	CREATE INDEX IF NOT EXISTS idx_component_contributions_component ON component_contributions(component_id);
+	CREATE INDEX IF NOT EXISTS idx_team_contributions_team ON team_contributions(team_id);
+	CREATE INDEX IF NOT EXISTS idx_tag_commits_commit ON tag_commits(commit_hash);
+	CREATE INDEX IF NOT EXISTS idx_commit_parents_parent ON commit_parents(parent_hash);
+	CREATE INDEX IF NOT EXISTS idx_commit_trailers_key ON commit_trailers(key);
 	`
 
-	_, err := db.Exec(schema)
-	return err
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Line counts of file changes became nullable, for binary files. As
+	// constraints cannot be altered, an older table is set aside and copied
+	// into the new one.
+	var legacyFileChanges bool
+	err = tx.QueryRow("SELECT COUNT(*) > 0 FROM pragma_table_info('file_changes') WHERE name = 'additions' AND \"notnull\"").
+		Scan(&legacyFileChanges)
+	if err != nil {
+		return err
+	}
+	if legacyFileChanges {
+		_, err := tx.Exec(`
+			ALTER TABLE file_changes RENAME TO file_changes_legacy;
+			DROP INDEX IF EXISTS idx_file_changes_commit;
+		`)
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(schema); err != nil {
+		return err
+	}
+	if err := addMissingColumns(tx); err != nil {
+		return err
+	}
+	// Indexes of added columns are created once they exist.
+	if _, err := tx.Exec("CREATE INDEX IF NOT EXISTS idx_commits_patch_id ON commits(patch_id)"); err != nil {
+		return err
+	}
+
+	if legacyFileChanges {
+		columns, err := tableColumns(tx, "file_changes_legacy")
+		if err != nil {
+			return err
+		}
+		list := strings.Join(columns, ", ")
+		_, err = tx.Exec(fmt.Sprintf("INSERT INTO file_changes (%s) SELECT %s FROM file_changes_legacy; DROP TABLE file_changes_legacy", list, list))
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
-func insertRepository(db *sql.DB, repo Repository) (int, error) {
-	result, err := db.Exec("INSERT INTO repositories (name, path) VALUES (?, ?)", repo.Name, repo.Path)
+// tableColumns returns the column names of a table.
+func tableColumns(tx *sql.Tx, table string) ([]string, error) {
+	rows, err := tx.Query("SELECT name FROM pragma_table_info(?) ORDER BY cid", table)
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	defer rows.Close()
+	var columns []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns = append(columns, name)
+	}
+	return columns, rows.Err()
+}
+
+// addedColumns lists the columns added to existing tables after their
+// creation, which databases being appended to may lack. Backfill, if any,
+// computes the values of the rows already there.
+var addedColumns = []struct{ table, column, definition, backfill string }{
+	{"commits", "is_merge", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"component_contributions", "co_authored_count", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"commits", "signature_status", "TEXT NOT NULL DEFAULT ''", ""},
+	{"commits", "signer", "TEXT NOT NULL DEFAULT ''", ""},
+	{"commits", "signing_key", "TEXT NOT NULL DEFAULT ''", ""},
+	{"component_contributions", "signed_count", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"file_changes", "old_path", "TEXT NOT NULL DEFAULT ''", ""},
+	{"file_changes", "binary", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"file_changes", "old_mode", "TEXT NOT NULL DEFAULT ''", ""},
+	{"file_changes", "new_mode", "TEXT NOT NULL DEFAULT ''", ""},
+	{"component_contributions", "mode_change_count", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"commits", "files_changed", "INTEGER NOT NULL DEFAULT 0", `
+		UPDATE commits SET
+			files_changed = s.files, total_additions = s.additions, total_deletions = s.deletions
+		FROM (
+			SELECT commit_hash, COUNT(*) AS files,
+				COALESCE(SUM(additions), 0) AS additions, COALESCE(SUM(deletions), 0) AS deletions
+			FROM file_changes GROUP BY commit_hash
+		) s
+		WHERE s.commit_hash = commits.hash`},
+	{"commits", "total_additions", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"commits", "total_deletions", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"commits", "patch_id", "TEXT NOT NULL DEFAULT ''", ""},
+	{"commits", "duplicate_of", "TEXT NOT NULL DEFAULT ''", ""},
+	{"commits", "is_bot", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"commit_coauthors", "is_bot", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"component_contributions", "is_bot", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"contribution_state", "exclude_bots", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"component_contributions", "affiliation", "TEXT NOT NULL DEFAULT ''", ""},
+	{"commits", "is_outlier", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"contribution_state", "outlier_lines", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"commits", "is_ignored", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"file_changes", "generated", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"contribution_state", "exclude_generated", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"contribution_state", "identities", "TEXT NOT NULL DEFAULT ''", ""},
+	{"contribution_state", "overlaps", "TEXT NOT NULL DEFAULT ''", ""},
+	{"commits", "report_date", "DATETIME NOT NULL DEFAULT ''", ""},
+	{"components", "filters", "TEXT NOT NULL DEFAULT ''", ""},
+	{"commits", "commit_type", "TEXT", ""},
+	{"commits", "commit_scope", "TEXT NOT NULL DEFAULT ''", ""},
+	{"commits", "is_breaking", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"components", "follow", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"components", "case_insensitive", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"components", "parent_id", "INTEGER REFERENCES components(id)", ""},
+	{"components", "weight", "REAL NOT NULL DEFAULT 1", ""},
+	{"components", "path_weights", "TEXT NOT NULL DEFAULT ''", ""},
+	{"components", "is_language", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"report_settings", "companies", "TEXT NOT NULL DEFAULT '{}'", ""},
+	// Contributions computed before weights had none.
+	{"component_contributions", "weighted_lines", "REAL NOT NULL DEFAULT 0",
+		"UPDATE component_contributions SET weighted_lines = total_additions + total_deletions"},
+}
+
+// addMissingColumns adds the columns of addedColumns missing from an
+// existing database.
+func addMissingColumns(tx *sql.Tx) error {
+	// Backfills run once every column is there, as they may set several.
+	var pending []string
+	for _, c := range addedColumns {
+		var n int
+		err := tx.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", c.table, c.column).Scan(&n)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			continue
+		}
+		if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.column, c.definition)); err != nil {
+			return err
+		}
+		if c.backfill != "" {
+			pending = append(pending, c.backfill)
+		}
+	}
+	for _, query := range pending {
+		if _, err := tx.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertRepository adds a repository, or updates the path of one with the
+// same name already in the database, and returns its id. Remote repositories
+// are recorded with their URL.
+func insertRepository(db *sql.DB, repo Repository) (int, error) {
+	path := repo.Path
+	if repo.url != "" {
+		path = repo.url
+	}
+	var id int
+	err := db.QueryRow(`
+		INSERT INTO repositories (name, path) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE SET path = excluded.path
+		RETURNING id
+	`, repo.Name, path).Scan(&id)
+	return id, err
+}
+
+// replaceComponents removes the components, and the contributions and
+// ownership computed by a previous run, before inserting components.
+func replaceComponents(db *sql.DB, components []Component) error {
+	if _, err := db.Exec("DELETE FROM component_contributions; DELETE FROM component_ownership; DELETE FROM component_bus_factors; DELETE FROM components"); err != nil {
+		return err
 	}
-	id, err := result.LastInsertId()
-	return int(id), err
+	return insertComponents(db, components)
 }
 
 func insertComponents(db *sql.DB, components []Component) error {
@@ -257,17 +1536,29 @@ func insertComponents(db *sql.DB, components []Component) error {
 		if err != nil {
 			return err
 		}
-		_, err = db.Exec("INSERT INTO components (name, path_patterns) VALUES (?, ?)", comp.Name, string(patterns))
+		filters, err := comp.Filters.encode()
+		if err != nil {
+			return err
+		}
+		weights, err := encodePathWeights(comp.Weights)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec(`
+			INSERT INTO components (name, path_patterns, filters, follow, case_insensitive, weight, path_weights, is_language)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, comp.Name, string(patterns), filters, comp.Follow, comp.CaseInsensitive, comp.weight(), weights, comp.language)
 		if err != nil {
 			return err
 		}
 	}
-	return nil
+	return setComponentParents(db, components)
 }
 
-func processRepository(db *sql.DB, repo Repository, repoID int, filters Filters, verbose bool) error {
-	args := []string{"log", "--numstat", "--pretty=format:%H%x00%an%x00%ae%x00%ai%x00%s%x00"}
-
+// gitFilterArgs returns the git log arguments selecting the commits to
+// ingest, except for the revision, see ingestPlan.revisionRange.
+func gitFilterArgs(filters Filters) []string {
+	var args []string
 	if filters.Since != "" {
 		args = append(args, fmt.Sprintf("--since=%s", filters.Since))
 	}
@@ -277,52 +1568,227 @@ func processRepository(db *sql.DB, repo Repository, repoID int, filters Filters,
 	for _, author := range filters.Authors {
 		args = append(args, fmt.Sprintf("--author=%s", author))
 	}
-	if filters.Branch != "" {
-		args = append(args, filters.Branch)
+	if filters.FirstParent {
+		args = append(args, "--first-parent")
+	}
+	if filters.NoMerges {
+		args = append(args, "--no-merges")
+	}
+	if filters.IgnoreWhitespace {
+		args = append(args, "--ignore-all-space", "--ignore-blank-lines")
 	}
+	if filters.MaxCommits > 0 {
+		args = append(args, fmt.Sprintf("--max-count=%d", filters.MaxCommits))
+	}
+	return args
+}
 
-	cmd := exec.Command("git", args...)
-	cmd.Dir = repo.Path
+// defaultExcludePaths are the glob pathspecs of vendored dependencies, build
+// outputs, minified assets and lock files, at any depth, excluded with
+// filters.exclude_defaults.
+var defaultExcludePaths = []string{
+	"**/vendor/**",
+	"**/node_modules/**",
+	"**/dist/**",
+	"**/*.min.js",
+	"**/*.min.css",
+	"**/package-lock.json",
+	"**/yarn.lock",
+	"**/pnpm-lock.yaml",
+	"**/go.sum",
+	"**/Cargo.lock",
+	"**/Gemfile.lock",
+	"**/composer.lock",
+	"**/poetry.lock",
+}
 
-	output, err := cmd.Output()
-	if err != nil {
-		return fmt.Errorf("git log failed: %v", err)
+// pathspecArgs returns the pathspecs of filters.paths and
+// filters.exclude_paths, to follow the revisions in git arguments. Excluded
+// paths use the :(exclude) magic; alone, they exclude from the whole tree.
+func pathspecArgs(filters Filters) []string {
+	if len(filters.Paths) == 0 && len(filters.ExcludePaths) == 0 && !filters.ExcludeDefaults {
+		return nil
+	}
+	args := append([]string{"--"}, filters.Paths...)
+	for _, path := range filters.ExcludePaths {
+		args = append(args, ":(exclude)"+path)
+	}
+	if filters.ExcludeDefaults {
+		for _, path := range defaultExcludePaths {
+			args = append(args, ":(exclude,glob)"+path)
+		}
 	}
+	return args
+}
 
-	return parseGitLog(db, string(output), repoID, verbose)
+// rawChange is a --raw entry: the file modes before and after a change,
+// "000000" for a missing file, and the change status letter.
+type rawChange struct {
+	oldMode string
+	newMode string
+	status  string
 }
 
-func parseGitLog(db *sql.DB, output string, repoID int, verbose bool) error {
-	tx, err := db.Begin()
-	if err != nil {
+// parseRawLine parses a --raw line, ":<old mode> <new mode> <old blob>
+// <new blob> <status>\t<path>[\t<new path>]", returning the path the change
+// is recorded under.
+func parseRawLine(line string) (string, rawChange, bool) {
+	meta, paths, ok := strings.Cut(line[1:], "\t")
+	fields := strings.Fields(meta)
+	if !ok || len(fields) < 5 || fields[4] == "" {
+		return "", rawChange{}, false
+	}
+	// Renames and copies list the new path last.
+	if i := strings.LastIndex(paths, "\t"); i >= 0 {
+		paths = paths[i+1:]
+	}
+	return paths, rawChange{oldMode: fields[0], newMode: fields[1], status: fields[4][:1]}, true
+}
+
+// modeChanged reports whether a change alters the mode of an existing file,
+// e.g. setting the executable bit, or adds a symbolic link.
+func (c rawChange) modeChanged() bool {
+	if c.oldMode == "000000" {
+		return c.newMode == symlinkMode
+	}
+	return c.oldMode != c.newMode && c.newMode != "000000"
+}
+
+// Git file modes of symbolic links and of gitlinks, the commits submodules
+// point to.
+const (
+	symlinkMode = "120000"
+	gitlinkMode = "160000"
+)
+
+// parseRenamePath splits a --numstat rename, "old => new" or with the common
+// parts outside braces as in "src/{old => new}/file.go", into its old and
+// new paths.
+func parseRenamePath(path string) (string, string, bool) {
+	open := strings.Index(path, "{")
+	end := strings.LastIndex(path, "}")
+	if open >= 0 && end > open {
+		from, to, ok := strings.Cut(path[open+1:end], " => ")
+		if ok {
+			prefix, suffix := path[:open], path[end+1:]
+			// An empty side leaves a doubled slash, e.g. "a/{ => b}/c".
+			join := func(middle string) string {
+				return strings.Replace(prefix+middle+suffix, "//", "/", 1)
+			}
+			return join(from), join(to), true
+		}
+	}
+	return strings.Cut(path, " => ")
+}
+
+// trailersFormat is the git log format of the commit message trailers,
+// continuation lines unfolded and separated by \x1f.
+const trailersFormat = "%(trailers:only,unfold,separator=%x1f)"
+
+// mergeModes maps the filters.merges modes to the git log arguments
+// producing the file changes of merge commits. Without any, git log prints
+// none.
+var mergeModes = map[string][]string{
+	"ignore":       nil,
+	"first-parent": {"--diff-merges=first-parent"},
+	"full":         {"--diff-merges=separate"},
+}
+
+func processRepository(ctx context.Context, db *sql.DB, repo Repository, repoID int, filters Filters, opts IngestOptions, plan ingestPlan, p *progress) error {
+	if err := startIngest(db, repoID, filters, plan.resume); err != nil {
 		return err
 	}
-	defer tx.Rollback()
+	if plan.resume && len(plan.revisions) == 0 {
+		return finishIngest(db, repoID, filters, plan.tip)
+	}
+
+	format := "%H%x00%an%x00%ae%x00%ai%x00%s%x00%P%x00" + trailersFormat + "%x00"
+	if opts.Signatures {
+		format += "%G?%x00%GS%x00%GK%x00"
+	}
+	renames := "--find-renames"
+	if opts.RenameThreshold > 0 {
+		renames += fmt.Sprintf("=%d%%", opts.RenameThreshold)
+	}
+	args := []string{"log", "--raw", "--numstat", renames, "--pretty=format:" + format}
+	args = append(args, mergeModes[filters.Merges]...)
+	if plan.resume {
+		// Only the commits after the checkpoint, listed on stdin.
+		args = append(args, "--no-walk=unsorted", "--stdin")
+	} else {
+		args = append(args, gitFilterArgs(filters)...)
+		args = append(args, plan.revisionRange())
+	}
+	args = append(args, pathspecArgs(filters)...)
 
-	commitStmt, err := tx.Prepare("INSERT INTO commits (hash, repository_id, author, email, date, message) VALUES (?, ?, ?, ?, ?, ?)")
+	// The log is parsed while git writes it, so progress can be reported.
+	start := time.Now()
+	cmd := gitCommandContext(ctx, repo.Path, args...)
+	if plan.resume {
+		cmd.Stdin = strings.NewReader(strings.Join(plan.revisions, "\n") + "\n")
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return err
 	}
-	defer commitStmt.Close()
-
-	fileStmt, err := tx.Prepare("INSERT INTO file_changes (commit_hash, filepath, additions, deletions, change_type) VALUES (?, ?, ?, ?, ?)")
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("git log failed: %v", err)
+	}
+	excluded, err := filters.authorExcluder()
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	expr, err := filters.commitExpr()
 	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	commits, err := parseGitLog(ctx, db, stdout, repoID, excluded, expr, p.commit)
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("git log failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if err := finishIngest(db, repoID, filters, plan.tip); err != nil {
 		return err
 	}
-	defer fileStmt.Close()
+	slog.Info("Processed repository", "repo", repo.Name, "range", plan.revisionRange(), "commits", commits, "duration", time.Since(start))
+	return nil
+}
+
+// parseGitLog inserts the commits and file changes of a git log output and
+// returns the number of commits. Commits for which excluded reports true
+// are skipped, as are those not matching expr, if any, once their file
+// changes were read. onCommit is called for every commit. They
+// are inserted in batches, see ingestBatch; the batch being inserted is
+// rolled back when ctx is done first.
+func parseGitLog(ctx context.Context, db *sql.DB, output io.Reader, repoID int, excluded func(author, email string) bool, expr *commitExpr, onCommit func()) (int, error) {
+	batch := &logBatch{ctx: ctx, db: db, repoID: repoID}
+	defer batch.rollback()
+	if err := batch.begin(); err != nil {
+		return 0, err
+	}
 
-	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner := bufio.NewScanner(output)
 	var currentCommit *Commit
+	var lastHash string
+	// raw holds the --raw entries of the current commit by path, listed
+	// before its --numstat lines.
+	raw := make(map[string]rawChange)
 	commitCount := 0
 
 	for scanner.Scan() {
 		line := scanner.Text()
 
 		if strings.Contains(line, "\x00") {
-			if currentCommit != nil {
-				commitCount++
-			}
-
 			parts := strings.Split(line, "\x00")
 			if len(parts) < 5 {
 				continue
@@ -332,7 +1798,28 @@ func parseGitLog(db *sql.DB, output string, repoID int, verbose bool) error {
 			if err != nil {
 				continue
 			}
+			// Merge commits diffed against each parent are listed once per
+			// parent; the file changes of every listing belong to the same
+			// commit.
+			if parts[0] == lastHash {
+				continue
+			}
+			lastHash = parts[0]
+			if removed, err := batch.finish(currentCommit, expr); err != nil {
+				return 0, err
+			} else if removed {
+				commitCount--
+			}
 
+			if batch.commits >= ingestBatch {
+				if err := batch.checkpoint(); err != nil {
+					return 0, err
+				}
+			}
+			batch.commits++
+			batch.last = parts[0]
+
+			clear(raw)
 			currentCommit = &Commit{
 				Hash:         parts[0],
 				RepositoryID: repoID,
@@ -341,64 +1828,162 @@ func parseGitLog(db *sql.DB, output string, repoID int, verbose bool) error {
 				Date:         date,
 				Message:      parts[4],
 			}
+			if len(parts) > 5 {
+				currentCommit.Parents = strings.Fields(parts[5])
+			}
+			if len(parts) > 9 {
+				currentCommit.SignatureStatus, currentCommit.Signer, currentCommit.SigningKey = parts[7], parts[8], parts[9]
+			}
+			if len(parts) > 6 && parts[6] != "" {
+				for _, line := range strings.Split(parts[6], "\x1f") {
+					key, value, ok := strings.Cut(line, ":")
+					if !ok {
+						continue
+					}
+					trailer := Trailer{Key: strings.TrimSpace(key), Value: strings.TrimSpace(value)}
+					currentCommit.Trailers = append(currentCommit.Trailers, trailer)
+					if !strings.EqualFold(trailer.Key, "Co-authored-by") {
+						continue
+					}
+					coAuthor, ok := parseCoAuthor(trailer.Value)
+					if ok && coAuthor.Email != currentCommit.Email {
+						currentCommit.CoAuthors = append(currentCommit.CoAuthors, coAuthor)
+					}
+				}
+			}
+
+			// Excluded commits still count as read, for the checkpoint and
+			// progress.
+			if excluded(currentCommit.Author, currentCommit.Email) {
+				onCommit()
+				currentCommit = nil
+				continue
+			}
 
-			_, err = commitStmt.Exec(currentCommit.Hash, currentCommit.RepositoryID,
-				currentCommit.Author, currentCommit.Email, currentCommit.Date, currentCommit.Message)
+			result, err := batch.commitStmt.Exec(currentCommit.Hash, currentCommit.RepositoryID,
+				currentCommit.Author, currentCommit.Email, currentCommit.Date, currentCommit.Message,
+				len(currentCommit.Parents) > 1, currentCommit.SignatureStatus, currentCommit.Signer, currentCommit.SigningKey)
 			if err != nil {
-				return err
+				return 0, err
+			}
+			onCommit()
+			// Commits already in the database (when appending) are skipped
+			// along with their file changes.
+			if n, err := result.RowsAffected(); err != nil {
+				return 0, err
+			} else if n == 0 {
+				if err := batch.ingested(currentCommit.Hash); err != nil {
+					return 0, err
+				}
+				currentCommit = nil
+				continue
+			}
+			for i, parent := range currentCommit.Parents {
+				if _, err := batch.parentStmt.Exec(currentCommit.Hash, parent, i+1); err != nil {
+					return 0, err
+				}
+			}
+			for i, trailer := range currentCommit.Trailers {
+				if _, err := batch.trailerStmt.Exec(currentCommit.Hash, i+1, trailer.Key, trailer.Value); err != nil {
+					return 0, err
+				}
+			}
+			for _, coAuthor := range currentCommit.CoAuthors {
+				if _, err := batch.coAuthorStmt.Exec(currentCommit.Hash, coAuthor.Author, coAuthor.Email); err != nil {
+					return 0, err
+				}
 			}
+			commitCount++
 			continue
 		}
 
 		if currentCommit == nil || line == "" {
 			continue
 		}
+		if strings.HasPrefix(line, ":") {
+			if path, change, ok := parseRawLine(line); ok {
+				raw[path] = change
+			}
+			continue
+		}
 
-		parts := strings.Fields(line)
+		// Paths can contain spaces, only tabs separate the fields.
+		parts := strings.SplitN(line, "\t", 3)
 		if len(parts) < 3 {
 			continue
 		}
 
-		adds, errAdds := strconv.Atoi(parts[0])
-		dels, errDels := strconv.Atoi(parts[1])
-
-		// Skip binary files (marked as "-" in numstat)
-		if errAdds != nil || errDels != nil {
-			continue
+		// Binary files have "-" line counts, recorded as NULL.
+		var adds, dels sql.NullInt64
+		binary := parts[0] == "-" && parts[1] == "-"
+		if !binary {
+			a, errAdds := strconv.Atoi(parts[0])
+			d, errDels := strconv.Atoi(parts[1])
+			if errAdds != nil || errDels != nil {
+				continue
+			}
+			adds = sql.NullInt64{Int64: int64(a), Valid: true}
+			dels = sql.NullInt64{Int64: int64(d), Valid: true}
 		}
 
-		// Handle renames: "0	0	old.txt => new.txt"
-		// For renames, we want the new filename
+		// Renames are recorded under the new path, keeping the old one.
 		filepath := parts[2]
+		oldPath := ""
 		changeType := "M"
 
-		if len(parts) >= 5 && parts[3] == "=>" {
-			// This is a rename
-			filepath = parts[4]
+		if from, to, ok := parseRenamePath(filepath); ok {
+			filepath, oldPath = to, from
 			changeType = "R"
+		} else if change, ok := raw[filepath]; ok {
+			changeType = change.status
+			// Submodule pointer changes are not lines of code.
+			if change.oldMode == gitlinkMode || change.newMode == gitlinkMode {
+				changeType = "S"
+				adds.Int64, dels.Int64 = 0, 0
+			}
 		} else {
 			// Determine change type from the stats
-			if adds > 0 && dels == 0 {
+			if adds.Int64 > 0 && dels.Int64 == 0 {
 				changeType = "A"
-			} else if adds == 0 && dels > 0 {
+			} else if adds.Int64 == 0 && dels.Int64 > 0 {
 				changeType = "D"
 			}
 		}
 
-		_, err := fileStmt.Exec(currentCommit.Hash, filepath, adds, dels, changeType)
+		change := raw[filepath]
+		_, err := batch.fileStmt.Exec(currentCommit.Hash, filepath, adds, dels, changeType, oldPath, binary,
+			change.oldMode, change.newMode)
 		if err != nil {
-			return err
+			return 0, err
 		}
+		currentCommit.FilesChanged++
+		currentCommit.Additions += adds.Int64
+		currentCommit.Deletions += dels.Int64
 	}
 
-	if verbose && commitCount > 0 {
-		log.Printf("Processed %d commits", commitCount)
+	if err := scanner.Err(); err != nil {
+		return 0, err
 	}
-
-	return tx.Commit()
+	// A killed git ends its output early, which must not be committed.
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if removed, err := batch.finish(currentCommit, expr); err != nil {
+		return 0, err
+	} else if removed {
+		commitCount--
+	}
+	return commitCount, batch.commit()
 }
 
-func computeComponentContributions(db *sql.DB, components []Component, repos []Repository, repoIDs map[string]int, verbose bool) error {
+// computeComponentContributions aggregates the contributions of commits with
+// a rowid greater than after (every commit when 0) to each component. With
+// after set, they are added to the contributions already computed. The
+// greatest commit rowid is recorded, see contributionsComputed, with opts.
+// Commits of bots are credited apart from those of people, unless excluded.
+// The filters of each component leave commits and files out of it.
+func computeComponentContributions(db *sql.DB, components []Component, repoIDs map[string]int, after int64, opts contributionOptions) error {
+	start := time.Now()
 	type contribKey struct {
 		componentID  int
 		repositoryID int
@@ -410,24 +1995,61 @@ func computeComponentContributions(db *sql.DB, components []Component, repos []R
 		commits   map[string]bool
 		additions int
 		deletions int
+		// coAuthored holds the commits credited by a Co-authored-by
+		// trailer.
+		coAuthored map[string]bool
+		// signed holds the authored commits with a signature.
+		signed map[string]bool
+		// modeChanges counts the file changes altering a file mode.
+		modeChanges int
+		isBot       bool
+		// weighted totals the lines scaled by the weights of the
+		// component.
+		weighted float64
 	})
 
+	coAuthors, err := loadCoAuthors(db, after)
+	if err != nil {
+		return err
+	}
+	resolveIdentity, err := identityResolver(opts.identities)
+	if err != nil {
+		return err
+	}
+
+	// Component dates are in the reporting timezone.
+	cal, err := loadCalendar(db)
+	if err != nil {
+		return err
+	}
+	cat, err := newCategorizer(db, components, repoIDs)
+	if err != nil {
+		return err
+	}
+	var overlaps *overlapResolver
+	if opts.overlaps != "" {
+		overlaps = newOverlapResolver(cat, opts.overlaps)
+	}
+
 	for _, comp := range components {
 		var componentID int
 		err := db.QueryRow("SELECT id FROM components WHERE name = ?", comp.Name).Scan(&componentID)
 		if err != nil {
 			return err
 		}
-
-		patterns := make(map[string][]string)
-		for _, pattern := range comp.Paths {
-			parts := strings.SplitN(pattern, ":", 2)
-			if len(parts) != 2 {
-				continue
+		filter, err := comp.Filters.compile(cal.loc)
+		if err != nil {
+			return fmt.Errorf("component %q: %v", comp.Name, err)
+		}
+		filter.fold = comp.CaseInsensitive
+		index := slices.IndexFunc(cat.components, func(c Component) bool { return c.Name == comp.Name })
+		patterns := splitComponentPatterns(comp.Paths)
+		// The uncategorized component matches every file change, those of
+		// other components skipped below.
+		if comp.Name == uncategorizedComponent {
+			for repoName := range repoIDs {
+				patterns[repoName] = []string{"**"}
 			}
-			repoName := parts[0]
-			pathPattern := parts[1]
-			patterns[repoName] = append(patterns[repoName], pathPattern)
 		}
 
 		for repoName, repoPatterns := range patterns {
@@ -436,51 +2058,105 @@ func computeComponentContributions(db *sql.DB, components []Component, repos []R
 				continue
 			}
 
-			if verbose {
-				log.Printf("Component '%s': checking repo '%s' with patterns: %v", comp.Name, repoName, repoPatterns)
+			slog.Debug("Matching component", "component", comp.Name, "repo", repoName, "patterns", repoPatterns)
+			followed, err := loadFollowedPaths(db, comp, repoName, repoID)
+			if err != nil {
+				return err
 			}
 
 			rows, err := db.Query(`
-				SELECT c.hash, c.author, c.email, fc.additions, fc.deletions, fc.filepath
+				SELECT c.hash, c.author, c.email, c.date, c.is_bot, c.is_outlier, c.signature_status,
+					COALESCE(fc.additions, 0), COALESCE(fc.deletions, 0), fc.filepath,
+					fc.old_mode, fc.new_mode
 				FROM commits c
 				JOIN file_changes fc ON c.hash = fc.commit_hash
-				WHERE c.repository_id = ?
-			`, repoID)
+				WHERE c.repository_id = ? AND c.rowid > ? AND c.duplicate_of = '' AND NOT c.is_ignored
+					AND NOT (? AND fc.generated)
+			`, repoID, after, opts.excludeGenerated)
 			if err != nil {
 				return err
 			}
 
 			matchCount := 0
 			for rows.Next() {
-				var hash, author, email, filepath string
+				var hash, author, email, signature, filepath string
 				var additions, deletions int
-				if err := rows.Scan(&hash, &author, &email, &additions, &deletions, &filepath); err != nil {
+				var date time.Time
+				var modes rawChange
+				var isBot, isOutlier bool
+				if err := rows.Scan(&hash, &author, &email, &date, &isBot, &isOutlier, &signature, &additions, &deletions, &filepath,
+					&modes.oldMode, &modes.newMode); err != nil {
 					rows.Close()
 					return err
 				}
+				if !filter.commit(author, email, date) || !filter.path(repoName, filepath) {
+					continue
+				}
+				if comp.Name == uncategorizedComponent && cat.categorized(repoName, hash, filepath) {
+					continue
+				}
 
-				matched := false
+				matched := followed[hash+"\x00"+filepath]
 				for _, pattern := range repoPatterns {
-					if matchPath(filepath, pattern) {
+					if matchPathFold(filepath, pattern, comp.CaseInsensitive) {
 						matched = true
-						if verbose && matchCount < 5 {
-							log.Printf("  MATCH: %s matches pattern %s", filepath, pattern)
+						if matchCount < 5 {
+							slog.Debug("Matched file", "component", comp.Name, "file", filepath, "pattern", pattern)
 							matchCount++
 						}
 						break
 					}
 				}
 
-				if matched {
-					key := contribKey{componentID, repoID, email}
+				if !matched {
+					continue
+				}
+				if overlaps != nil && index >= 0 {
+					var credited bool
+					if additions, credited = overlaps.credit(index, additions, repoName, hash, filepath); !credited {
+						continue
+					}
+					deletions, _ = overlaps.credit(index, deletions, repoName, hash, filepath)
+				}
+				if isOutlier && opts.outlierLines > 0 {
+					additions, deletions = 0, 0
+				}
+				weighted := float64(additions+deletions) * comp.lineWeight(repoName, filepath)
+				// Co-authors are credited with the whole commit, like its
+				// author.
+				credited := append([]CoAuthor{{author, email, isBot}}, coAuthors[hash]...)
+				var creditedEmails []string
+				for i, person := range credited {
+					if person.isBot && opts.excludeBots {
+						continue
+					}
+					// A co-author may be another alias of the author.
+					person.Author, person.Email = resolveIdentity(person.Author, person.Email)
+					if slices.Contains(creditedEmails, person.Email) {
+						continue
+					}
+					creditedEmails = append(creditedEmails, person.Email)
+					key := contribKey{componentID, repoID, person.Email}
 					contrib := contributions[key]
-					contrib.author = author
+					contrib.author = person.Author
+					contrib.isBot = person.isBot
 					if contrib.commits == nil {
 						contrib.commits = make(map[string]bool)
+						contrib.coAuthored = make(map[string]bool)
+						contrib.signed = make(map[string]bool)
 					}
 					contrib.commits[hash] = true
+					if i > 0 {
+						contrib.coAuthored[hash] = true
+					} else if signature != "" && signature != "N" {
+						contrib.signed[hash] = true
+					}
 					contrib.additions += additions
 					contrib.deletions += deletions
+					contrib.weighted += weighted
+					if modes.oldMode != "" && modes.modeChanged() {
+						contrib.modeChanges++
+					}
 					contributions[key] = contrib
 				}
 			}
@@ -496,79 +2172,66 @@ func computeComponentContributions(db *sql.DB, components []Component, repos []R
 
 	stmt, err := tx.Prepare(`
 		INSERT INTO component_contributions 
-		(component_id, repository_id, author, email, commit_count, total_additions, total_deletions)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
+		(component_id, repository_id, author, email, commit_count, total_additions, total_deletions, co_authored_count, signed_count, mode_change_count, is_bot, weighted_lines)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
+	updateStmt, err := tx.Prepare(`
+		UPDATE component_contributions SET author = ?, is_bot = ?,
+			commit_count = commit_count + ?,
+			total_additions = total_additions + ?,
+			total_deletions = total_deletions + ?,
+			co_authored_count = co_authored_count + ?,
+			signed_count = signed_count + ?,
+			mode_change_count = mode_change_count + ?,
+			weighted_lines = weighted_lines + ?
+		WHERE component_id = ? AND repository_id = ? AND email = ?
+	`)
+	if err != nil {
+		return err
+	}
+	defer updateStmt.Close()
+
 	for key, contrib := range contributions {
+		if after > 0 {
+			result, err := updateStmt.Exec(contrib.author, contrib.isBot, len(contrib.commits), contrib.additions, contrib.deletions,
+				len(contrib.coAuthored), len(contrib.signed), contrib.modeChanges, contrib.weighted, key.componentID, key.repositoryID, key.email)
+			if err != nil {
+				return err
+			}
+			if n, err := result.RowsAffected(); err != nil {
+				return err
+			} else if n > 0 {
+				continue
+			}
+		}
 		_, err := stmt.Exec(key.componentID, key.repositoryID, contrib.author, key.email,
-			len(contrib.commits), contrib.additions, contrib.deletions)
+			len(contrib.commits), contrib.additions, contrib.deletions, len(contrib.coAuthored), len(contrib.signed), contrib.modeChanges,
+			contrib.isBot, contrib.weighted)
 		if err != nil {
 			return err
 		}
 	}
 
-	if verbose {
-		log.Printf("Computed contributions for %d author/component combinations", len(contributions))
-	}
-
-	return tx.Commit()
-}
-
-func matchPath(path, pattern string) bool {
-	// Exact match
-	if path == pattern {
-		return true
-	}
-
-	// Handle ** (match any number of directories)
-	if strings.Contains(pattern, "**") {
-		parts := strings.Split(pattern, "**")
-
-		// Pattern: **/something
-		if len(parts) == 2 && parts[0] == "" {
-			suffix := strings.TrimPrefix(parts[1], "/")
-			if suffix == "" {
-				return true // Just "**" matches everything
-			}
-			return strings.HasSuffix(path, suffix) || strings.Contains(path, "/"+suffix)
-		}
-
-		// Pattern: something/**
-		if len(parts) == 2 && parts[1] == "" {
-			prefix := strings.TrimSuffix(parts[0], "/")
-			return strings.HasPrefix(path, prefix+"/") || path == prefix
-		}
-
-		// Pattern: prefix/**/suffix
-		if len(parts) == 2 {
-			prefix := strings.TrimSuffix(parts[0], "/")
-			suffix := strings.TrimPrefix(parts[1], "/")
-
-			if prefix != "" && !strings.HasPrefix(path, prefix) {
-				return false
-			}
-			if suffix != "" && !strings.HasSuffix(path, suffix) {
-				return false
-			}
-			return true
-		}
+	_, err = tx.Exec(`
+		INSERT INTO contribution_state (id, last_commit_rowid, exclude_bots, outlier_lines, exclude_generated, identities, overlaps)
+		VALUES (1, (SELECT COALESCE(MAX(rowid), 0) FROM commits), ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET last_commit_rowid = excluded.last_commit_rowid,
+			exclude_bots = excluded.exclude_bots, outlier_lines = excluded.outlier_lines,
+			exclude_generated = excluded.exclude_generated, identities = excluded.identities,
+			overlaps = excluded.overlaps
+	`, opts.excludeBots, opts.outlierLines, opts.excludeGenerated, opts.identities, opts.overlaps)
+	if err != nil {
+		return err
 	}
 
-	// Handle single * (match within a single directory level)
-	if strings.Contains(pattern, "*") && !strings.Contains(pattern, "**") {
-		matched, _ := filepath.Match(pattern, path)
-		return matched
+	if err := tx.Commit(); err != nil {
+		return err
 	}
-
-	return false
-}
-
-func simpleMatch(path, pattern string) bool {
-	match, _ := filepath.Match(pattern, path)
-	return match
+	slog.Debug("Computed component contributions", "contributions", len(contributions), "duration", time.Since(start))
+	return nil
 }
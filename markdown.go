@@ -0,0 +1,114 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const markdownTopAuthors = 10
+
+func renderMarkdownReport(db *sql.DB, w io.Writer) error {
+	report, err := loadReport(db)
+	if err != nil {
+		return err
+	}
+	renderMarkdown(w, report)
+	return nil
+}
+
+func renderMarkdown(w io.Writer, report *Report) {
+	fmt.Fprintf(w, "# git-report\n\n")
+	fmt.Fprintf(w, "Generated %s.\n\n", formatDate(report.GeneratedAt))
+
+	fmt.Fprintf(w, "## Repositories\n\n")
+	fmt.Fprintf(w, "| Repository | Commits | Authors | Additions | Deletions | First commit | Last commit |\n")
+	fmt.Fprintf(w, "|---|---:|---:|---:|---:|---|---|\n")
+	for _, repo := range report.Repositories {
+		fmt.Fprintf(w, "| %s | %d | %d | +%d | -%d | %s | %s |\n", markdownEscape(repo.Name),
+			repo.Commits, repo.Authors, repo.Additions, repo.Deletions,
+			formatDate(repo.FirstCommit), formatDate(repo.LastCommit))
+	}
+
+	for _, repo := range report.Repositories {
+		if len(repo.Activity) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\n### %s\n\n", repo.Name)
+		writeMarkdownCharts(w, repo.Activity)
+	}
+
+	fmt.Fprintf(w, "\n## Top authors\n\n")
+	writeMarkdownAuthors(w, report.Authors, markdownTopAuthors)
+
+	if len(report.Teams) > 0 {
+		fmt.Fprintf(w, "\n## Teams\n\n")
+		fmt.Fprintf(w, "| Team | Component | Commits | Contributors | Additions | Deletions |\n")
+		fmt.Fprintf(w, "|---|---|---:|---:|---:|---:|\n")
+		for _, team := range report.Teams {
+			fmt.Fprintf(w, "| %s | %s | %d | %d | +%d | -%d |\n", markdownEscape(team.Team), markdownEscape(team.Component),
+				team.Commits, team.Contributors, team.Additions, team.Deletions)
+		}
+	}
+
+	if len(report.CommitTypes) > 0 {
+		fmt.Fprintf(w, "\n## Commit types\n\n")
+		fmt.Fprintf(w, "| Type | Commits | Breaking | Additions | Deletions |\n")
+		fmt.Fprintf(w, "|---|---:|---:|---:|---:|\n")
+		for _, t := range report.CommitTypes {
+			fmt.Fprintf(w, "| %s | %d | %d | +%d | -%d |\n", markdownEscape(t.Type), t.Commits, t.Breaking, t.Additions, t.Deletions)
+		}
+	}
+
+	if len(report.Components) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "\n## Components\n\n")
+	fmt.Fprintf(w, "| Component | Commits | Contributors | Additions | Deletions |\n")
+	fmt.Fprintf(w, "|---|---:|---:|---:|---:|\n")
+	for _, comp := range report.Components {
+		fmt.Fprintf(w, "| %s | %d | %d | +%d | -%d |\n", markdownEscape(comp.Name),
+			comp.Commits, len(comp.Contributors), comp.Additions, comp.Deletions)
+	}
+
+	for _, comp := range report.Components {
+		if len(comp.Contributors) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\n### %s\n\n", comp.Name)
+		writeMarkdownCharts(w, comp.Activity)
+		writeMarkdownAuthors(w, comp.Contributors, 0)
+	}
+}
+
+// writeMarkdownAuthors writes an authors table, limited to the first limit
+// rows when limit is greater than zero.
+func writeMarkdownAuthors(w io.Writer, authors []AuthorSummary, limit int) {
+	if limit > 0 && len(authors) > limit {
+		authors = authors[:limit]
+	}
+	fmt.Fprintf(w, "| Author | Email | Commits | Additions | Deletions |\n")
+	fmt.Fprintf(w, "|---|---|---:|---:|---:|\n")
+	for _, a := range authors {
+		fmt.Fprintf(w, "| %s | %s | %d | +%d | -%d |\n", markdownEscape(a.Author), markdownEscape(a.Email),
+			a.Commits, a.Additions, a.Deletions)
+	}
+}
+
+// writeMarkdownCharts embeds the activity charts as SVG data URI images.
+func writeMarkdownCharts(w io.Writer, activity []ActivityPoint) {
+	if len(activity) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "![Commits per month](%s)\n\n", svgDataURI(commitsChartSVG(activity)))
+	fmt.Fprintf(w, "![Lines added and deleted per month](%s)\n\n", svgDataURI(linesChartSVG(activity)))
+}
+
+func markdownEscape(s string) string {
+	return strings.ReplaceAll(s, "|", "\\|")
+}
@@ -0,0 +1,529 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+func mergeCommand(args []string) {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	output := fs.String("o", "merged.db", "merged database path")
+	logOpts := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s merge [-o merged.db] <report.db>...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	logOpts.setup()
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	for _, path := range fs.Args() {
+		if path == *output {
+			log.Fatalf("Output database is also an input: %s", path)
+		}
+		if _, err := os.Stat(path); err != nil {
+			log.Fatalf("Failed to open database: %v", err)
+		}
+	}
+
+	os.Remove(*output)
+	db, err := initDatabase(*output)
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+	if err := createSchema(db); err != nil {
+		log.Fatalf("Failed to create schema: %v", err)
+	}
+
+	if err := mergeDatabases(db, fs.Args()); err != nil {
+		log.Fatalf("Failed to merge databases: %v", err)
+	}
+	slog.Info("Merged databases", "inputs", fs.NArg(), "output", *output)
+}
+
+// mergeDatabases copies every input into db. Repositories, components and
+// teams are matched by name, commits by hash: a commit present in several
+// inputs is only copied, with its file changes, from the first one.
+// Component patterns and team members are combined and contributions
+// recomputed from the merged data, with the settings of the inputs. Inputs
+// generated with different settings are rejected.
+func mergeDatabases(db *sql.DB, paths []string) error {
+	var components []Component
+	var teams []Team
+	var settings mergeSettings
+	for i, path := range paths {
+		slog.Info("Merging database", "path", path)
+		if _, err := db.Exec("ATTACH DATABASE ? AS src", "file:"+path+"?mode=ro"); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		srcSettings, err := attachedSettings(db)
+		if err == nil {
+			if i == 0 {
+				settings = srcSettings
+			} else if differ := settings.differ(srcSettings); len(differ) > 0 {
+				err = fmt.Errorf("generated with other settings than %s: %s", paths[0], strings.Join(differ, ", "))
+			}
+		}
+		if err == nil {
+			err = mergeAttached(db, &components, &teams)
+		}
+		if _, detachErr := db.Exec("DETACH DATABASE src"); err == nil {
+			err = detachErr
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	_, err := db.Exec("INSERT INTO report_settings (id, timezone, week_start, fiscal_year_start) VALUES (1, ?, ?, ?)",
+		settings.timezone, settings.weekStart, settings.fiscalStart)
+	if err != nil {
+		return err
+	}
+
+	// The uncategorized component goes after those of every input.
+	if i := slices.IndexFunc(components, func(c Component) bool { return c.Name == uncategorizedComponent }); i >= 0 {
+		uncategorized := components[i]
+		components = append(slices.Delete(components, i, i+1), uncategorized)
+	} else {
+		components = withUncategorized(components)
+	}
+	if err := insertComponents(db, components); err != nil {
+		return err
+	}
+	// Inputs written by older versions lack report dates, their commits
+	// keep the offset of the author.
+	if _, err := db.Exec("UPDATE commits SET report_date = date WHERE report_date = ''"); err != nil {
+		return err
+	}
+	if err := parseCommitTypes(db); err != nil {
+		return err
+	}
+
+	repoIDs := make(map[string]int)
+	rows, err := db.Query("SELECT id, name FROM repositories")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return err
+		}
+		repoIDs[name] = id
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if err := computeComponentContributions(db, components, repoIDs, 0, settings.contributions); err != nil {
+		return err
+	}
+	if _, err := replaceCoverage(db, components, repoIDs); err != nil {
+		return err
+	}
+	if err := replaceOwnership(db, components, repoIDs, settings.contributions); err != nil {
+		return err
+	}
+	if err := replaceBusFactors(db, settings.busFactor); err != nil {
+		return err
+	}
+	if err := replaceTeams(db, teams); err != nil {
+		return err
+	}
+	var companies map[string]string
+	if err := json.Unmarshal([]byte(settings.companies), &companies); err != nil {
+		return err
+	}
+	return replaceCompanyContributions(db, companies)
+}
+
+// mergeSettings are the settings an input database was generated with,
+// those the merged data is recomputed with.
+type mergeSettings struct {
+	contributions contributionOptions
+	busFactor     int
+	// companies is the JSON encoded companies, see
+	// replaceCompanyContributions.
+	companies   string
+	timezone    string
+	weekStart   int
+	fiscalStart int
+}
+
+// attachedSettings returns the settings of the database attached as src.
+// Those it lacks, having been written by an older version, are the
+// defaults.
+func attachedSettings(db *sql.DB) (mergeSettings, error) {
+	s := mergeSettings{
+		busFactor:   defaultBusFactorThreshold,
+		companies:   "{}",
+		weekStart:   int(time.Monday),
+		fiscalStart: int(time.January),
+	}
+	// scan reads the first row of table into dest, columns given as name
+	// and default pairs, those missing read as their default.
+	scan := func(table string, columns []string, dest ...any) error {
+		var exprs []string
+		found := false
+		for i := 0; i < len(columns); i += 2 {
+			var ok bool
+			err := db.QueryRow("SELECT COUNT(*) > 0 FROM pragma_table_info(?, 'src') WHERE name = ?", table, columns[i]).Scan(&ok)
+			if err != nil {
+				return err
+			}
+			if ok {
+				exprs = append(exprs, columns[i])
+				found = true
+			} else {
+				exprs = append(exprs, columns[i+1])
+			}
+		}
+		if !found {
+			return nil
+		}
+		err := db.QueryRow("SELECT " + strings.Join(exprs, ", ") + " FROM src." + table + " LIMIT 1").Scan(dest...)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+	c := &s.contributions
+	err := scan("contribution_state",
+		[]string{"exclude_bots", "0", "outlier_lines", "0", "exclude_generated", "0", "identities", "''", "overlaps", "''"},
+		&c.excludeBots, &c.outlierLines, &c.excludeGenerated, &c.identities, &c.overlaps)
+	if err != nil {
+		return s, err
+	}
+	err = scan("report_settings",
+		[]string{"timezone", "''", "week_start", "1", "fiscal_year_start", "1", "companies", "'{}'"},
+		&s.timezone, &s.weekStart, &s.fiscalStart, &s.companies)
+	if err != nil {
+		return s, err
+	}
+	return s, scan("component_bus_factors", []string{"threshold", "0"}, &s.busFactor)
+}
+
+// differ returns the configuration fields of the settings differing from
+// other.
+func (s mergeSettings) differ(other mergeSettings) []string {
+	var fields []string
+	if s.contributions.excludeBots != other.contributions.excludeBots {
+		fields = append(fields, "bots.exclude")
+	}
+	if s.contributions.outlierLines != other.contributions.outlierLines {
+		fields = append(fields, "outliers")
+	}
+	if s.contributions.excludeGenerated != other.contributions.excludeGenerated {
+		fields = append(fields, "linguist.exclude")
+	}
+	if s.contributions.identities != other.contributions.identities {
+		fields = append(fields, "identities")
+	}
+	if s.contributions.overlapMode() != other.contributions.overlapMode() {
+		fields = append(fields, "overlaps")
+	}
+	if s.busFactor != other.busFactor {
+		fields = append(fields, "bus_factor")
+	}
+	if s.companies != other.companies {
+		fields = append(fields, "companies")
+	}
+	if s.timezone != other.timezone {
+		fields = append(fields, "timezone")
+	}
+	if s.weekStart != other.weekStart || s.fiscalStart != other.fiscalStart {
+		fields = append(fields, "calendar")
+	}
+	return fields
+}
+
+// mergeAttached copies the database attached as src and adds its component
+// patterns to components and its team members to teams.
+func mergeAttached(db *sql.DB, components *[]Component, teams *[]Team) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Databases written by older versions lack the newer tables and
+	// columns.
+	hasTable := func(name string) (bool, error) {
+		var found bool
+		err := tx.QueryRow("SELECT COUNT(*) > 0 FROM src.sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&found)
+		return found, err
+	}
+	commitColumns, err := sharedColumns(tx, "commits")
+	if err != nil {
+		return err
+	}
+	commitColumns = slices.DeleteFunc(commitColumns, func(c string) bool { return c == "repository_id" })
+	fileColumns, err := sharedColumns(tx, "file_changes")
+	if err != nil {
+		return err
+	}
+	fileColumns = slices.DeleteFunc(fileColumns, func(c string) bool { return c == "id" })
+
+	statements := []string{
+		`INSERT OR IGNORE INTO repositories (name, path)
+			SELECT name, path FROM src.repositories ORDER BY id`,
+		// File changes first, while their commits are not merged yet.
+		fmt.Sprintf(`INSERT INTO file_changes (%[1]s)
+			SELECT %[1]s
+			FROM src.file_changes
+			WHERE commit_hash NOT IN (SELECT hash FROM main.commits)
+			ORDER BY id`, strings.Join(fileColumns, ", ")),
+	}
+	if hasParents, err := hasTable("commit_parents"); err != nil {
+		return err
+	} else if hasParents {
+		statements = append(statements,
+			`INSERT OR IGNORE INTO commit_parents (commit_hash, parent_hash, position)
+				SELECT commit_hash, parent_hash, position
+				FROM src.commit_parents
+				WHERE commit_hash NOT IN (SELECT hash FROM main.commits)`,
+		)
+	}
+	if hasCoAuthors, err := hasTable("commit_coauthors"); err != nil {
+		return err
+	} else if hasCoAuthors {
+		coAuthorColumns, err := sharedColumns(tx, "commit_coauthors")
+		if err != nil {
+			return err
+		}
+		statements = append(statements,
+			fmt.Sprintf(`INSERT OR IGNORE INTO commit_coauthors (%[1]s)
+				SELECT %[1]s
+				FROM src.commit_coauthors
+				WHERE commit_hash NOT IN (SELECT hash FROM main.commits)`, strings.Join(coAuthorColumns, ", ")),
+		)
+	}
+	if hasTrailers, err := hasTable("commit_trailers"); err != nil {
+		return err
+	} else if hasTrailers {
+		statements = append(statements,
+			`INSERT OR IGNORE INTO commit_trailers (commit_hash, position, key, value)
+				SELECT commit_hash, position, key, value
+				FROM src.commit_trailers
+				WHERE commit_hash NOT IN (SELECT hash FROM main.commits)`,
+		)
+	}
+	statements = append(statements, fmt.Sprintf(`INSERT OR IGNORE INTO commits (repository_id, %s)
+			SELECT r.id, c.%s
+			FROM src.commits c
+			JOIN src.repositories sr ON sr.id = c.repository_id
+			JOIN main.repositories r ON r.name = sr.name`,
+		strings.Join(commitColumns, ", "), strings.Join(commitColumns, ", c.")))
+	if hasTags, err := hasTable("tags"); err != nil {
+		return err
+	} else if hasTags {
+		statements = append(statements,
+			`INSERT OR IGNORE INTO tags (repository_id, name, commit_hash, date, position)
+				SELECT r.id, t.name, t.commit_hash, t.date, t.position
+				FROM src.tags t
+				JOIN src.repositories sr ON sr.id = t.repository_id
+				JOIN main.repositories r ON r.name = sr.name
+				ORDER BY t.id`,
+			`INSERT OR IGNORE INTO tag_commits (tag_id, commit_hash)
+				SELECT mt.id, tc.commit_hash
+				FROM src.tag_commits tc
+				JOIN src.tags t ON t.id = tc.tag_id
+				JOIN src.repositories sr ON sr.id = t.repository_id
+				JOIN main.repositories r ON r.name = sr.name
+				JOIN main.tags mt ON mt.repository_id = r.id AND mt.name = t.name`,
+		)
+	}
+	if hasBranches, err := hasTable("branches"); err != nil {
+		return err
+	} else if hasBranches {
+		statements = append(statements,
+			`INSERT OR IGNORE INTO branches (repository_id, name, tip, last_commit_date, ahead, behind, is_default)
+				SELECT r.id, b.name, b.tip, b.last_commit_date, b.ahead, b.behind, b.is_default
+				FROM src.branches b
+				JOIN src.repositories sr ON sr.id = b.repository_id
+				JOIN main.repositories r ON r.name = sr.name
+				ORDER BY b.id`,
+		)
+	}
+	if hasFollowed, err := hasTable("followed_paths"); err != nil {
+		return err
+	} else if hasFollowed {
+		statements = append(statements,
+			`INSERT OR IGNORE INTO followed_paths (repository_id, path, commit_hash, filepath)
+				SELECT r.id, f.path, f.commit_hash, f.filepath
+				FROM src.followed_paths f
+				JOIN src.repositories sr ON sr.id = f.repository_id
+				JOIN main.repositories r ON r.name = sr.name`,
+		)
+	}
+	if hasOwnership, err := hasTable("file_ownership"); err != nil {
+		return err
+	} else if hasOwnership {
+		statements = append(statements,
+			`INSERT OR IGNORE INTO file_ownership (repository_id, filepath, author, email, lines, is_bot)
+				SELECT r.id, o.filepath, o.author, o.email, o.lines, o.is_bot
+				FROM src.file_ownership o
+				JOIN src.repositories sr ON sr.id = o.repository_id
+				JOIN main.repositories r ON r.name = sr.name`,
+		)
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	componentColumns, err := sharedColumns(tx, "components")
+	if err != nil {
+		return err
+	}
+	filtersColumn := "''"
+	if slices.Contains(componentColumns, "filters") {
+		filtersColumn = "filters"
+	}
+	followColumn := "0"
+	if slices.Contains(componentColumns, "follow") {
+		followColumn = "follow"
+	}
+	caseColumn := "0"
+	if slices.Contains(componentColumns, "case_insensitive") {
+		caseColumn = "case_insensitive"
+	}
+	parentColumn := "''"
+	if slices.Contains(componentColumns, "parent_id") {
+		parentColumn = "COALESCE((SELECT p.name FROM src.components p WHERE p.id = c.parent_id), '')"
+	}
+	weightColumns := "1, ''"
+	if slices.Contains(componentColumns, "weight") {
+		weightColumns = "weight, path_weights"
+	}
+	languageColumn := "0"
+	if slices.Contains(componentColumns, "is_language") {
+		languageColumn = "is_language"
+	}
+	rows, err := tx.Query("SELECT name, path_patterns, " + filtersColumn + ", " + followColumn + ", " + caseColumn + ", " + parentColumn +
+		", " + weightColumns + ", " + languageColumn + " FROM src.components c ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, encoded, encodedFilters, parent, encodedWeights string
+		var follow, caseInsensitive, language bool
+		var weight float64
+		if err := rows.Scan(&name, &encoded, &encodedFilters, &follow, &caseInsensitive, &parent, &weight, &encodedWeights, &language); err != nil {
+			return err
+		}
+		var paths []string
+		if err := json.Unmarshal([]byte(encoded), &paths); err != nil {
+			return err
+		}
+		filters, err := decodeComponentFilters(encodedFilters)
+		if err != nil {
+			return err
+		}
+		weights, err := decodePathWeights(encodedWeights)
+		if err != nil {
+			return err
+		}
+		i := slices.IndexFunc(*components, func(c Component) bool { return c.Name == name })
+		if i < 0 {
+			// The filters, parent and weights of the first database
+			// defining the component apply.
+			*components = append(*components, Component{Name: name, Filters: filters, Parent: parent, Weight: weight, Weights: weights,
+				language: language})
+			i = len(*components) - 1
+		}
+		if follow {
+			(*components)[i].Follow = true
+		}
+		if caseInsensitive {
+			(*components)[i].CaseInsensitive = true
+		}
+		for _, path := range paths {
+			if !slices.Contains((*components)[i].Paths, path) {
+				(*components)[i].Paths = append((*components)[i].Paths, path)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	if hasTeams, err := hasTable("teams"); err != nil {
+		return err
+	} else if hasTeams {
+		rows, err := tx.Query("SELECT name, members FROM src.teams ORDER BY id")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var name, encoded string
+			if err := rows.Scan(&name, &encoded); err != nil {
+				return err
+			}
+			var members []string
+			if err := json.Unmarshal([]byte(encoded), &members); err != nil {
+				return err
+			}
+			i := slices.IndexFunc(*teams, func(t Team) bool { return t.Name == name })
+			if i < 0 {
+				*teams = append(*teams, Team{Name: name})
+				i = len(*teams) - 1
+			}
+			for _, member := range members {
+				if !slices.Contains((*teams)[i].Members, member) {
+					(*teams)[i].Members = append((*teams)[i].Members, member)
+				}
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+	}
+
+	return tx.Commit()
+}
+
+// sharedColumns returns the columns of a table found both in the main and
+// the attached src database.
+func sharedColumns(tx *sql.Tx, table string) ([]string, error) {
+	rows, err := tx.Query(`
+		SELECT name FROM pragma_table_info(?, 'main')
+		WHERE name IN (SELECT name FROM pragma_table_info(?, 'src'))
+		ORDER BY cid
+	`, table, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var columns []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns = append(columns, name)
+	}
+	return columns, rows.Err()
+}
@@ -0,0 +1,166 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type metricSample struct {
+	labels []string // name, value pairs
+	value  float64
+}
+
+type metric struct {
+	name    string
+	help    string
+	samples []metricSample
+}
+
+func metricsHandler(db *sql.DB) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		metrics, err := loadMetrics(db, time.Now())
+		if err != nil {
+			log.Printf("Metrics error: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		bw := bufio.NewWriter(w)
+		writeMetrics(bw, metrics)
+		bw.Flush()
+	})
+}
+
+// loadMetrics builds the exported gauges. Ages are relative to now.
+func loadMetrics(db *sql.DB, now time.Time) ([]metric, error) {
+	repoCommits := metric{name: "git_report_repository_commits", help: "Number of commits in the repository."}
+	repoAdditions := metric{name: "git_report_repository_additions", help: "Lines added in the repository."}
+	repoDeletions := metric{name: "git_report_repository_deletions", help: "Lines deleted in the repository."}
+	repoAuthors := metric{name: "git_report_repository_authors", help: "Number of distinct authors in the repository."}
+	repoAge := metric{name: "git_report_repository_last_commit_age_seconds", help: "Seconds since the last commit in the repository."}
+
+	repos, err := loadRepositorySummaries(db)
+	if err != nil {
+		return nil, err
+	}
+	for _, repo := range repos {
+		labels := []string{"repository", repo.Name}
+		repoCommits.samples = append(repoCommits.samples, metricSample{labels, float64(repo.Commits)})
+		repoAdditions.samples = append(repoAdditions.samples, metricSample{labels, float64(repo.Additions)})
+		repoDeletions.samples = append(repoDeletions.samples, metricSample{labels, float64(repo.Deletions)})
+		repoAuthors.samples = append(repoAuthors.samples, metricSample{labels, float64(repo.Authors)})
+		if !repo.LastCommit.IsZero() {
+			repoAge.samples = append(repoAge.samples, metricSample{labels, now.Sub(repo.LastCommit).Seconds()})
+		}
+	}
+
+	compCommits := metric{name: "git_report_component_commits", help: "Number of commits touching the component, per repository."}
+	compAdditions := metric{name: "git_report_component_additions", help: "Lines added in the component, per repository."}
+	compDeletions := metric{name: "git_report_component_deletions", help: "Lines deleted in the component, per repository."}
+	compContributors := metric{name: "git_report_component_contributors", help: "Number of distinct contributors to the component, per repository."}
+	compAge := metric{name: "git_report_component_last_commit_age_seconds", help: "Seconds since the last commit touching the component, per repository."}
+
+	rows, err := db.Query(`
+		SELECT c.name, r.name, SUM(cc.commit_count), SUM(cc.total_additions),
+			SUM(cc.total_deletions), COUNT(DISTINCT cc.email)
+		FROM component_contributions cc
+		JOIN components c ON c.id = cc.component_id
+		JOIN repositories r ON r.id = cc.repository_id
+		GROUP BY c.id, r.id
+		ORDER BY c.name, r.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var comp, repo string
+		var commits, additions, deletions, contributors int
+		if err := rows.Scan(&comp, &repo, &commits, &additions, &deletions, &contributors); err != nil {
+			return nil, err
+		}
+		labels := []string{"component", comp, "repository", repo}
+		compCommits.samples = append(compCommits.samples, metricSample{labels, float64(commits)})
+		compAdditions.samples = append(compAdditions.samples, metricSample{labels, float64(additions)})
+		compDeletions.samples = append(compDeletions.samples, metricSample{labels, float64(deletions)})
+		compContributors.samples = append(compContributors.samples, metricSample{labels, float64(contributors)})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	lastCommits, err := loadComponentLastCommits(db)
+	if err != nil {
+		return nil, err
+	}
+	for _, sample := range compCommits.samples {
+		last, ok := lastCommits[[2]string{sample.labels[1], sample.labels[3]}]
+		if ok {
+			compAge.samples = append(compAge.samples, metricSample{sample.labels, now.Sub(last).Seconds()})
+		}
+	}
+
+	return []metric{
+		repoCommits, repoAdditions, repoDeletions, repoAuthors, repoAge,
+		compCommits, compAdditions, compDeletions, compContributors, compAge,
+	}, nil
+}
+
+// loadComponentLastCommits returns the date of the last commit touching each
+// component, keyed by component and repository name.
+func loadComponentLastCommits(db *sql.DB) (map[[2]string]time.Time, error) {
+	components, err := loadComponentPatterns(db)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := queryChanges(db, reportFilter{})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	b := newReportBuilder(components, "")
+	last := make(map[[2]string]time.Time)
+	for rows.Next() {
+		row, err := scanChangeRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range b.matching(row) {
+			key := [2]string{name, row.Repository}
+			if row.Date.After(last[key]) {
+				last[key] = row.Date
+			}
+		}
+	}
+	return last, rows.Err()
+}
+
+// writeMetrics writes metrics in the Prometheus text exposition format.
+func writeMetrics(w io.Writer, metrics []metric) {
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(w, "# TYPE %s gauge\n", m.name)
+		for _, s := range m.samples {
+			var labels []string
+			for i := 0; i+1 < len(s.labels); i += 2 {
+				labels = append(labels, fmt.Sprintf("%s=\"%s\"", s.labels[i], metricLabelEscape(s.labels[i+1])))
+			}
+			fmt.Fprintf(w, "%s{%s} %g\n", m.name, strings.Join(labels, ","), s.value)
+		}
+	}
+}
+
+func metricLabelEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
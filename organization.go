@@ -0,0 +1,38 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+)
+
+// classifyAffiliations sets the affiliation of every component contribution
+// from its email domain: internal for the organization domains and their
+// subdomains, external otherwise, or empty without domains. It only depends
+// on the email, so it is done on every run, contributions aggregated before
+// included.
+func classifyAffiliations(db *sql.DB, domains []string) error {
+	if len(domains) == 0 {
+		_, err := db.Exec("UPDATE component_contributions SET affiliation = ''")
+		return err
+	}
+	lower := make([]string, len(domains))
+	for i, domain := range domains {
+		lower[i] = strings.ToLower(strings.TrimPrefix(domain, "@"))
+	}
+	encoded, err := json.Marshal(lower)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		UPDATE component_contributions SET affiliation = CASE WHEN EXISTS (
+			SELECT 1 FROM json_each(?) d
+			WHERE lower(substr(email, instr(email, '@') + 1)) = d.value
+				OR lower(substr(email, instr(email, '@') + 1)) LIKE '%.' || d.value
+		) THEN 'internal' ELSE 'external' END
+	`, string(encoded))
+	return err
+}
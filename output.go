@@ -0,0 +1,278 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Output struct {
+	Path   string `yaml:"path"`
+	Format string `yaml:"format"`
+	// Upload is an s3:// or gs:// URL prefix the output is copied to after
+	// generation.
+	Upload string `yaml:"upload"`
+}
+
+// UnmarshalYAML accepts either a plain path or an output mapping.
+func (o *Output) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&o.Path)
+	}
+	type plain Output
+	if err := checkKnownFields(value, o); err != nil {
+		return err
+	}
+	return value.Decode((*plain)(o))
+}
+
+// Outputs lists every target written by a single run.
+type Outputs []Output
+
+// UnmarshalYAML accepts a list of outputs, or a single output where the path
+// names the database and a non-sqlite format is rendered next to it.
+func (o *Outputs) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.SequenceNode {
+		var list []Output
+		if err := value.Decode(&list); err != nil {
+			return err
+		}
+		*o = list
+		return nil
+	}
+
+	var single Output
+	if err := value.Decode(&single); err != nil {
+		return err
+	}
+	format, ok := reportFormats[single.Format]
+	if !ok {
+		*o = Outputs{single}
+		return nil
+	}
+	if single.Path == "" {
+		single.Path = "report.db"
+	}
+	if single.Path == stdoutPath || strings.HasSuffix(single.Path, format.ext) {
+		*o = Outputs{single}
+		return nil
+	}
+	*o = Outputs{
+		{Path: single.Path, Format: "sqlite", Upload: single.Upload},
+		{Path: derivedOutputPath(single.Path, single.Format), Format: single.Format, Upload: single.Upload},
+	}
+	return nil
+}
+
+type reportFormat struct {
+	// ext is appended to the database path, without its own extension, to
+	// name outputs derived from it. It also identifies the format of output
+	// paths. Directory formats use a suffix instead of an extension.
+	ext string
+	// write creates the output at path. When nil, render is used to write a
+	// single file.
+	write func(db *sql.DB, path string) error
+	// render writes single file output, also used to stream to stdout.
+	render func(db *sql.DB, w io.Writer) error
+}
+
+var reportFormats = map[string]reportFormat{
+	"html":     {".html", nil, renderHTMLReport},
+	"markdown": {".md", nil, renderMarkdownReport},
+	"csv":      {"-csv", writeCSVExport, renderCSVFlat},
+	"json":     {".json", nil, renderJSONExport},
+	"pdf":      {".pdf", nil, renderPDFReport},
+	"xlsx":     {".xlsx", nil, renderXLSXExport},
+	"sql":      {".sql", nil, dumpSQL},
+	"site":     {"-site", writeSite, nil},
+	"badges":   {"-badges", writeBadges, nil},
+	"digest":   {".digest.md", nil, renderDigestReport},
+}
+
+// stdoutPath is the output path used to stream a report to stdout.
+const stdoutPath = "-"
+
+var sqliteExtensions = []string{".db", ".sqlite", ".sqlite3"}
+
+func derivedOutputPath(dbPath, format string) string {
+	return strings.TrimSuffix(dbPath, filepath.Ext(dbPath)) + reportFormats[format].ext
+}
+
+// inferFormat returns the output format for path based on its extension,
+// preferring the longest matching one (.digest.md over .md).
+func inferFormat(path string) string {
+	for _, ext := range sqliteExtensions {
+		if strings.HasSuffix(path, ext) {
+			return "sqlite"
+		}
+	}
+	name, longest := "", 0
+	for format, rf := range reportFormats {
+		if strings.HasPrefix(rf.ext, ".") && strings.HasSuffix(path, rf.ext) && len(rf.ext) > longest {
+			name, longest = format, len(rf.ext)
+		}
+	}
+	return name
+}
+
+// normalize fills in defaults and infers missing formats from the paths.
+func (o Outputs) normalize() (Outputs, error) {
+	if len(o) == 0 {
+		return Outputs{{Path: "report.db", Format: "sqlite"}}, nil
+	}
+
+	sqliteOutputs, stdoutOutputs := 0, 0
+	for i := range o {
+		if o[i].Path == "" {
+			if o[i].Format != "" && o[i].Format != "sqlite" {
+				return nil, fmt.Errorf("output path is required for format: %s", o[i].Format)
+			}
+			o[i].Path = "report.db"
+		}
+		if o[i].Path == stdoutPath && o[i].Format == "" {
+			o[i].Format = "json"
+		}
+		if o[i].Format == "" {
+			o[i].Format = inferFormat(o[i].Path)
+			if o[i].Format == "" {
+				return nil, fmt.Errorf("cannot infer output format: %s", o[i].Path)
+			}
+		}
+		if _, ok := reportFormats[o[i].Format]; !ok && o[i].Format != "sqlite" {
+			return nil, fmt.Errorf("unknown output format: %s", o[i].Format)
+		}
+		if o[i].Format == "sqlite" {
+			sqliteOutputs++
+		}
+		if o[i].Upload != "" {
+			if o[i].Path == stdoutPath {
+				return nil, fmt.Errorf("output written to stdout cannot be uploaded")
+			}
+			if err := validateUploadURL(o[i].Upload); err != nil {
+				return nil, err
+			}
+		}
+		if o[i].Path == stdoutPath {
+			if o[i].Format == "sqlite" || reportFormats[o[i].Format].render == nil {
+				return nil, fmt.Errorf("output format cannot be written to stdout: %s", o[i].Format)
+			}
+			stdoutOutputs++
+		}
+	}
+	if sqliteOutputs > 1 {
+		return nil, fmt.Errorf("only one sqlite output is allowed")
+	}
+	if stdoutOutputs > 1 {
+		return nil, fmt.Errorf("only one output can be written to stdout")
+	}
+	return o, nil
+}
+
+// databasePath returns the sqlite output path, or ":memory:" when only
+// rendered outputs are requested.
+func (o Outputs) databasePath() string {
+	for _, out := range o {
+		if out.Format == "sqlite" {
+			return out.Path
+		}
+	}
+	return ":memory:"
+}
+
+// base is the output others are derived from when added from the command
+// line.
+func (o Outputs) base() Output {
+	for _, out := range o {
+		if out.Format == "sqlite" {
+			return out
+		}
+	}
+	for _, out := range o {
+		if out.Path != stdoutPath {
+			return out
+		}
+	}
+	return Output{Path: "report.db"}
+}
+
+// add appends a format derived from the base output unless already present.
+// The new output is uploaded along with the base one.
+func (o Outputs) add(format string) Outputs {
+	for _, out := range o {
+		if out.Format == format {
+			return o
+		}
+	}
+	base := o.base()
+	return append(o, Output{Path: derivedOutputPath(base.Path, format), Format: format, Upload: base.Upload})
+}
+
+// createDirs creates the missing parent directories of every output.
+func (o Outputs) createDirs() error {
+	for _, out := range o {
+		if out.Path == stdoutPath {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(out.Path), 0o755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streaming reports whether any output is written to stdout.
+func (o Outputs) streaming() bool {
+	for _, out := range o {
+		if out.Path == stdoutPath {
+			return true
+		}
+	}
+	return false
+}
+
+// writeReport renders the database contents for a single output. The sqlite
+// output is the database itself and needs no extra work.
+func writeReport(db *sql.DB, output Output) error {
+	format, ok := reportFormats[output.Format]
+	if !ok {
+		return nil
+	}
+	slog.Info("Writing report", "format", output.Format, "path", output.Path)
+
+	if output.Path == stdoutPath {
+		w := bufio.NewWriter(os.Stdout)
+		if err := format.render(db, w); err != nil {
+			return err
+		}
+		return w.Flush()
+	}
+
+	if format.write != nil {
+		return format.write(db, output.Path)
+	}
+
+	f, err := os.Create(output.Path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := format.render(db, w); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,162 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// overlapModes are the ways of crediting the file changes matching several
+// components, see Config.Overlaps.
+var overlapModes = []string{"double-count", "first-match", "split"}
+
+// overlapResolver tells the share of the lines of a file change matching
+// several components credited to each of them. Components nested in one
+// another do not overlap, the contributions of children being rolled up to
+// their parents.
+type overlapResolver struct {
+	cat  *categorizer
+	mode string
+	// ancestors holds the indexes of the ancestors of every component.
+	ancestors [][]int
+	// matched caches the components matched by the file changes, keyed by
+	// repository name, hash and path separated by NUL bytes.
+	matched map[string][]int
+}
+
+func newOverlapResolver(cat *categorizer, mode string) *overlapResolver {
+	r := &overlapResolver{cat: cat, mode: mode, matched: make(map[string][]int)}
+	for _, comp := range cat.components {
+		var ancestors []int
+		for _, name := range componentAncestors(cat.components, comp.Name) {
+			if i := slices.IndexFunc(cat.components, func(c Component) bool { return c.Name == name }); i >= 0 {
+				ancestors = append(ancestors, i)
+			}
+		}
+		r.ancestors = append(r.ancestors, ancestors)
+	}
+	return r
+}
+
+// overlapping returns the components the change to path in the commit hash
+// of repoName matches, leaving out those nested components are matched in:
+// more than one means they overlap.
+func (r *overlapResolver) overlapping(repoName, hash, path string) []int {
+	key := repoName + "\x00" + hash + "\x00" + path
+	if leaves, ok := r.matched[key]; ok {
+		return leaves
+	}
+	leaves := r.leaves(r.cat.matching(repoName, hash, path))
+	r.matched[key] = leaves
+	return leaves
+}
+
+// leaves returns the matched components that no other matched component is
+// nested in.
+func (r *overlapResolver) leaves(matched []int) []int {
+	var leaves []int
+	for _, i := range matched {
+		if !slices.ContainsFunc(matched, func(j int) bool { return slices.Contains(r.ancestors[j], i) }) {
+			leaves = append(leaves, i)
+		}
+	}
+	return leaves
+}
+
+// credit returns how many of the lines of the change to path in the commit
+// hash of repoName are credited to the component i, and whether the change
+// is credited to it at all. Split lines are rounded down, the remainder
+// going to the first overlapping component, so their sum is kept.
+func (r *overlapResolver) credit(i, lines int, repoName, hash, path string) (int, bool) {
+	leaves := r.overlapping(repoName, hash, path)
+	if len(leaves) == 0 {
+		return lines, true
+	}
+	if r.mode == "first-match" {
+		leaves = leaves[:1]
+	}
+	covers := func(leaf int) bool { return leaf == i || slices.Contains(r.ancestors[leaf], i) }
+	credited := 0
+	for _, leaf := range leaves {
+		if covers(leaf) {
+			credited++
+		}
+	}
+	if credited == 0 {
+		return 0, false
+	}
+	if r.mode != "split" {
+		return lines, true
+	}
+	share := lines / len(leaves) * credited
+	if covers(leaves[0]) {
+		share += lines % len(leaves)
+	}
+	return share, true
+}
+
+// OverlapSummary is a path of a repository matching several components.
+type OverlapSummary struct {
+	Repository  string
+	Path        string
+	Components  []string
+	FileChanges int
+}
+
+// loadOverlaps returns the paths matching several components, those changed
+// the most first, none for databases written before they were detected.
+func loadOverlaps(db *sql.DB) ([]OverlapSummary, error) {
+	var found bool
+	err := db.QueryRow("SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'component_overlaps'").Scan(&found)
+	if err != nil || !found {
+		return nil, err
+	}
+	rows, err := db.Query(`
+		SELECT r.name, o.filepath, o.components, o.file_changes
+		FROM component_overlaps o
+		JOIN repositories r ON r.id = o.repository_id
+		ORDER BY o.file_changes DESC, r.name, o.filepath
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var overlaps []OverlapSummary
+	for rows.Next() {
+		var o OverlapSummary
+		var components string
+		if err := rows.Scan(&o.Repository, &o.Path, &components, &o.FileChanges); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(components), &o.Components); err != nil {
+			return nil, err
+		}
+		overlaps = append(overlaps, o)
+	}
+	return overlaps, rows.Err()
+}
+
+// renderOverlaps lists the paths matching several components changed the
+// most.
+func renderOverlaps(w io.Writer, overlaps []OverlapSummary) {
+	if len(overlaps) == 0 {
+		return
+	}
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "OVERLAPPING PATH\tCOMPONENTS\tCHANGES")
+	for _, o := range overlaps[:min(summaryTop, len(overlaps))] {
+		fmt.Fprintf(tw, "%s:%s\t%s\t%d\n", o.Repository, o.Path, strings.Join(o.Components, ", "), o.FileChanges)
+	}
+	tw.Flush()
+	if more := len(overlaps) - summaryTop; more > 0 {
+		fmt.Fprintf(w, "... and %d more\n", more)
+	}
+}
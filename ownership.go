@@ -0,0 +1,255 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// blameOwner is an author of lines of a file at the ingested revision.
+type blameOwner struct {
+	author string
+	email  string
+}
+
+// blameFiles returns the text files of a repository at revision, limited by
+// the filters.paths and filters.exclude_paths pathspecs. Empty files are
+// left out, having no lines to own.
+func blameFiles(ctx context.Context, repo Repository, revision string, filters Filters) ([]string, error) {
+	args := []string{"grep", "-I", "-l", "-z", "-e", "", revision}
+	args = append(args, pathspecArgs(filters)...)
+	output, err := gitCommandContext(ctx, repo.Path, args...).Output()
+	if err != nil {
+		// git grep exits with 1 when nothing matches.
+		if len(output) == 0 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("git grep failed: %v", err)
+	}
+	var files []string
+	for name := range strings.SplitSeq(strings.TrimSuffix(string(output), "\x00"), "\x00") {
+		files = append(files, strings.TrimPrefix(name, revision+":"))
+	}
+	return files, nil
+}
+
+// blameFile returns how many lines of path at revision every author last
+// changed, the ignored commits passed through to git blame.
+func blameFile(ctx context.Context, repo Repository, revision, path string, ignored []string, ignoreWhitespace bool) (map[blameOwner]int, error) {
+	args := []string{"blame", "--line-porcelain"}
+	if ignoreWhitespace {
+		args = append(args, "-w")
+	}
+	for _, hash := range ignored {
+		args = append(args, "--ignore-rev", hash)
+	}
+	args = append(args, revision, "--", path)
+	output, err := gitCommandContext(ctx, repo.Path, args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git blame %s failed: %v", path, err)
+	}
+	lines := make(map[blameOwner]int)
+	var author string
+	for line := range strings.Lines(string(output)) {
+		// Every line of the file repeats the headers of its commit, the
+		// author mail coming after the author name.
+		if name, ok := strings.CutPrefix(line, "author "); ok {
+			author = strings.TrimSpace(name)
+		} else if mail, ok := strings.CutPrefix(line, "author-mail "); ok {
+			lines[blameOwner{author, strings.Trim(strings.TrimSpace(mail), "<>")}]++
+		}
+	}
+	return lines, nil
+}
+
+// replaceFileOwnership recomputes, with ingest.blame, the lines of the files
+// of every repository at the ingested revision last changed by each author,
+// the ignored commits skipped over. Without it, the ownership is cleared.
+func (c *Config) replaceFileOwnership(ctx context.Context, db *sql.DB, repoIDs map[string]int, isBot func(author, email string) bool) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM file_ownership"); err != nil {
+		return err
+	}
+	if !c.Ingest.Blame {
+		return tx.Commit()
+	}
+	for _, repo := range c.Repositories {
+		repoID, ok := repoIDs[repo.Name]
+		if !ok {
+			continue
+		}
+		var ignored []string
+		rows, err := tx.Query("SELECT hash FROM commits WHERE repository_id = ? AND is_ignored", repoID)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var hash string
+			if err := rows.Scan(&hash); err != nil {
+				rows.Close()
+				return err
+			}
+			ignored = append(ignored, hash)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		files, err := blameFiles(ctx, repo, c.Filters.revision(), c.Filters)
+		if err != nil {
+			return fmt.Errorf("%s: %v", repo.Name, err)
+		}
+		slog.Info("Blaming files", "repo", repo.Name, "files", len(files))
+		for _, path := range files {
+			owners, err := blameFile(ctx, repo, c.Filters.revision(), path, ignored, c.Filters.IgnoreWhitespace)
+			if err != nil {
+				return fmt.Errorf("%s: %v", repo.Name, err)
+			}
+			for owner, lines := range owners {
+				_, err := tx.Exec(`
+					INSERT INTO file_ownership (repository_id, filepath, author, email, lines, is_bot)
+					VALUES (?, ?, ?, ?, ?, ?)
+				`, repoID, path, owner.author, owner.email, lines, isBot(owner.author, owner.email))
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// replaceOwnership recomputes the lines of every component each author
+// owns from the file ownership, authors credited as their identity and the
+// lines of files matching several components credited as in component
+// contributions. Those matching none, language components aside, go to the
+// uncategorized component.
+func replaceOwnership(db *sql.DB, components []Component, repoIDs map[string]int, opts contributionOptions) error {
+	resolveIdentity, err := identityResolver(opts.identities)
+	if err != nil {
+		return err
+	}
+	cat, err := newCategorizer(db, components, repoIDs)
+	if err != nil {
+		return err
+	}
+	var overlaps *overlapResolver
+	if opts.overlaps != "" {
+		overlaps = newOverlapResolver(cat, opts.overlaps)
+	}
+	componentIDs := make(map[string]int)
+	var languageComponents []Component
+	for _, comp := range components {
+		var id int
+		if err := db.QueryRow("SELECT id FROM components WHERE name = ?", comp.Name).Scan(&id); err != nil {
+			return err
+		}
+		componentIDs[comp.Name] = id
+		if comp.language {
+			languageComponents = append(languageComponents, comp)
+		}
+	}
+
+	type ownershipKey struct {
+		componentID  int
+		repositoryID int
+		email        string
+	}
+	type owned struct {
+		author string
+		lines  int
+		isBot  bool
+	}
+	ownership := make(map[ownershipKey]*owned)
+	for repoName, repoID := range repoIDs {
+		rows, err := db.Query("SELECT filepath, author, email, lines, is_bot FROM file_ownership WHERE repository_id = ?", repoID)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var path, author, email string
+			var lines int
+			var isBot bool
+			if err := rows.Scan(&path, &author, &email, &lines, &isBot); err != nil {
+				rows.Close()
+				return err
+			}
+			if isBot && opts.excludeBots {
+				continue
+			}
+			author, email = resolveIdentity(author, email)
+			credit := func(name string, lines int) {
+				componentID, ok := componentIDs[name]
+				if !ok {
+					return
+				}
+				key := ownershipKey{componentID, repoID, email}
+				o, ok := ownership[key]
+				if !ok {
+					o = &owned{author: author}
+					ownership[key] = o
+				}
+				o.lines += lines
+				o.isBot = o.isBot || isBot
+			}
+			// Language components break down every file apart from the
+			// others.
+			for _, comp := range languageComponents {
+				if slices.ContainsFunc(splitComponentPatterns(comp.Paths)[repoName], func(pattern string) bool { return matchPath(path, pattern) }) {
+					credit(comp.Name, lines)
+				}
+			}
+			// Blamed files are keyed by path alone, with no commit to
+			// look followed names up by.
+			matched := cat.matching(repoName, "", path)
+			if len(matched) == 0 {
+				credit(uncategorizedComponent, lines)
+				continue
+			}
+			for _, i := range matched {
+				credited := lines
+				if overlaps != nil {
+					var ok bool
+					if credited, ok = overlaps.credit(i, lines, repoName, "", path); !ok {
+						continue
+					}
+				}
+				credit(cat.components[i].Name, credited)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM component_ownership"); err != nil {
+		return err
+	}
+	for key, o := range ownership {
+		_, err := tx.Exec(`
+			INSERT INTO component_ownership (component_id, repository_id, author, email, lines, is_bot)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, key.componentID, key.repositoryID, o.author, key.email, o.lines, o.isBot)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,122 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// ingestPatchIDs records the patch id of the commits of a repository that
+// have none yet, so the same change picked onto several branches or
+// repositories can be recognized. Merges are left out, their diff belongs
+// to the merged commits.
+func ingestPatchIDs(ctx context.Context, db *sql.DB, repo Repository, repoID int) error {
+	rows, err := db.QueryContext(ctx, `
+		SELECT hash FROM commits
+		WHERE repository_id = ? AND patch_id = '' AND is_merge = 0 AND files_changed > 0
+	`, repoID)
+	if err != nil {
+		return err
+	}
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			rows.Close()
+			return err
+		}
+		hashes = append(hashes, hash)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	// git patch-id reads the patches git diff-tree writes, each one
+	// following the hash of its commit.
+	diff := gitCommandContext(ctx, repo.Path, "diff-tree", "--stdin", "-p", "--root")
+	diff.Stdin = strings.NewReader(strings.Join(hashes, "\n") + "\n")
+	patchID := gitCommandContext(ctx, repo.Path, "patch-id", "--stable")
+	if patchID.Stdin, err = diff.StdoutPipe(); err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	diff.Stderr = &stderr
+	stdout, err := patchID.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := diff.Start(); err != nil {
+		return fmt.Errorf("git diff-tree failed: %v", err)
+	}
+	if err := patchID.Start(); err != nil {
+		diff.Process.Kill()
+		diff.Wait()
+		return fmt.Errorf("git patch-id failed: %v", err)
+	}
+
+	ids := make(map[string]string, len(hashes))
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		// "<patch id> <commit>"
+		if id, hash, ok := strings.Cut(scanner.Text(), " "); ok {
+			ids[hash] = id
+		}
+	}
+	if err := diff.Wait(); err != nil {
+		patchID.Wait()
+		return fmt.Errorf("git diff-tree failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if err := patchID.Wait(); err != nil {
+		return fmt.Errorf("git patch-id failed: %v", err)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare("UPDATE commits SET patch_id = ? WHERE hash = ?")
+	if err != nil {
+		return err
+	}
+	for hash, id := range ids {
+		if _, err := stmt.Exec(id, hash); err != nil {
+			return err
+		}
+	}
+	slog.Info("Computed patch ids", "repo", repo.Name, "commits", len(ids))
+	return tx.Commit()
+}
+
+// markDuplicates links every commit to the earliest one with the same patch
+// id, in any repository, of which it is a duplicate, e.g. a cherry-pick onto
+// a release branch. Commits with the same date, as cherry-picks keep the
+// author date, go to the one ingested first.
+func markDuplicates(db *sql.DB) error {
+	_, err := db.Exec(`
+		UPDATE commits SET duplicate_of = COALESCE((
+			SELECT o.hash FROM commits o
+			WHERE o.patch_id = commits.patch_id
+				AND (julianday(o.date) < julianday(commits.date)
+					OR (julianday(o.date) = julianday(commits.date) AND o.rowid < commits.rowid))
+			ORDER BY julianday(o.date), o.rowid
+			LIMIT 1
+		), '')
+		WHERE patch_id != ''
+	`)
+	return err
+}
@@ -0,0 +1,289 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// regexPrefix marks the component path patterns that are regular
+// expressions (Go syntax) instead of globs, as in
+// backend:regex:^services/(auth|login)/.*_test\.go$.
+const regexPrefix = "regex:"
+
+// anyRepository is the repository of the component patterns applying to
+// every repository, as in *:docs/**, the same as leaving it out.
+const anyRepository = "*"
+
+// pathRegexps caches the compiled regex patterns, matched against every
+// file change.
+var pathRegexps sync.Map
+
+// pathRegexp returns the compiled regular expression of a regex pattern,
+// given without regexPrefix.
+func pathRegexp(expr string) (*regexp.Regexp, error) {
+	if re, ok := pathRegexps.Load(expr); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	pathRegexps.Store(expr, re)
+	return re, nil
+}
+
+// isRegexPattern reports whether a path pattern is a regular expression.
+func isRegexPattern(pattern string) bool {
+	return strings.HasPrefix(pattern, regexPrefix)
+}
+
+// splitRepoPattern returns the repository and path of a component pattern
+// in [repo:]path form, anyRepository without one. A leading regexPrefix
+// starts the path of a regex pattern, not a repository.
+func splitRepoPattern(pattern string) (string, string) {
+	if isRegexPattern(pattern) {
+		return anyRepository, pattern
+	}
+	repo, path, ok := strings.Cut(pattern, ":")
+	if !ok {
+		return anyRepository, pattern
+	}
+	return repo, path
+}
+
+// expandComponentPatterns rewrites the paths, exclude_paths and weights
+// patterns applying to every repository into one per repository, so
+// organizations sharing a layout across repositories do not repeat them.
+func (c *Config) expandComponentPatterns() {
+	expand := func(patterns []string) []string {
+		var expanded []string
+		for _, pattern := range patterns {
+			repo, path := splitRepoPattern(pattern)
+			scoped := []string{pattern}
+			if repo == anyRepository {
+				scoped = nil
+				for _, r := range c.Repositories {
+					scoped = append(scoped, r.Name+":"+path)
+				}
+			}
+			for _, pattern := range scoped {
+				if !slices.Contains(expanded, pattern) {
+					expanded = append(expanded, pattern)
+				}
+			}
+		}
+		return expanded
+	}
+	for i := range c.Components {
+		c.Components[i].Paths = expand(c.Components[i].Paths)
+		c.Components[i].Filters.ExcludePaths = expand(c.Components[i].Filters.ExcludePaths)
+		for j := range c.Components[i].Weights {
+			c.Components[i].Weights[j].Paths = expand(c.Components[i].Weights[j].Paths)
+		}
+	}
+	for i := range c.Weights {
+		c.Weights[i].Paths = expand(c.Weights[i].Paths)
+	}
+}
+
+// validatePattern returns the error compiling a path pattern, a malformed
+// character class or an unclosed brace of a glob.
+func validatePattern(pattern string) error {
+	if expr, ok := strings.CutPrefix(pattern, regexPrefix); ok {
+		_, err := pathRegexp(expr)
+		return err
+	}
+	depth := 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			if depth > 0 {
+				depth--
+			}
+		}
+	}
+	if depth > 0 {
+		return errors.New("unclosed brace in pattern")
+	}
+	for _, alt := range globAlternatives(pattern) {
+		for _, segment := range strings.Split(alt, "/") {
+			if _, err := path.Match(globSegment(segment), ""); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// matchRegexPattern reports whether path matches a regex pattern, given
+// without regexPrefix. Invalid expressions, rejected by validateConfig,
+// match nothing.
+func matchRegexPattern(path, expr string) bool {
+	re, err := pathRegexp(expr)
+	return err == nil && re.MatchString(path)
+}
+
+// matchPath reports whether a file path matches a component path pattern:
+// a glob, or a regular expression after regexPrefix.
+//
+// Globs follow the doublestar syntax: * and ? match within a path segment,
+// ** as a whole segment matches any number of directories, [abc], [a-z]
+// and [!abc] or [^abc] match a character of a class, {a,b} matches any of
+// the comma separated alternatives and \ escapes the next character. As
+// ** matches no directory too, a pattern ending in /** also matches the
+// directory itself.
+func matchPath(path, pattern string) bool {
+	if expr, ok := strings.CutPrefix(pattern, regexPrefix); ok {
+		return matchRegexPattern(path, expr)
+	}
+	segments := strings.Split(path, "/")
+	for _, alt := range globAlternatives(pattern) {
+		if matchSegments(segments, strings.Split(alt, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments reports whether the segments of a path match those of a
+// glob without braces.
+func matchSegments(segments, pattern []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			for len(rest) > 0 && rest[0] == "**" {
+				rest = rest[1:]
+			}
+			if len(rest) == 0 {
+				return true
+			}
+			for i := range len(segments) + 1 {
+				if matchSegments(segments[i:], rest) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(globSegment(pattern[0]), segments[0]); !ok {
+			return false
+		}
+		segments, pattern = segments[1:], pattern[1:]
+	}
+	return len(segments) == 0
+}
+
+// globSegment returns a glob segment in the syntax of path.Match, which
+// negates character classes with [^ only.
+func globSegment(segment string) string {
+	if !strings.Contains(segment, "[!") {
+		return segment
+	}
+	var b strings.Builder
+	for i := 0; i < len(segment); i++ {
+		c := segment[i]
+		b.WriteByte(c)
+		switch {
+		case c == '\\' && i+1 < len(segment):
+			i++
+			b.WriteByte(segment[i])
+		case c == '[' && i+1 < len(segment) && segment[i+1] == '!':
+			i++
+			b.WriteByte('^')
+		}
+	}
+	return b.String()
+}
+
+// globExpansions caches the alternatives of the globs with braces.
+var globExpansions sync.Map
+
+// globAlternatives returns the globs a pattern with braces expands to,
+// a{b,c{d,e}} to ab, acd and ace; unbalanced braces are literal.
+func globAlternatives(pattern string) []string {
+	if !strings.Contains(pattern, "{") {
+		return []string{pattern}
+	}
+	if alts, ok := globExpansions.Load(pattern); ok {
+		return alts.([]string)
+	}
+	alts := expandBraces(pattern)
+	globExpansions.Store(pattern, alts)
+	return alts
+}
+
+// expandBraces expands the first group of braces of pattern, and those of
+// the resulting patterns.
+func expandBraces(pattern string) []string {
+	start, depth := -1, 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '{':
+			if depth == 0 {
+				start = i
+			}
+			depth++
+		case '}':
+			if depth == 0 {
+				continue
+			}
+			if depth--; depth == 0 {
+				var expanded []string
+				for _, alt := range splitAlternatives(pattern[start+1 : i]) {
+					expanded = append(expanded, expandBraces(pattern[:start]+alt+pattern[i+1:])...)
+				}
+				return expanded
+			}
+		}
+	}
+	return []string{pattern}
+}
+
+// splitAlternatives splits the contents of braces at the commas outside
+// nested braces.
+func splitAlternatives(s string) []string {
+	var alts []string
+	start, depth := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				alts = append(alts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(alts, s[start:])
+}
+
+// matchPathFold is matchPath ignoring case when fold is set.
+func matchPathFold(path, pattern string, fold bool) bool {
+	if !fold {
+		return matchPath(path, pattern)
+	}
+	if expr, ok := strings.CutPrefix(pattern, regexPrefix); ok {
+		return matchRegexPattern(path, "(?i)"+expr)
+	}
+	return matchPath(strings.ToLower(path), strings.ToLower(pattern))
+}
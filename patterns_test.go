@@ -0,0 +1,163 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		path, pattern string
+		want          bool
+	}{
+		// ** at the start.
+		{"main.go", "**/*.go", true},
+		{"cmd/tool/main.go", "**/*.go", true},
+		{"cmd/tool/main.js", "**/*.go", false},
+		// ** in the middle.
+		{"src/internal/x.go", "src/**/internal/*.go", true},
+		{"src/a/b/internal/x.go", "src/**/internal/*.go", true},
+		{"src/internal/a/x.go", "src/**/internal/*.go", false},
+		{"lib/internal/x.go", "src/**/internal/*.go", false},
+		// ** at the end, the directory itself included.
+		{"src/api/handler.go", "src/api/**", true},
+		{"src/api/v1/handler.go", "src/api/**", true},
+		{"src/api", "src/api/**", true},
+		{"src/apiv2/handler.go", "src/api/**", false},
+		{"anything/at/all", "**", true},
+		{"a/b", "a/**/**/b", true},
+		// * and ? do not cross /.
+		{"src/main.go", "src/*.go", true},
+		{"src/cmd/main.go", "src/*.go", false},
+		{"src/a.go", "src/?.go", true},
+		{"src/ab.go", "src/?.go", false},
+		{"a/b", "a?b", false},
+		{"a/b", "a*b", false},
+		// Character classes.
+		{"a.go", "[abc].go", true},
+		{"d.go", "[abc].go", false},
+		{"m.go", "[a-z].go", true},
+		{"M.go", "[a-z].go", false},
+		{"y.go", "[!x].go", true},
+		{"x.go", "[!x].go", false},
+		{"y.go", "[^x].go", true},
+		{"x.go", "[^x].go", false},
+		// Braces, nested too.
+		{"a.ts", "*.{ts,tsx}", true},
+		{"a.tsx", "*.{ts,tsx}", true},
+		{"a.js", "*.{ts,tsx}", false},
+		{"a", "{a,b{c,d}}", true},
+		{"bc", "{a,b{c,d}}", true},
+		{"bd", "{a,b{c,d}}", true},
+		{"b", "{a,b{c,d}}", false},
+		{"src/x/y.go", "{src,lib}/**/*.go", true},
+		{"", "{,a}", true},
+		// Unbalanced braces are literal.
+		{"{a", "{a", true},
+		{"a}", "a}", true},
+		{"a", "{a", false},
+		// Escapes.
+		{"a*b", `a\*b`, true},
+		{"axb", `a\*b`, false},
+		{"{a}", `\{a\}`, true},
+		{"a", `\{a\}`, false},
+		{"a,b", `{a\,b}`, true},
+		// Regular expressions.
+		{"services/auth/x_test.go", `regex:^services/(auth|login)/.*_test\.go$`, true},
+		{"services/billing/x_test.go", `regex:^services/(auth|login)/.*_test\.go$`, false},
+		{"a/b/c.sql", `regex:\.sql$`, true},
+		{"a", "regex:(", false},
+		// Exact paths.
+		{"README.md", "README.md", true},
+		{"docs/README.md", "README.md", false},
+	}
+	for _, tt := range tests {
+		if got := matchPath(tt.path, tt.pattern); got != tt.want {
+			t.Errorf("matchPath(%q, %q) = %v, want %v", tt.path, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestMatchPathFold(t *testing.T) {
+	tests := []struct {
+		path, pattern string
+		fold, want    bool
+	}{
+		{"Src/API/handler.go", "src/api/**", false, false},
+		{"Src/API/handler.go", "src/api/**", true, true},
+		{"docs/Guide.MD", "**/*.md", true, true},
+		{"docs/Guide.MD", "**/*.md", false, false},
+		{"Services/Auth/x.go", "regex:^services/auth/", false, false},
+		{"Services/Auth/x.go", "regex:^services/auth/", true, true},
+		{"LIB/x.GO", "{src,lib}/*.go", true, true},
+	}
+	for _, tt := range tests {
+		if got := matchPathFold(tt.path, tt.pattern, tt.fold); got != tt.want {
+			t.Errorf("matchPathFold(%q, %q, %v) = %v, want %v", tt.path, tt.pattern, tt.fold, got, tt.want)
+		}
+	}
+}
+
+func TestExpandBraces(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"a", []string{"a"}},
+		{"*.{ts,tsx}", []string{"*.ts", "*.tsx"}},
+		{"a{b,c{d,e}}", []string{"ab", "acd", "ace"}},
+		{"{a,b}/{c,d}", []string{"a/c", "a/d", "b/c", "b/d"}},
+		{"{a", []string{"{a"}},
+		{"a}", []string{"a}"}},
+		{`\{a,b\}`, []string{`\{a,b\}`}},
+	}
+	for _, tt := range tests {
+		if got := expandBraces(tt.pattern); !slices.Equal(got, tt.want) {
+			t.Errorf("expandBraces(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestGlobSegment(t *testing.T) {
+	tests := []struct {
+		segment, want string
+	}{
+		{"*.go", "*.go"},
+		{"[!x].go", "[^x].go"},
+		{"[^x].go", "[^x].go"},
+		{`\[!x]`, `\[!x]`},
+		{"[!a][!b]", "[^a][^b]"},
+	}
+	for _, tt := range tests {
+		if got := globSegment(tt.segment); got != tt.want {
+			t.Errorf("globSegment(%q) = %q, want %q", tt.segment, got, tt.want)
+		}
+	}
+}
+
+func TestValidatePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		valid   bool
+	}{
+		{"src/**", true},
+		{"*.{ts,tsx}", true},
+		{"a{b,c{d,e}}", true},
+		{"[a-z].go", true},
+		{`\{a`, true},
+		{"a}", true},
+		{"{a,b", false},
+		{"a{b,{c}", false},
+		{"[a-", false},
+		{"regex:^a(b|c)$", true},
+		{"regex:(", false},
+	}
+	for _, tt := range tests {
+		if err := validatePattern(tt.pattern); (err == nil) != tt.valid {
+			t.Errorf("validatePattern(%q) = %v, want valid %v", tt.pattern, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Minimal PDF writer using the standard Type1 fonts, so no font embedding
+// or external dependency is needed. Tables are laid out with Courier to keep
+// column alignment trivial.
+
+const (
+	pdfPageWidth  = 595.28 // A4
+	pdfPageHeight = 841.89
+	pdfMargin     = 50.0
+	pdfTableChars = 90
+)
+
+var pdfFonts = []struct {
+	name string
+	base string
+}{
+	{"F1", "Helvetica"},
+	{"F2", "Helvetica-Bold"},
+	{"F3", "Courier"},
+}
+
+type pdfDocument struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+func (d *pdfDocument) newPage() {
+	d.pages = append(d.pages, new(bytes.Buffer))
+	d.y = pdfPageHeight - pdfMargin
+}
+
+// line writes a single line of text at the current position, starting a new
+// page when the bottom margin is reached.
+func (d *pdfDocument) line(font string, size float64, text string) {
+	if len(d.pages) == 0 || d.y-size < pdfMargin {
+		d.newPage()
+	}
+	d.y -= size * 1.3
+	d.textAt(len(d.pages)-1, font, size, pdfMargin, d.y, text)
+}
+
+func (d *pdfDocument) textAt(page int, font string, size, x, y float64, text string) {
+	fmt.Fprintf(d.pages[page], "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, pdfEscape(text))
+}
+
+func (d *pdfDocument) space(points float64) {
+	d.y -= points
+}
+
+func (d *pdfDocument) heading(text string) {
+	if d.y < pdfMargin+80 {
+		d.newPage()
+	}
+	d.space(10)
+	d.line("F2", 14, text)
+	d.space(4)
+}
+
+func (d *pdfDocument) table(header []string, widths []int, rows [][]string) {
+	d.line("F3", 9, pdfTableRow(header, widths))
+	d.line("F3", 9, strings.Repeat("-", pdfTableChars))
+	for _, row := range rows {
+		d.line("F3", 9, pdfTableRow(row, widths))
+	}
+}
+
+// pdfTableRow pads each cell to its width. Negative widths right-align.
+func pdfTableRow(cells []string, widths []int) string {
+	var b strings.Builder
+	for i, cell := range cells {
+		w := widths[i]
+		right := w < 0
+		if right {
+			w = -w
+		}
+		if r := []rune(cell); len(r) > w {
+			cell = string(r[:w-1]) + "~"
+		}
+		if right {
+			fmt.Fprintf(&b, "%*s ", w, cell)
+		} else {
+			fmt.Fprintf(&b, "%-*s ", w, cell)
+		}
+	}
+	return strings.TrimRight(b.String(), " ")
+}
+
+// pdfEscape escapes a string for a PDF literal, mapping it to the
+// WinAnsiEncoding used by the standard fonts.
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+func (d *pdfDocument) bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+
+	fontsObj := 3
+	pagesObj := fontsObj + len(pdfFonts)
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", pagesObj+i*2)
+	}
+
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+
+	var fontRes strings.Builder
+	for i, font := range pdfFonts {
+		object(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", font.base))
+		fmt.Fprintf(&fontRes, "/%s %d 0 R ", font.name, fontsObj+i)
+	}
+
+	for i, content := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << %s>> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, fontRes.String(), pagesObj+i*2+1))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+func renderPDFReport(db *sql.DB, w io.Writer) error {
+	report, err := loadReport(db)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(renderPDF(report).bytes())
+	return err
+}
+
+func renderPDF(report *Report) *pdfDocument {
+	d := new(pdfDocument)
+
+	// Title page.
+	d.newPage()
+	d.space(200)
+	d.line("F2", 28, "git-report")
+	d.line("F1", 16, "Contribution report")
+	d.space(20)
+	d.line("F1", 11, "Generated "+formatDate(report.GeneratedAt))
+	d.space(10)
+	for _, repo := range report.Repositories {
+		d.line("F1", 11, fmt.Sprintf("%s: %d commits, %s to %s", repo.Name, repo.Commits,
+			formatDate(repo.FirstCommit), formatDate(repo.LastCommit)))
+	}
+
+	authorWidths := []int{24, 36, -8, -9, -9}
+	authorHeader := []string{"Author", "Email", "Commits", "Added", "Deleted"}
+	authorRows := func(authors []AuthorSummary) [][]string {
+		rows := make([][]string, len(authors))
+		for i, a := range authors {
+			rows[i] = []string{a.Author, a.Email, fmt.Sprint(a.Commits),
+				fmt.Sprintf("+%d", a.Additions), fmt.Sprintf("-%d", a.Deletions)}
+		}
+		return rows
+	}
+
+	d.newPage()
+	d.heading("Repositories")
+	var repoRows [][]string
+	for _, repo := range report.Repositories {
+		repoRows = append(repoRows, []string{repo.Name, fmt.Sprint(repo.Commits), fmt.Sprint(repo.Authors),
+			fmt.Sprintf("+%d", repo.Additions), fmt.Sprintf("-%d", repo.Deletions),
+			formatDate(repo.FirstCommit), formatDate(repo.LastCommit)})
+	}
+	d.table([]string{"Repository", "Commits", "Authors", "Added", "Deleted", "First", "Last"},
+		[]int{24, -8, -8, -9, -9, 10, 10}, repoRows)
+
+	d.heading("Authors")
+	d.table(authorHeader, authorWidths, authorRows(report.Authors))
+
+	if len(report.Teams) > 0 {
+		d.heading("Teams")
+		var teamRows [][]string
+		for _, team := range report.Teams {
+			teamRows = append(teamRows, []string{team.Team, team.Component, fmt.Sprint(team.Commits), fmt.Sprint(team.Contributors),
+				fmt.Sprintf("+%d", team.Additions), fmt.Sprintf("-%d", team.Deletions)})
+		}
+		d.table([]string{"Team", "Component", "Commits", "Contributors", "Added", "Deleted"},
+			[]int{18, 18, -8, -12, -9, -9}, teamRows)
+	}
+
+	if len(report.CommitTypes) > 0 {
+		d.heading("Commit types")
+		var typeRows [][]string
+		for _, t := range report.CommitTypes {
+			typeRows = append(typeRows, []string{t.Type, fmt.Sprint(t.Commits), fmt.Sprint(t.Breaking),
+				fmt.Sprintf("+%d", t.Additions), fmt.Sprintf("-%d", t.Deletions)})
+		}
+		d.table([]string{"Type", "Commits", "Breaking", "Added", "Deleted"}, []int{18, -8, -9, -9, -9}, typeRows)
+	}
+
+	if len(report.Components) > 0 {
+		d.heading("Components")
+		var compRows [][]string
+		for _, comp := range report.Components {
+			compRows = append(compRows, []string{comp.Name, fmt.Sprint(comp.Commits), fmt.Sprint(len(comp.Contributors)),
+				fmt.Sprintf("+%d", comp.Additions), fmt.Sprintf("-%d", comp.Deletions)})
+		}
+		d.table([]string{"Component", "Commits", "Contributors", "Added", "Deleted"},
+			[]int{36, -8, -12, -9, -9}, compRows)
+	}
+
+	for _, comp := range report.Components {
+		d.newPage()
+		d.line("F2", 18, comp.Name)
+		d.space(6)
+		d.line("F1", 11, fmt.Sprintf("%d commits, %d contributors, +%d -%d lines",
+			comp.Commits, len(comp.Contributors), comp.Additions, comp.Deletions))
+		d.space(10)
+		d.table(authorHeader, authorWidths, authorRows(comp.Contributors))
+	}
+
+	for i := range d.pages {
+		d.textAt(i, "F1", 8, pdfPageWidth-pdfMargin-60, pdfMargin/2, fmt.Sprintf("Page %d of %d", i+1, len(d.pages)))
+	}
+
+	return d
+}
@@ -0,0 +1,104 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"log/slog"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// sprintPreset matches last-sprint(14d) and last-sprint(2w).
+var sprintPreset = regexp.MustCompile(`^last-sprint\((\d+)([dw])\)$`)
+
+// presetPeriod returns the period named by a relative date preset, such as
+// last-quarter, resolved at now in the calendar, from its start to the
+// start of the next one. Weeks start on calendar.week_start, quarters and
+// years are fiscal ones and sprints are the days before today.
+func (cal reportCalendar) presetPeriod(preset string, now time.Time) (start, end time.Time, ok bool) {
+	now = now.In(cal.loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, cal.loc)
+	week := cal.startOfWeek(now)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, cal.loc)
+	quarter := cal.startOfQuarter(now)
+	months := (int(now.Month()) - int(cal.fiscalStart) + 12) % 12
+	year := time.Date(now.Year(), now.Month()-time.Month(months), 1, 0, 0, 0, 0, cal.loc)
+
+	switch preset {
+	case "today":
+		return today, today.AddDate(0, 0, 1), true
+	case "yesterday":
+		return today.AddDate(0, 0, -1), today, true
+	case "this-week":
+		return week, week.AddDate(0, 0, 7), true
+	case "last-week":
+		return week.AddDate(0, 0, -7), week, true
+	case "this-month":
+		return month, month.AddDate(0, 1, 0), true
+	case "last-month":
+		return month.AddDate(0, -1, 0), month, true
+	case "this-quarter":
+		return quarter, quarter.AddDate(0, 3, 0), true
+	case "last-quarter":
+		return quarter.AddDate(0, -3, 0), quarter, true
+	case "this-year":
+		return year, year.AddDate(1, 0, 0), true
+	case "last-year":
+		return year.AddDate(-1, 0, 0), year, true
+	}
+	if m := sprintPreset.FindStringSubmatch(preset); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil || n == 0 {
+			return start, end, false
+		}
+		if m[2] == "w" {
+			n *= 7
+		}
+		return today.AddDate(0, 0, -n), today, true
+	}
+	return start, end, false
+}
+
+// isDatePreset reports whether s is a relative date preset.
+func isDatePreset(s string) bool {
+	cal := reportCalendar{loc: time.UTC, weekStart: time.Monday, fiscalStart: time.January}
+	_, _, ok := cal.presetPeriod(s, time.Now())
+	return ok
+}
+
+// resolveDatePresets replaces relative presets in filters.since and
+// filters.until by the dates they resolve to at now, in the reporting
+// timezone and calendar. A preset in since also ends the range at the end
+// of its period when until is empty, so since: last-quarter covers the
+// whole last quarter. The checkpoints of appending runs are only valid for
+// the same resolved dates, so a range moving on re-ingests the history.
+func (c *Config) resolveDatePresets(now time.Time) error {
+	weekStart, err := c.Calendar.weekday()
+	if err != nil {
+		return err
+	}
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return err
+	}
+	cal := reportCalendar{loc: loc, weekStart: weekStart, fiscalStart: time.Month(max(c.Calendar.FiscalYearStart, 1))}
+
+	// git log --until includes commits of that very second.
+	f := &c.Filters
+	since, until := f.Since, f.Until
+	if start, end, ok := cal.presetPeriod(since, now); ok {
+		f.Since = start.Format(time.RFC3339)
+		if until == "" {
+			f.Until = end.Add(-time.Second).Format(time.RFC3339)
+		}
+	}
+	if _, end, ok := cal.presetPeriod(until, now); ok {
+		f.Until = end.Add(-time.Second).Format(time.RFC3339)
+	}
+	if f.Since != since || f.Until != until {
+		slog.Info("Resolved date presets", "since", f.Since, "until", f.Until)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// progressInterval limits how often the progress line is redrawn.
+const progressInterval = 200 * time.Millisecond
+
+// progress draws a single status line, rewritten in place, while
+// repositories are ingested. A nil progress draws nothing.
+type progress struct {
+	w     io.Writer
+	start time.Time
+	drawn time.Time
+
+	repos     int
+	reposDone int
+	repo      string
+	// total is the number of commits expected in every repository, commits
+	// those parsed so far.
+	total   int
+	commits int
+}
+
+func newProgress(w io.Writer, repos int) *progress {
+	return &progress{w: w, start: time.Now(), repos: repos}
+}
+
+// isTerminal reports whether f is a character device, i.e. not redirected
+// to a file or pipe.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// countCommits returns the number of commits git log will list for a
+// repository with the given filters and plan.
+func countCommits(ctx context.Context, repo Repository, filters Filters, plan ingestPlan) (int, error) {
+	args := append([]string{"rev-list", "--count"}, gitFilterArgs(filters)...)
+	args = append(args, plan.revisionRange())
+	args = append(args, pathspecArgs(filters)...)
+	output, err := gitCommandContext(ctx, repo.Path, args...).Output()
+	if err != nil {
+		return 0, fmt.Errorf("git rev-list failed: %v", err)
+	}
+	return strconv.Atoi(strings.TrimSpace(string(output)))
+}
+
+func (p *progress) addTotal(commits int) {
+	if p != nil {
+		p.total += commits
+	}
+}
+
+func (p *progress) startRepository(name string) {
+	if p != nil {
+		p.repo = name
+		p.draw()
+	}
+}
+
+func (p *progress) commit() {
+	if p == nil {
+		return
+	}
+	p.commits++
+	if time.Since(p.drawn) >= progressInterval {
+		p.draw()
+	}
+}
+
+func (p *progress) finishRepository() {
+	if p != nil {
+		p.reposDone++
+		p.draw()
+	}
+}
+
+// finish ends the progress line so later output starts on a new one.
+func (p *progress) finish() {
+	if p != nil {
+		fmt.Fprintln(p.w)
+	}
+}
+
+func (p *progress) draw() {
+	p.drawn = time.Now()
+	line := fmt.Sprintf("[%d/%d] %s: %d/%d commits", p.reposDone, p.repos, p.repo, p.commits, p.total)
+	if p.total > 0 {
+		line += fmt.Sprintf(" (%d%%)", min(100, p.commits*100/p.total))
+	}
+	if eta, ok := p.eta(); ok {
+		line += ", ETA " + eta.Round(time.Second).String()
+	}
+	// Return to the start of the line and clear it before redrawing.
+	fmt.Fprintf(p.w, "\r\033[K%s", line)
+}
+
+// eta estimates the time remaining from the average time per commit so far.
+func (p *progress) eta() (time.Duration, bool) {
+	if p.commits == 0 || p.commits >= p.total {
+		return 0, false
+	}
+	perCommit := time.Since(p.start) / time.Duration(p.commits)
+	return perCommit * time.Duration(p.total-p.commits), true
+}
@@ -0,0 +1,364 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type cannedQuery struct {
+	name        string
+	description string
+	// query takes the row limit as its only parameter.
+	query string
+}
+
+var cannedQueries = []cannedQuery{
+	{"top-authors", "authors by number of commits", `
+		SELECT c.author, c.email, COUNT(*) AS commits,
+			SUM(c.total_additions) AS additions,
+			SUM(c.total_deletions) AS deletions
+		FROM commits c
+		GROUP BY c.email
+		ORDER BY commits DESC, c.email
+		LIMIT ?`},
+	{"busiest-files", "files changed by the most commits", `
+		SELECT r.name AS repository, fc.filepath, COUNT(DISTINCT c.hash) AS commits,
+			SUM(fc.additions) AS additions, SUM(fc.deletions) AS deletions
+		FROM file_changes fc
+		JOIN commits c ON c.hash = fc.commit_hash
+		JOIN repositories r ON r.id = c.repository_id
+		GROUP BY r.id, fc.filepath
+		ORDER BY commits DESC, additions + deletions DESC, fc.filepath
+		LIMIT ?`},
+	{"component-summary", "commits, contributors and churn per component", `
+		SELECT c.name AS component,
+			COALESCE(SUM(cc.commit_count), 0) AS commits,
+			COUNT(DISTINCT cc.email) AS contributors,
+			COALESCE(SUM(cc.total_additions), 0) AS additions,
+			COALESCE(SUM(cc.total_deletions), 0) AS deletions
+		FROM components c
+		LEFT JOIN component_contributions cc ON cc.component_id = c.id
+		GROUP BY c.id
+		ORDER BY commits DESC, c.name
+		LIMIT ?`},
+	{"component-owners", "top contributor of each component and their share of commits", `
+		SELECT component, author, email, commits,
+			ROUND(100.0 * commits / total, 1) AS share
+		FROM (
+			SELECT c.name AS component, cc.author, cc.email,
+				SUM(cc.commit_count) AS commits,
+				SUM(SUM(cc.commit_count)) OVER (PARTITION BY c.id) AS total,
+				ROW_NUMBER() OVER (PARTITION BY c.id ORDER BY SUM(cc.commit_count) DESC, cc.email) AS rank
+			FROM components c
+			JOIN component_contributions cc ON cc.component_id = c.id
+			GROUP BY c.id, cc.email
+		)
+		WHERE rank = 1
+		ORDER BY component
+		LIMIT ?`},
+	{"effort", "weighted lines and churn per component and author, by weighted lines", `
+		SELECT c.name AS component, cc.author, cc.email,
+			ROUND(SUM(cc.weighted_lines), 1) AS effort,
+			SUM(cc.total_additions + cc.total_deletions) AS churn
+		FROM components c
+		JOIN component_contributions cc ON cc.component_id = c.id
+		GROUP BY c.id, cc.email
+		ORDER BY effort DESC, c.name, cc.email
+		LIMIT ?`},
+	{"bus-factors", "least authors covering the work of each component, lowest first", `
+		SELECT c.name AS component, b.threshold, b.commit_authors, b.line_authors
+		FROM component_bus_factors b
+		JOIN components c ON c.id = b.component_id
+		WHERE b.commit_authors > 0
+		ORDER BY b.commit_authors, b.line_authors, c.name
+		LIMIT ?`},
+	{"affiliations", "commits and contributors of internal and external contributors per component", `
+		SELECT c.name AS component,
+			SUM(CASE WHEN cc.affiliation = 'internal' THEN cc.commit_count ELSE 0 END) AS internal_commits,
+			SUM(CASE WHEN cc.affiliation = 'external' THEN cc.commit_count ELSE 0 END) AS external_commits,
+			COUNT(DISTINCT CASE WHEN cc.affiliation = 'internal' THEN cc.email END) AS internal_contributors,
+			COUNT(DISTINCT CASE WHEN cc.affiliation = 'external' THEN cc.email END) AS external_contributors
+		FROM components c
+		JOIN component_contributions cc ON cc.component_id = c.id
+		WHERE NOT cc.is_bot
+		GROUP BY c.id
+		ORDER BY external_commits DESC, c.name
+		LIMIT ?`},
+	{"companies", "commits, contributors and churn per company and component, by commits", `
+		SELECT cc.company, c.name AS component, cc.commit_count AS commits,
+			cc.contributor_count AS contributors, cc.total_additions AS additions,
+			cc.total_deletions AS deletions
+		FROM company_contributions cc
+		JOIN components c ON c.id = cc.component_id
+		ORDER BY commits DESC, cc.company, c.name
+		LIMIT ?`},
+	{"cherry-picks", "commits duplicating an earlier one with the same patch id, newest first", `
+		SELECT r.name AS repository, c.date, c.hash, c.email, c.message,
+			ro.name AS original_repository, o.hash AS original
+		FROM commits c
+		JOIN repositories r ON r.id = c.repository_id
+		JOIN commits o ON o.hash = c.duplicate_of
+		JOIN repositories ro ON ro.id = o.repository_id
+		ORDER BY c.date DESC, c.hash
+		LIMIT ?`},
+	{"mode-changes", "file changes altering a file mode or adding a symlink, newest first", `
+		SELECT r.name AS repository, c.date, c.hash, c.email, fc.filepath,
+			fc.old_mode, fc.new_mode
+		FROM file_changes fc
+		JOIN commits c ON c.hash = fc.commit_hash
+		JOIN repositories r ON r.id = c.repository_id
+		WHERE (fc.old_mode = '000000' AND fc.new_mode = '120000')
+			OR (fc.old_mode NOT IN ('', '000000') AND fc.new_mode NOT IN (fc.old_mode, '000000'))
+		ORDER BY c.date DESC, fc.filepath
+		LIMIT ?`},
+	{"outliers", "commits flagged as outliers, largest first", `
+		SELECT r.name AS repository, c.date, c.hash, c.email, c.message,
+			c.files_changed, c.total_additions AS additions, c.total_deletions AS deletions
+		FROM commits c
+		JOIN repositories r ON r.id = c.repository_id
+		WHERE c.is_outlier
+		ORDER BY c.total_additions + c.total_deletions DESC, c.hash
+		LIMIT ?`},
+	{"review-load", "reviewers by number of Reviewed-by trailers", `
+		SELECT t.value AS reviewer, COUNT(DISTINCT t.commit_hash) AS reviews,
+			COUNT(DISTINCT c.repository_id) AS repositories
+		FROM commit_trailers t
+		JOIN commits c ON c.hash = t.commit_hash
+		WHERE lower(t.key) = 'reviewed-by'
+		GROUP BY t.value
+		ORDER BY reviews DESC, reviewer
+		LIMIT ?`},
+	{"signed-commits", "share of signed commits per component", `
+		SELECT c.name AS component,
+			SUM(cc.commit_count - cc.co_authored_count) AS commits,
+			SUM(cc.signed_count) AS signed,
+			ROUND(100.0 * SUM(cc.signed_count) / MAX(SUM(cc.commit_count - cc.co_authored_count), 1), 1) AS share
+		FROM components c
+		JOIN component_contributions cc ON cc.component_id = c.id
+		GROUP BY c.id
+		ORDER BY share, c.name
+		LIMIT ?`},
+	{"stale-branches", "branches by age of their last commit, oldest first", `
+		SELECT r.name AS repository, b.name AS branch, b.last_commit_date,
+			b.ahead, b.behind
+		FROM branches b
+		JOIN repositories r ON r.id = b.repository_id
+		WHERE NOT b.is_default
+		ORDER BY b.last_commit_date, r.name, b.name
+		LIMIT ?`},
+	{"commit-types", "commits and churn per Conventional Commits type", `
+		SELECT COALESCE(NULLIF(commit_type, ''), 'other') AS type, COUNT(*) AS commits,
+			SUM(is_breaking) AS breaking, SUM(total_additions) AS additions,
+			SUM(total_deletions) AS deletions
+		FROM commits
+		GROUP BY type
+		ORDER BY commits DESC
+		LIMIT ?`},
+	{"team-summary", "commits, contributors and churn per team and component", `
+		SELECT t.name AS team, c.name AS component, tc.commit_count AS commits,
+			tc.contributor_count AS contributors, tc.total_additions AS additions,
+			tc.total_deletions AS deletions
+		FROM team_contributions tc
+		JOIN teams t ON t.id = tc.team_id
+		JOIN components c ON c.id = tc.component_id
+		ORDER BY t.name, commits DESC
+		LIMIT ?`},
+	{"weekly-activity", "commits, authors and churn per week, latest first", `
+		SELECT date(substr(report_date, 1, 10), '-6 days',
+				'weekday ' || COALESCE((SELECT week_start FROM report_settings), 1)) AS week,
+			COUNT(*) AS commits, COUNT(DISTINCT email) AS authors,
+			SUM(total_additions) AS additions, SUM(total_deletions) AS deletions
+		FROM commits
+		GROUP BY week
+		ORDER BY week DESC
+		LIMIT ?`},
+	{"quarterly-activity", "commits, authors and churn per fiscal quarter, latest first", `
+		SELECT 'FY' || (y + (s > 1 AND m >= s)) || ' Q' || ((m - s + 12) % 12 / 3 + 1) AS quarter,
+			COUNT(*) AS commits, COUNT(DISTINCT email) AS authors,
+			SUM(total_additions) AS additions, SUM(total_deletions) AS deletions
+		FROM (
+			SELECT email, total_additions, total_deletions,
+				CAST(substr(report_date, 1, 4) AS INTEGER) AS y,
+				CAST(substr(report_date, 6, 2) AS INTEGER) AS m,
+				COALESCE((SELECT fiscal_year_start FROM report_settings), 1) AS s
+			FROM commits
+		)
+		GROUP BY quarter
+		ORDER BY MAX(y * 12 + m) DESC
+		LIMIT ?`},
+	{"repository-summary", "commits, authors and date range per repository", `
+		SELECT r.name AS repository, COUNT(c.hash) AS commits,
+			COUNT(DISTINCT c.email) AS authors,
+			MIN(c.date) AS first_commit, MAX(c.date) AS last_commit
+		FROM repositories r
+		LEFT JOIN commits c ON c.repository_id = r.id
+		GROUP BY r.id
+		ORDER BY r.name
+		LIMIT ?`},
+	{"recent-commits", "latest commits across all repositories", `
+		SELECT c.date, r.name AS repository, c.author, substr(c.hash, 1, 10) AS hash, c.message
+		FROM commits c
+		JOIN repositories r ON r.id = c.repository_id
+		ORDER BY c.date DESC
+		LIMIT ?`},
+}
+
+func findCannedQuery(name string) (cannedQuery, bool) {
+	for _, q := range cannedQueries {
+		if q.name == name {
+			return q, true
+		}
+	}
+	return cannedQuery{}, false
+}
+
+func queryCommand(args []string) {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	dbPath := fs.String("db", "report.db", "report database")
+	format := fs.String("format", "table", "output format: table, csv or json")
+	limit := fs.Int("limit", 20, "maximum number of rows of a predefined query")
+	list := fs.Bool("list", false, "list the predefined queries")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s query [-db report.db] [-format table|csv|json] [-limit n] <name|sql>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *list {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, q := range cannedQueries {
+			fmt.Fprintf(tw, "%s\t%s\n", q.name, q.description)
+		}
+		tw.Flush()
+		return
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	query, params := fs.Arg(0), []any{}
+	if canned, ok := findCannedQuery(query); ok {
+		query, params = canned.query, []any{*limit}
+	} else if !strings.ContainsAny(query, " \t\n") {
+		log.Fatalf("Unknown query: %s (see -list)", query)
+	}
+
+	db, err := openReportDatabase(*dbPath)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	w := bufio.NewWriter(os.Stdout)
+	if err := runQuery(db, w, *format, query, params...); err != nil {
+		log.Fatalf("Query failed: %v", err)
+	}
+	w.Flush()
+}
+
+// runQuery writes the result of query in the given format, see writeRecords.
+func runQuery(db *sql.DB, w io.Writer, format, query string, args ...any) error {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	var records [][]any
+	for rows.Next() {
+		values := make([]any, len(columns))
+		dest := make([]any, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		records = append(records, values)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return writeRecords(w, format, columns, records)
+}
+
+// writeRecords writes tabular command output as an aligned table, CSV or a
+// JSON array of objects keyed by column name.
+func writeRecords(w io.Writer, format string, columns []string, records [][]any) error {
+	switch format {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(columns, "\t")))
+		for _, values := range records {
+			cells := make([]string, len(values))
+			for i, v := range values {
+				cells[i] = strings.ReplaceAll(queryCell(v), "\t", " ")
+			}
+			fmt.Fprintln(tw, strings.Join(cells, "\t"))
+		}
+		return tw.Flush()
+
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write(columns)
+		for _, values := range records {
+			cells := make([]string, len(values))
+			for i, v := range values {
+				cells[i] = queryCell(v)
+			}
+			cw.Write(cells)
+		}
+		cw.Flush()
+		return cw.Error()
+
+	case "json":
+		list := make([]*gqlResult, 0, len(records))
+		for _, values := range records {
+			obj := &gqlResult{values: make(map[string]any, len(columns))}
+			for i, column := range columns {
+				obj.set(column, values[i])
+			}
+			list = append(list, obj)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(list)
+	}
+	return fmt.Errorf("unsupported format: %s", format)
+}
+
+func queryCell(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.Format(time.DateTime)
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
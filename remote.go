@@ -0,0 +1,220 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// scpLikeURL matches the user@host:path form of ssh URLs.
+var scpLikeURL = regexp.MustCompile(`^[\w.-]+@[\w.-]+:`)
+
+// isRemoteURL reports whether a repository path is a git URL rather than a
+// local directory. Those starting with a dash, which git would read as an
+// option such as --upload-pack, are not.
+func isRemoteURL(s string) bool {
+	if strings.HasPrefix(s, "-") {
+		return false
+	}
+	return strings.Contains(s, "://") || scpLikeURL.MatchString(s)
+}
+
+// remoteName derives a repository name from a URL, the last path element
+// without the .git suffix.
+func remoteName(url string) string {
+	url = strings.TrimSuffix(strings.TrimRight(url, "/"), ".git")
+	if i := strings.LastIndexAny(url, "/:"); i >= 0 {
+		url = url[i+1:]
+	}
+	return url
+}
+
+// remoteCachePath returns the directory below cacheDir a URL is cloned into,
+// made of its host and path, e.g. github.com/org/repo.git.
+func remoteCachePath(cacheDir, url string) string {
+	if _, rest, ok := strings.Cut(url, "://"); ok {
+		url = rest
+	} else {
+		// user@host:path
+		url = strings.Replace(url, ":", "/", 1)
+	}
+	if i := strings.Index(url, "@"); i >= 0 && i < strings.Index(url+"/", "/") {
+		url = url[i+1:]
+	}
+	// Ports would otherwise put a colon in the directory name.
+	url = strings.ReplaceAll(url, ":", "_")
+	// Cleaning as an absolute path keeps .. elements inside cacheDir.
+	url = strings.TrimSuffix(path.Clean("/"+url), ".git") + ".git"
+	return filepath.Join(cacheDir, filepath.FromSlash(url))
+}
+
+// defaultCacheDir returns the directory remote repositories are cloned into
+// when the configuration does not set one.
+func defaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "git-report", "repos"), nil
+}
+
+// nameRemoteRepositories names the remote repositories without a name after
+// their URL.
+func (c *Config) nameRemoteRepositories() {
+	for i, repo := range c.Repositories {
+		if repo.Name == "" && isRemoteURL(repo.Path) {
+			c.Repositories[i].Name = remoteName(repo.Path)
+		}
+	}
+}
+
+// cloneRemoteRepositories clones every remote repository into the cache
+// directory, or fetches into the clone made by a previous run, and points the
+// repository to it. The URL is kept as the repository location.
+func (c *Config) cloneRemoteRepositories() error {
+	cacheDir := c.CacheDir
+	for i, repo := range c.Repositories {
+		if !isRemoteURL(repo.Path) {
+			continue
+		}
+		if cacheDir == "" {
+			var err error
+			if cacheDir, err = defaultCacheDir(); err != nil {
+				return err
+			}
+		}
+		dir := remoteCachePath(cacheDir, repo.Path)
+		if err := updateClone(repo.Path, dir); err != nil {
+			return fmt.Errorf("%s: %v", repo.Name, err)
+		}
+		c.Repositories[i].url = repo.Path
+		c.Repositories[i].Path = dir
+	}
+	return nil
+}
+
+// updateClone makes dir a bare mirror of the branches and tags of url.
+// Branches are fetched as local ones, so a bare clone is read like a work
+// tree, with HEAD the default branch of the remote.
+func updateClone(url, dir string) error {
+	if _, err := os.Stat(filepath.Join(dir, "HEAD")); err == nil {
+		slog.Info("Fetching repository", "url", url, "dir", dir)
+		if output, err := gitCommand(dir, "fetch", "--quiet", "--prune", "--tags", "origin").CombinedOutput(); err != nil {
+			return fmt.Errorf("git fetch failed: %v: %s", err, strings.TrimSpace(string(output)))
+		}
+		return nil
+	}
+
+	slog.Info("Cloning repository", "url", url, "dir", dir)
+	if err := os.MkdirAll(filepath.Dir(dir), 0o755); err != nil {
+		return err
+	}
+	if output, err := gitCommand("", "clone", "--quiet", "--bare", "--", url, dir).CombinedOutput(); err != nil {
+		return fmt.Errorf("git clone failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	// Bare clones do not configure a fetch refspec; map the remote branches
+	// to local ones so later fetches update them.
+	if output, err := gitCommand(dir, "config", "remote.origin.fetch", "+refs/heads/*:refs/heads/*").CombinedOutput(); err != nil {
+		return fmt.Errorf("git config failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// isGitRepository reports whether path is a git work tree or a bare
+// repository, such as the clones of remote repositories.
+func isGitRepository(path string) bool {
+	if _, err := os.Stat(filepath.Join(path, ".git")); err == nil {
+		return true
+	}
+	for _, name := range []string{"HEAD", "objects", "refs"} {
+		if _, err := os.Stat(filepath.Join(path, name)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// fetchRepositories updates the local repositories with fetch set, or every
+// one when all is set, from their remotes. Remote repositories are fetched
+// when cloned.
+func (c *Config) fetchRepositories(all bool) error {
+	for _, repo := range c.Repositories {
+		if (!repo.Fetch && !all) || repo.url != "" {
+			continue
+		}
+		if err := fetchRepository(repo.Path); err != nil {
+			return fmt.Errorf("%s: %v", repo.Name, err)
+		}
+	}
+	return nil
+}
+
+// fetchRepository fetches every remote of the repository at dir and, like
+// git pull --ff-only, fast-forwards the checked out branch to its upstream.
+// Repositories without an upstream branch, e.g. with a detached HEAD, are
+// only fetched.
+func fetchRepository(dir string) error {
+	slog.Info("Fetching repository", "dir", dir)
+	if output, err := gitCommand(dir, "fetch", "--quiet", "--all", "--tags").CombinedOutput(); err != nil {
+		return fmt.Errorf("git fetch failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	if gitCommand(dir, "rev-parse", "--verify", "--quiet", "@{upstream}").Run() != nil {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		// Bare repositories have nothing checked out to fast-forward.
+		return nil
+	}
+	if output, err := gitCommand(dir, "merge", "--ff-only", "--quiet", "@{upstream}").CombinedOutput(); err != nil {
+		return fmt.Errorf("git merge --ff-only failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// addSubmodules adds the checked out submodules of the repositories with
+// submodules set, nested ones included, as repositories named after their
+// parent and path, e.g. app/deps/lib.
+func (c *Config) addSubmodules() error {
+	names := make(map[string]bool)
+	for _, repo := range c.Repositories {
+		names[repo.Name] = true
+	}
+	var added []Repository
+	for _, repo := range c.Repositories {
+		if !repo.Submodules {
+			continue
+		}
+		output, err := gitCommand(repo.Path, "submodule", "status", "--recursive").Output()
+		if err != nil {
+			return fmt.Errorf("%s: git submodule status failed: %v", repo.Name, err)
+		}
+		for line := range strings.Lines(string(output)) {
+			// " <commit> <path> (<describe>)", prefixed with - when the
+			// submodule is not initialized.
+			fields := strings.Fields(line[1:])
+			if len(fields) < 2 {
+				continue
+			}
+			path := fields[1]
+			if line[0] == '-' {
+				slog.Warn("Skipping submodule not checked out", "repo", repo.Name, "path", path)
+				continue
+			}
+			name := repo.Name + "/" + path
+			if names[name] {
+				return fmt.Errorf("%s: submodule %s: duplicate repository name %q", repo.Name, path, name)
+			}
+			names[name] = true
+			added = append(added, Repository{Path: filepath.Join(repo.Path, path), Name: name, loc: repo.loc})
+		}
+	}
+	c.Repositories = append(c.Repositories, added...)
+	return nil
+}
@@ -0,0 +1,576 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"cmp"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Report is the aggregated view of a report database used by the
+// rendered output formats.
+type Report struct {
+	GeneratedAt  time.Time
+	Repositories []RepositorySummary
+	Authors      []AuthorSummary
+	Components   []ComponentSummary
+	Teams        []TeamSummary
+	CommitTypes  []CommitTypeSummary
+}
+
+type RepositorySummary struct {
+	Name        string
+	Path        string
+	Commits     int
+	Authors     int
+	Additions   int
+	Deletions   int
+	FirstCommit time.Time
+	LastCommit  time.Time
+	Activity    []ActivityPoint
+}
+
+type AuthorSummary struct {
+	Author    string
+	Email     string
+	Commits   int
+	Additions int
+	Deletions int
+}
+
+// TeamSummary is the rollup of the contributions of a team to a component.
+type TeamSummary struct {
+	Team         string
+	Component    string
+	Contributors int
+	Commits      int
+	Additions    int
+	Deletions    int
+}
+
+// CommitTypeSummary aggregates the commits of a Conventional Commits type,
+// "other" for the commits not following them.
+type CommitTypeSummary struct {
+	Type      string
+	Commits   int
+	Breaking  int
+	Additions int
+	Deletions int
+}
+
+type ComponentSummary struct {
+	Name         string
+	Commits      int
+	Additions    int
+	Deletions    int
+	Contributors []AuthorSummary
+	Activity     []ActivityPoint
+}
+
+func loadReport(db *sql.DB) (*Report, error) {
+	report := &Report{GeneratedAt: time.Now()}
+
+	repos, err := loadRepositorySummaries(db)
+	if err != nil {
+		return nil, err
+	}
+	report.Repositories = repos
+
+	authors, err := loadAuthorSummaries(db)
+	if err != nil {
+		return nil, err
+	}
+	report.Authors = authors
+
+	components, err := loadComponentSummaries(db)
+	if err != nil {
+		return nil, err
+	}
+	report.Components = components
+
+	teams, err := loadTeamSummaries(db)
+	if err != nil {
+		return nil, err
+	}
+	report.Teams = teams
+
+	commitTypes, err := loadCommitTypeSummaries(db)
+	if err != nil {
+		return nil, err
+	}
+	report.CommitTypes = commitTypes
+
+	if err := loadActivity(db, report); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+func loadRepositorySummaries(db *sql.DB) ([]RepositorySummary, error) {
+	rows, err := db.Query(`
+		SELECT r.name, r.path,
+			COUNT(DISTINCT c.hash),
+			COUNT(DISTINCT c.email),
+			COALESCE(MIN(c.report_date), ''),
+			COALESCE(MAX(c.report_date), '')
+		FROM repositories r
+		LEFT JOIN commits c ON c.repository_id = r.id
+		GROUP BY r.id
+		ORDER BY r.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var repos []RepositorySummary
+	for rows.Next() {
+		var repo RepositorySummary
+		var first, last string
+		if err := rows.Scan(&repo.Name, &repo.Path, &repo.Commits, &repo.Authors, &first, &last); err != nil {
+			return nil, err
+		}
+		repo.FirstCommit = parseDBTime(first)
+		repo.LastCommit = parseDBTime(last)
+		repos = append(repos, repo)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range repos {
+		err := db.QueryRow(`
+			SELECT COALESCE(SUM(c.total_additions), 0), COALESCE(SUM(c.total_deletions), 0)
+			FROM commits c
+			JOIN repositories r ON r.id = c.repository_id
+			WHERE r.name = ?
+		`, repos[i].Name).Scan(&repos[i].Additions, &repos[i].Deletions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return repos, nil
+}
+
+func loadAuthorSummaries(db *sql.DB) ([]AuthorSummary, error) {
+	rows, err := db.Query(`
+		SELECT c.author, c.email,
+			COUNT(*),
+			SUM(c.total_additions),
+			SUM(c.total_deletions)
+		FROM commits c
+		GROUP BY c.email
+		ORDER BY COUNT(*) DESC, c.email
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var authors []AuthorSummary
+	for rows.Next() {
+		var a AuthorSummary
+		if err := rows.Scan(&a.Author, &a.Email, &a.Commits, &a.Additions, &a.Deletions); err != nil {
+			return nil, err
+		}
+		authors = append(authors, a)
+	}
+	return authors, rows.Err()
+}
+
+func loadComponentSummaries(db *sql.DB) ([]ComponentSummary, error) {
+	rows, err := db.Query(`
+		SELECT c.name, cc.author, cc.email,
+			SUM(cc.commit_count), SUM(cc.total_additions), SUM(cc.total_deletions)
+		FROM components c
+		LEFT JOIN component_contributions cc ON cc.component_id = c.id
+		GROUP BY c.id, cc.email
+		ORDER BY c.name, SUM(cc.commit_count) DESC, cc.email
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var components []ComponentSummary
+	for rows.Next() {
+		var name string
+		var author, email sql.NullString
+		var commits, additions, deletions sql.NullInt64
+		if err := rows.Scan(&name, &author, &email, &commits, &additions, &deletions); err != nil {
+			return nil, err
+		}
+
+		if len(components) == 0 || components[len(components)-1].Name != name {
+			components = append(components, ComponentSummary{Name: name})
+		}
+		if !email.Valid {
+			continue
+		}
+
+		comp := &components[len(components)-1]
+		comp.Commits += int(commits.Int64)
+		comp.Additions += int(additions.Int64)
+		comp.Deletions += int(deletions.Int64)
+		comp.Contributors = append(comp.Contributors, AuthorSummary{
+			Author:    author.String,
+			Email:     email.String,
+			Commits:   int(commits.Int64),
+			Additions: int(additions.Int64),
+			Deletions: int(deletions.Int64),
+		})
+	}
+	return components, rows.Err()
+}
+
+func loadTeamSummaries(db *sql.DB) ([]TeamSummary, error) {
+	// Databases written by older versions, opened read only by diff or
+	// summary, lack the teams tables.
+	var found bool
+	err := db.QueryRow("SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'team_contributions'").Scan(&found)
+	if err != nil || !found {
+		return nil, err
+	}
+	rows, err := db.Query(`
+		SELECT t.name, c.name, tc.contributor_count, tc.commit_count,
+			tc.total_additions, tc.total_deletions
+		FROM team_contributions tc
+		JOIN teams t ON t.id = tc.team_id
+		JOIN components c ON c.id = tc.component_id
+		ORDER BY t.name, tc.commit_count DESC, c.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var teams []TeamSummary
+	for rows.Next() {
+		var t TeamSummary
+		if err := rows.Scan(&t.Team, &t.Component, &t.Contributors, &t.Commits, &t.Additions, &t.Deletions); err != nil {
+			return nil, err
+		}
+		teams = append(teams, t)
+	}
+	return teams, rows.Err()
+}
+
+func loadCommitTypeSummaries(db *sql.DB) ([]CommitTypeSummary, error) {
+	// Databases written by older versions lack the commit types.
+	var found bool
+	err := db.QueryRow("SELECT COUNT(*) > 0 FROM pragma_table_info('commits') WHERE name = 'commit_type'").Scan(&found)
+	if err != nil || !found {
+		return nil, err
+	}
+	rows, err := db.Query(`
+		SELECT COALESCE(NULLIF(commit_type, ''), 'other') AS type, COUNT(*), SUM(is_breaking),
+			SUM(total_additions), SUM(total_deletions)
+		FROM commits
+		GROUP BY type
+		ORDER BY COUNT(*) DESC, type
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var types []CommitTypeSummary
+	for rows.Next() {
+		var t CommitTypeSummary
+		if err := rows.Scan(&t.Type, &t.Commits, &t.Breaking, &t.Additions, &t.Deletions); err != nil {
+			return nil, err
+		}
+		types = append(types, t)
+	}
+	return types, rows.Err()
+}
+
+// parseDBTime parses a timestamp as stored by the sqlite3 driver. Aggregate
+// queries (MIN, MAX) lose the column type so the value comes back as text.
+func parseDBTime(s string) time.Time {
+	for _, format := range sqlite3.SQLiteTimestampFormats {
+		if t, err := time.Parse(format, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format("2006-01-02")
+}
+
+// changeRow is a single file change joined with its commit and repository.
+// Commits without file changes have an empty Path.
+type changeRow struct {
+	Repository string
+	RepoPath   string
+	Hash       string
+	Author     string
+	Email      string
+	Date       time.Time
+	Path       string
+	Additions  int
+	Deletions  int
+}
+
+// reportFilter restricts the change rows aggregated into a report. Zero
+// values do not filter; Until is exclusive.
+type reportFilter struct {
+	Since      time.Time
+	Until      time.Time
+	Author     string
+	Repository string
+	Component  string
+	// Release restricts to the commits released by a tag, or by a range of
+	// tags such as v1.2..v1.3, see releaseCondition.
+	Release string
+}
+
+// parseDateRange parses inclusive YYYY-MM-DD dates into a [since, until)
+// range. Empty dates are left unbounded.
+func parseDateRange(since, until string) (time.Time, time.Time, error) {
+	var from, to time.Time
+	var err error
+	if since != "" {
+		if from, err = time.Parse(time.DateOnly, since); err != nil {
+			return from, to, fmt.Errorf("invalid since date: %s", since)
+		}
+	}
+	if until != "" {
+		if to, err = time.Parse(time.DateOnly, until); err != nil {
+			return from, to, fmt.Errorf("invalid until date: %s", until)
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+	return from, to, nil
+}
+
+// queryChanges returns change rows for the commits matching the filter, by
+// date and release. The component is not filtered here, see reportBuilder.
+func queryChanges(db *sql.DB, filter reportFilter) (*sql.Rows, error) {
+	query := `
+		SELECT r.name, r.path, c.hash, c.author, c.email, c.report_date,
+			COALESCE(fc.filepath, ''), COALESCE(fc.additions, 0), COALESCE(fc.deletions, 0)
+		FROM commits c
+		JOIN repositories r ON r.id = c.repository_id
+		LEFT JOIN file_changes fc ON fc.commit_hash = c.hash
+		WHERE 1 = 1`
+	var args []any
+	if !filter.Since.IsZero() {
+		query += " AND c.report_date >= ?"
+		args = append(args, filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query += " AND c.report_date < ?"
+		args = append(args, filter.Until)
+	}
+	if filter.Author != "" {
+		query += " AND c.email = ?"
+		args = append(args, filter.Author)
+	}
+	if filter.Repository != "" {
+		query += " AND r.name = ?"
+		args = append(args, filter.Repository)
+	}
+	if filter.Release != "" {
+		cond, condArgs := releaseCondition(filter.Release)
+		query += " AND " + cond
+		args = append(args, condArgs...)
+	}
+	return db.Query(query+" ORDER BY c.report_date", args...)
+}
+
+func scanChangeRow(rows *sql.Rows) (changeRow, error) {
+	var row changeRow
+	err := rows.Scan(&row.Repository, &row.RepoPath, &row.Hash, &row.Author, &row.Email, &row.Date,
+		&row.Path, &row.Additions, &row.Deletions)
+	return row, err
+}
+
+// loadFilteredReport aggregates the change rows matching the filter.
+func loadFilteredReport(db *sql.DB, components []storedComponent, filter reportFilter) (*Report, error) {
+	rows, err := queryChanges(db, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	builder := newReportBuilder(components, filter.Component)
+	for rows.Next() {
+		row, err := scanChangeRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		builder.add(row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return builder.report(), nil
+}
+
+// reportBuilder aggregates change rows into a Report, for views over a
+// subset of the data (date ranges, authors, components) that cannot use the
+// precomputed component_contributions table.
+type reportBuilder struct {
+	components []storedComponent
+	// only restricts the aggregation to changes matching this component.
+	only string
+
+	repos       []*RepositorySummary
+	repoIndex   map[string]*RepositorySummary
+	authors     map[string]*AuthorSummary
+	comps       map[string]*ComponentSummary
+	compAuthors map[string]map[string]*AuthorSummary
+	seen        map[string]bool
+}
+
+func newReportBuilder(components []storedComponent, only string) *reportBuilder {
+	return &reportBuilder{
+		components:  components,
+		only:        only,
+		repoIndex:   make(map[string]*RepositorySummary),
+		authors:     make(map[string]*AuthorSummary),
+		comps:       make(map[string]*ComponentSummary),
+		compAuthors: make(map[string]map[string]*AuthorSummary),
+		seen:        make(map[string]bool),
+	}
+}
+
+// once reports whether key is seen for the first time.
+func (b *reportBuilder) once(key ...string) bool {
+	k := strings.Join(key, "\x00")
+	if b.seen[k] {
+		return false
+	}
+	b.seen[k] = true
+	return true
+}
+
+func (b *reportBuilder) matching(row changeRow) []string {
+	var names []string
+	for _, comp := range b.components {
+		if row.Path != "" && comp.matches(row.Repository, row.Path) {
+			names = append(names, comp.name)
+		}
+	}
+	// Changes matching no component are uncategorized, when stored.
+	if len(names) == 0 && row.Path != "" && slices.ContainsFunc(b.components, func(c storedComponent) bool { return c.name == uncategorizedComponent }) {
+		names = append(names, uncategorizedComponent)
+	}
+	return names
+}
+
+func (b *reportBuilder) add(row changeRow) {
+	components := b.matching(row)
+	if b.only != "" && !slices.Contains(components, b.only) {
+		return
+	}
+
+	repo, ok := b.repoIndex[row.Repository]
+	if !ok {
+		repo = &RepositorySummary{Name: row.Repository, Path: row.RepoPath}
+		b.repoIndex[row.Repository] = repo
+		b.repos = append(b.repos, repo)
+	}
+	if b.once("commit", row.Hash) {
+		repo.Commits++
+		if repo.FirstCommit.IsZero() || row.Date.Before(repo.FirstCommit) {
+			repo.FirstCommit = row.Date
+		}
+		if row.Date.After(repo.LastCommit) {
+			repo.LastCommit = row.Date
+		}
+	}
+	if b.once("repo-author", row.Repository, row.Email) {
+		repo.Authors++
+	}
+	repo.Additions += row.Additions
+	repo.Deletions += row.Deletions
+
+	author, ok := b.authors[row.Email]
+	if !ok {
+		author = &AuthorSummary{Author: row.Author, Email: row.Email}
+		b.authors[row.Email] = author
+	}
+	if b.once("author", row.Email, row.Hash) {
+		author.Commits++
+	}
+	author.Additions += row.Additions
+	author.Deletions += row.Deletions
+
+	for _, name := range components {
+		if b.only != "" && name != b.only {
+			continue
+		}
+		comp, ok := b.comps[name]
+		if !ok {
+			comp = &ComponentSummary{Name: name}
+			b.comps[name] = comp
+			b.compAuthors[name] = make(map[string]*AuthorSummary)
+		}
+		contrib, ok := b.compAuthors[name][row.Email]
+		if !ok {
+			contrib = &AuthorSummary{Author: row.Author, Email: row.Email}
+			b.compAuthors[name][row.Email] = contrib
+		}
+		if b.once("component", name, row.Hash) {
+			comp.Commits++
+		}
+		if b.once("component-author", name, row.Email, row.Hash) {
+			contrib.Commits++
+		}
+		comp.Additions += row.Additions
+		comp.Deletions += row.Deletions
+		contrib.Additions += row.Additions
+		contrib.Deletions += row.Deletions
+	}
+}
+
+func sortAuthors(authors []AuthorSummary) {
+	slices.SortFunc(authors, func(a, b AuthorSummary) int {
+		if a.Commits != b.Commits {
+			return b.Commits - a.Commits
+		}
+		return cmp.Compare(a.Email, b.Email)
+	})
+}
+
+func (b *reportBuilder) report() *Report {
+	report := &Report{GeneratedAt: time.Now()}
+	for _, repo := range b.repos {
+		report.Repositories = append(report.Repositories, *repo)
+	}
+	slices.SortFunc(report.Repositories, func(a, b RepositorySummary) int { return cmp.Compare(a.Name, b.Name) })
+
+	for _, author := range b.authors {
+		report.Authors = append(report.Authors, *author)
+	}
+	sortAuthors(report.Authors)
+
+	for _, stored := range b.components {
+		comp, ok := b.comps[stored.name]
+		if !ok {
+			continue
+		}
+		for _, contrib := range b.compAuthors[stored.name] {
+			comp.Contributors = append(comp.Contributors, *contrib)
+		}
+		sortAuthors(comp.Contributors)
+		report.Components = append(report.Components, *comp)
+	}
+	return report
+}
@@ -0,0 +1,196 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+type dashboardFilter struct {
+	Since     string
+	Until     string
+	Author    string
+	Component string
+	Release   string
+}
+
+type dashboard struct {
+	Filter     dashboardFilter
+	Report     *Report
+	Authors    []AuthorSummary
+	Components []string
+	Error      string
+}
+
+func serveCommand(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8080", "listen address")
+	graphql := fs.Bool("graphql", false, "also serve a GraphQL API at /graphql")
+	metrics := fs.Bool("metrics", false, "also serve Prometheus metrics at /metrics")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s serve [flags] <report.db>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	db, err := openReportDatabase(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	mux := http.NewServeMux()
+	mux.Handle("/", dashboardHandler(db))
+	registerAPI(mux, db)
+	if *graphql {
+		mux.Handle("/graphql", graphqlHandler(db))
+	}
+	if *metrics {
+		mux.Handle("GET /metrics", metricsHandler(db))
+	}
+	log.Printf("Serving %s on http://%s/", fs.Arg(0), *addr)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
+
+func dashboardHandler(db *sql.DB) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		q := r.URL.Query()
+		filter := dashboardFilter{
+			Since:     q.Get("since"),
+			Until:     q.Get("until"),
+			Author:    q.Get("author"),
+			Component: q.Get("component"),
+			Release:   q.Get("release"),
+		}
+
+		d, err := loadDashboard(db, filter)
+		if err != nil {
+			log.Printf("Dashboard error: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := dashboardTemplate.Execute(w, d); err != nil {
+			log.Printf("Dashboard error: %v", err)
+		}
+	})
+}
+
+func loadDashboard(db *sql.DB, filter dashboardFilter) (*dashboard, error) {
+	d := &dashboard{Filter: filter}
+
+	components, err := loadComponentPatterns(db)
+	if err != nil {
+		return nil, err
+	}
+	for _, comp := range components {
+		d.Components = append(d.Components, comp.name)
+	}
+
+	d.Authors, err = loadAuthorSummaries(db)
+	if err != nil {
+		return nil, err
+	}
+
+	since, until, err := parseDateRange(filter.Since, filter.Until)
+	if err != nil {
+		d.Error = err.Error()
+		d.Report = &Report{GeneratedAt: time.Now()}
+		return d, nil
+	}
+
+	d.Report, err = loadFilteredReport(db, components, reportFilter{
+		Since:     since,
+		Until:     until,
+		Author:    filter.Author,
+		Component: filter.Component,
+		Release:   filter.Release,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(templateFuncs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>git-report dashboard</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.6em; }
+h2 { font-size: 1.3em; margin-top: 2em; border-bottom: 1px solid #ccc; }
+form { background: #f4f4f4; padding: 0.8em; display: inline-block; }
+form label { margin-right: 1em; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { padding: 0.3em 0.8em; border: 1px solid #ddd; text-align: left; }
+th { background: #f4f4f4; }
+td.num { text-align: right; }
+.add { color: #080; }
+.del { color: #b00; }
+.error { color: #b00; font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>git-report dashboard</h1>
+<form method="get" action="/">
+<label>Since <input type="date" name="since" value="{{.Filter.Since}}"></label>
+<label>Until <input type="date" name="until" value="{{.Filter.Until}}"></label>
+<label>Author <select name="author"><option value="">all</option>
+{{- range .Authors}}<option value="{{.Email}}"{{if eq .Email $.Filter.Author}} selected{{end}}>{{.Author}} &lt;{{.Email}}&gt;</option>{{end -}}
+</select></label>
+<label>Component <select name="component"><option value="">all</option>
+{{- range .Components}}<option{{if eq . $.Filter.Component}} selected{{end}}>{{.}}</option>{{end -}}
+</select></label>
+<label>Release <input type="text" name="release" value="{{.Filter.Release}}" placeholder="v1.2..v1.3"></label>
+<input type="submit" value="Filter"> <a href="/">reset</a>
+</form>
+{{- if .Error}}
+<p class="error">{{.Error}}</p>
+{{- end}}
+
+<h2>Repositories</h2>
+<table>
+<tr><th>Name</th><th>Commits</th><th>Authors</th><th>Additions</th><th>Deletions</th><th>First commit</th><th>Last commit</th></tr>
+{{- range .Report.Repositories}}
+<tr><td>{{.Name}}</td><td class="num">{{.Commits}}</td><td class="num">{{.Authors}}</td><td class="num add">+{{.Additions}}</td><td class="num del">-{{.Deletions}}</td><td>{{date .FirstCommit}}</td><td>{{date .LastCommit}}</td></tr>
+{{- end}}
+</table>
+
+<h2>Authors</h2>
+<table>
+<tr><th>Author</th><th>Email</th><th>Commits</th><th>Additions</th><th>Deletions</th></tr>
+{{- range .Report.Authors}}
+<tr><td>{{.Author}}</td><td>{{.Email}}</td><td class="num">{{.Commits}}</td><td class="num add">+{{.Additions}}</td><td class="num del">-{{.Deletions}}</td></tr>
+{{- end}}
+</table>
+
+<h2>Components</h2>
+<table>
+<tr><th>Component</th><th>Commits</th><th>Contributors</th><th>Additions</th><th>Deletions</th></tr>
+{{- range .Report.Components}}
+<tr><td>{{.Name}}</td><td class="num">{{.Commits}}</td><td class="num">{{len .Contributors}}</td><td class="num add">+{{.Additions}}</td><td class="num del">-{{.Deletions}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
@@ -0,0 +1,420 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const siteRecentCommits = 25
+
+type site struct {
+	Report       *Report
+	Repositories []*siteRepository
+	Authors      []*siteAuthor
+	Components   []*siteComponent
+	// Lookup tables from names to pages, used for cross-links.
+	repoPages      map[string]*siteRepository
+	authorPages    map[string]*siteAuthor
+	componentPages map[string]*siteComponent
+}
+
+type siteRepository struct {
+	RepositorySummary
+	Slug    string
+	Authors []AuthorSummary
+	Recent  []siteCommit
+}
+
+type siteAuthor struct {
+	AuthorSummary
+	Slug         string
+	Repositories []siteBreakdown
+	Components   []siteBreakdown
+}
+
+type siteComponent struct {
+	ComponentSummary
+	Slug string
+}
+
+type siteBreakdown struct {
+	Name      string
+	Commits   int
+	Additions int
+	Deletions int
+}
+
+type siteCommit struct {
+	Hash    string
+	Author  string
+	Email   string
+	Date    string
+	Message string
+}
+
+// slugger produces unique file name friendly identifiers.
+type slugger map[string]bool
+
+func (s slugger) slug(name string) string {
+	base := strings.Trim(strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		default:
+			return '-'
+		}
+	}, name), "-")
+	if base == "" {
+		base = "item"
+	}
+	slug := base
+	for i := 2; s[slug]; i++ {
+		slug = fmt.Sprintf("%s-%d", base, i)
+	}
+	s[slug] = true
+	return slug
+}
+
+func loadSite(db *sql.DB) (*site, error) {
+	report, err := loadReport(db)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &site{
+		Report:         report,
+		repoPages:      make(map[string]*siteRepository),
+		authorPages:    make(map[string]*siteAuthor),
+		componentPages: make(map[string]*siteComponent),
+	}
+
+	slugs := make(slugger)
+	for _, repo := range report.Repositories {
+		page := &siteRepository{RepositorySummary: repo, Slug: slugs.slug(repo.Name)}
+		s.Repositories = append(s.Repositories, page)
+		s.repoPages[repo.Name] = page
+	}
+	slugs = make(slugger)
+	for _, author := range report.Authors {
+		page := &siteAuthor{AuthorSummary: author, Slug: slugs.slug(author.Email)}
+		s.Authors = append(s.Authors, page)
+		s.authorPages[author.Email] = page
+	}
+	slugs = make(slugger)
+	for _, comp := range report.Components {
+		page := &siteComponent{ComponentSummary: comp, Slug: slugs.slug(comp.Name)}
+		s.Components = append(s.Components, page)
+		s.componentPages[comp.Name] = page
+	}
+
+	for _, repo := range s.Repositories {
+		if err := loadSiteRepository(db, repo); err != nil {
+			return nil, err
+		}
+	}
+	if err := loadSiteAuthorRepositories(db, s); err != nil {
+		return nil, err
+	}
+	for _, comp := range s.Components {
+		for _, c := range comp.Contributors {
+			if author, ok := s.authorPages[c.Email]; ok {
+				author.Components = append(author.Components, siteBreakdown{comp.Name, c.Commits, c.Additions, c.Deletions})
+			}
+		}
+	}
+
+	return s, nil
+}
+
+func loadSiteRepository(db *sql.DB, repo *siteRepository) error {
+	rows, err := db.Query(`
+		SELECT c.author, c.email,
+			COUNT(*),
+			SUM(c.total_additions),
+			SUM(c.total_deletions)
+		FROM commits c
+		JOIN repositories r ON r.id = c.repository_id
+		WHERE r.name = ?
+		GROUP BY c.email
+		ORDER BY COUNT(*) DESC, c.email
+	`, repo.Name)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var a AuthorSummary
+		if err := rows.Scan(&a.Author, &a.Email, &a.Commits, &a.Additions, &a.Deletions); err != nil {
+			rows.Close()
+			return err
+		}
+		repo.Authors = append(repo.Authors, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = db.Query(`
+		SELECT c.hash, c.author, c.email, c.report_date, c.message
+		FROM commits c
+		JOIN repositories r ON r.id = c.repository_id
+		WHERE r.name = ?
+		ORDER BY c.report_date DESC
+		LIMIT ?
+	`, repo.Name, siteRecentCommits)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c siteCommit
+		var date sql.NullTime
+		if err := rows.Scan(&c.Hash, &c.Author, &c.Email, &date, &c.Message); err != nil {
+			return err
+		}
+		c.Date = formatDate(date.Time)
+		repo.Recent = append(repo.Recent, c)
+	}
+	return rows.Err()
+}
+
+func loadSiteAuthorRepositories(db *sql.DB, s *site) error {
+	rows, err := db.Query(`
+		SELECT c.email, r.name,
+			COUNT(*),
+			SUM(c.total_additions),
+			SUM(c.total_deletions)
+		FROM commits c
+		JOIN repositories r ON r.id = c.repository_id
+		GROUP BY c.email, r.id
+		ORDER BY COUNT(*) DESC, r.name
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var email string
+		var b siteBreakdown
+		if err := rows.Scan(&email, &b.Name, &b.Commits, &b.Additions, &b.Deletions); err != nil {
+			return err
+		}
+		if author, ok := s.authorPages[email]; ok {
+			author.Repositories = append(author.Repositories, b)
+		}
+	}
+	return rows.Err()
+}
+
+func (s *site) repoLink(name string) string {
+	if page, ok := s.repoPages[name]; ok {
+		return "repos/" + page.Slug + ".html"
+	}
+	return ""
+}
+
+func (s *site) authorLink(email string) string {
+	if page, ok := s.authorPages[email]; ok {
+		return "authors/" + page.Slug + ".html"
+	}
+	return ""
+}
+
+func (s *site) componentLink(name string) string {
+	if page, ok := s.componentPages[name]; ok {
+		return "components/" + page.Slug + ".html"
+	}
+	return ""
+}
+
+func writeSite(db *sql.DB, dir string) error {
+	s, err := loadSite(db)
+	if err != nil {
+		return err
+	}
+
+	tmpl, err := template.New("site").Funcs(templateFuncs).Funcs(template.FuncMap{
+		"repoLink":      s.repoLink,
+		"authorLink":    s.authorLink,
+		"componentLink": s.componentLink,
+		"dict":          templateDict,
+	}).Parse(siteTemplates)
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range []string{"repos", "authors", "components"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return err
+		}
+	}
+
+	type page struct {
+		Root  string
+		Title string
+		Site  *site
+		Data  any
+	}
+	render := func(path, name, title, root string, data any) error {
+		f, err := os.Create(filepath.Join(dir, path))
+		if err != nil {
+			return err
+		}
+		if err := tmpl.ExecuteTemplate(f, name, page{root, title, s, data}); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+
+	if err := render("index.html", "index", "git-report", "", s); err != nil {
+		return err
+	}
+	for _, repo := range s.Repositories {
+		if err := render(s.repoLink(repo.Name), "repo", repo.Name, "../", repo); err != nil {
+			return err
+		}
+	}
+	for _, author := range s.Authors {
+		if err := render(s.authorLink(author.Email), "author", author.Author, "../", author); err != nil {
+			return err
+		}
+	}
+	for _, comp := range s.Components {
+		if err := render(s.componentLink(comp.Name), "component", comp.Name, "../", comp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// templateDict builds a map from alternating keys and values, to pass several
+// arguments to a nested template.
+func templateDict(kv ...any) (map[string]any, error) {
+	if len(kv)%2 != 0 {
+		return nil, fmt.Errorf("dict: odd number of arguments")
+	}
+	m := make(map[string]any, len(kv)/2)
+	for i := 0; i < len(kv); i += 2 {
+		key, ok := kv[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict: key %v is not a string", kv[i])
+		}
+		m[key] = kv[i+1]
+	}
+	return m, nil
+}
+
+const siteTemplates = `
+{{define "header"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+nav { margin-bottom: 1.5em; }
+nav a { margin-right: 1em; }
+h1 { font-size: 1.6em; }
+h2 { font-size: 1.3em; margin-top: 2em; border-bottom: 1px solid #ccc; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { padding: 0.3em 0.8em; border: 1px solid #ddd; text-align: left; }
+th { background: #f4f4f4; }
+td.num { text-align: right; }
+.add { color: #080; }
+.del { color: #b00; }
+code { font-size: 0.9em; }
+footer { margin-top: 3em; font-size: 0.8em; color: #888; }
+</style>
+</head>
+<body>
+<nav><a href="{{.Root}}index.html">Overview</a></nav>
+<h1>{{.Title}}</h1>
+{{end}}
+
+{{define "footer"}}
+<footer>Generated {{date .Site.Report.GeneratedAt}}</footer>
+</body>
+</html>
+{{end}}
+
+{{define "authors"}}{{$root := .Root}}
+<table>
+<tr><th>Author</th><th>Email</th><th>Commits</th><th>Additions</th><th>Deletions</th></tr>
+{{- range .Data}}
+<tr><td><a href="{{$root}}{{authorLink .Email}}">{{.Author}}</a></td><td>{{.Email}}</td><td class="num">{{.Commits}}</td><td class="num add">+{{.Additions}}</td><td class="num del">-{{.Deletions}}</td></tr>
+{{- end}}
+</table>
+{{end}}
+
+{{define "index"}}{{template "header" .}}
+<h2>Repositories</h2>
+<table>
+<tr><th>Name</th><th>Commits</th><th>Authors</th><th>Additions</th><th>Deletions</th><th>First commit</th><th>Last commit</th></tr>
+{{- range .Site.Repositories}}
+<tr><td><a href="{{repoLink .Name}}">{{.Name}}</a></td><td class="num">{{.Commits}}</td><td class="num">{{.Authors}}</td><td class="num add">+{{.Additions}}</td><td class="num del">-{{.Deletions}}</td><td>{{date .FirstCommit}}</td><td>{{date .LastCommit}}</td></tr>
+{{- end}}
+</table>
+{{- if .Site.Components}}
+<h2>Components</h2>
+<table>
+<tr><th>Component</th><th>Commits</th><th>Contributors</th><th>Additions</th><th>Deletions</th></tr>
+{{- range .Site.Components}}
+<tr><td><a href="{{componentLink .Name}}">{{.Name}}</a></td><td class="num">{{.Commits}}</td><td class="num">{{len .Contributors}}</td><td class="num add">+{{.Additions}}</td><td class="num del">-{{.Deletions}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+<h2>Authors</h2>
+{{template "authors" (dict "Root" .Root "Data" .Site.Report.Authors)}}
+{{template "footer" .}}{{end}}
+
+{{define "repo"}}{{template "header" .}}
+<p>Path: <code>{{.Data.Path}}</code></p>
+<p>{{.Data.Commits}} commits by {{.Data.Authors}} authors, <span class="add">+{{.Data.Additions}}</span> <span class="del">-{{.Data.Deletions}}</span> lines, {{date .Data.FirstCommit}} to {{date .Data.LastCommit}}.</p>
+<h2>Authors</h2>
+{{template "authors" (dict "Root" .Root "Data" .Data.Authors)}}
+<h2>Recent commits</h2>
+<table>
+<tr><th>Date</th><th>Commit</th><th>Author</th><th>Message</th></tr>
+{{- $root := .Root}}
+{{- range .Data.Recent}}
+<tr><td>{{.Date}}</td><td><code>{{slice .Hash 0 10}}</code></td><td><a href="{{$root}}{{authorLink .Email}}">{{.Author}}</a></td><td>{{.Message}}</td></tr>
+{{- end}}
+</table>
+{{template "footer" .}}{{end}}
+
+{{define "author"}}{{template "header" .}}{{$root := .Root}}
+<p>{{.Data.Email}}: {{.Data.Commits}} commits, <span class="add">+{{.Data.Additions}}</span> <span class="del">-{{.Data.Deletions}}</span> lines.</p>
+<h2>Repositories</h2>
+<table>
+<tr><th>Repository</th><th>Commits</th><th>Additions</th><th>Deletions</th></tr>
+{{- range .Data.Repositories}}
+<tr><td><a href="{{$root}}{{repoLink .Name}}">{{.Name}}</a></td><td class="num">{{.Commits}}</td><td class="num add">+{{.Additions}}</td><td class="num del">-{{.Deletions}}</td></tr>
+{{- end}}
+</table>
+{{- if .Data.Components}}
+<h2>Components</h2>
+<table>
+<tr><th>Component</th><th>Commits</th><th>Additions</th><th>Deletions</th></tr>
+{{- range .Data.Components}}
+<tr><td><a href="{{$root}}{{componentLink .Name}}">{{.Name}}</a></td><td class="num">{{.Commits}}</td><td class="num add">+{{.Additions}}</td><td class="num del">-{{.Deletions}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{template "footer" .}}{{end}}
+
+{{define "component"}}{{template "header" .}}
+<p>{{.Data.Commits}} commits by {{len .Data.Contributors}} contributors, <span class="add">+{{.Data.Additions}}</span> <span class="del">-{{.Data.Deletions}}</span> lines.</p>
+<h2>Contributors</h2>
+{{template "authors" (dict "Root" .Root "Data" .Data.Contributors)}}
+{{template "footer" .}}{{end}}
+`
@@ -0,0 +1,126 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// dumpSQL writes the schema and the contents of every table as plain SQL
+// statements, in the spirit of the sqlite3 shell .dump command.
+func dumpSQL(db *sql.DB, w io.Writer) error {
+	rows, err := db.Query(`
+		SELECT type, name, sql FROM sqlite_master
+		WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%'
+		ORDER BY CASE type WHEN 'table' THEN 0 ELSE 1 END, rowid
+	`)
+	if err != nil {
+		return err
+	}
+
+	var tables, statements []string
+	for rows.Next() {
+		var kind, name, stmt string
+		if err := rows.Scan(&kind, &name, &stmt); err != nil {
+			rows.Close()
+			return err
+		}
+		if kind == "table" {
+			tables = append(tables, name)
+		}
+		statements = append(statements, stmt)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "BEGIN TRANSACTION;")
+	for _, stmt := range statements[:len(tables)] {
+		fmt.Fprintf(w, "%s;\n", stmt)
+	}
+	for _, table := range tables {
+		if err := dumpTable(db, w, table); err != nil {
+			return fmt.Errorf("%s: %v", table, err)
+		}
+	}
+	for _, stmt := range statements[len(tables):] {
+		fmt.Fprintf(w, "%s;\n", stmt)
+	}
+	fmt.Fprintln(w, "COMMIT;")
+	return nil
+}
+
+func dumpTable(db *sql.DB, w io.Writer, table string) error {
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s", sqlQuoteIdent(table)))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = sqlQuoteIdent(col)
+	}
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES (", sqlQuoteIdent(table), strings.Join(quoted, ", "))
+
+	values := make([]any, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	literals := make([]string, len(columns))
+
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		for i, v := range values {
+			literals[i] = sqlLiteral(v)
+		}
+		fmt.Fprintf(w, "%s%s);\n", prefix, strings.Join(literals, ", "))
+	}
+	return rows.Err()
+}
+
+func sqlLiteral(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case int64:
+		return fmt.Sprint(v)
+	case float64:
+		return fmt.Sprint(v)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case []byte:
+		return "X'" + hex.EncodeToString(v) + "'"
+	case time.Time:
+		return sqlQuote(v.Format(sqlite3.SQLiteTimestampFormats[0]))
+	default:
+		return sqlQuote(fmt.Sprint(v))
+	}
+}
+
+func sqlQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func sqlQuoteIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
@@ -0,0 +1,196 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+)
+
+const summaryTop = 5
+
+func printSummary(db *sql.DB, w io.Writer) error {
+	report, err := loadReport(db)
+	if err != nil {
+		return err
+	}
+	renderSummary(w, report)
+	coverage, err := loadCoverage(db)
+	if err != nil {
+		return err
+	}
+	renderCoverage(w, coverage)
+	overlaps, err := loadOverlaps(db)
+	if err != nil {
+		return err
+	}
+	renderOverlaps(w, overlaps)
+	factors, err := loadBusFactors(db)
+	if err != nil {
+		return err
+	}
+	renderBusFactors(w, factors)
+	return nil
+}
+
+func renderSummary(w io.Writer, report *Report) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "REPOSITORY\tCOMMITS\tAUTHORS\tADDED\tDELETED")
+	for _, repo := range report.Repositories {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t+%d\t-%d\n", repo.Name, repo.Commits, repo.Authors, repo.Additions, repo.Deletions)
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TOP AUTHORS\tCOMMITS\tADDED\tDELETED")
+	for _, a := range report.Authors[:min(summaryTop, len(report.Authors))] {
+		fmt.Fprintf(tw, "%s <%s>\t%d\t+%d\t-%d\n", a.Author, a.Email, a.Commits, a.Additions, a.Deletions)
+	}
+	tw.Flush()
+
+	if len(report.Components) == 0 {
+		return
+	}
+
+	components := slices.Clone(report.Components)
+	slices.SortStableFunc(components, func(a, b ComponentSummary) int {
+		return (b.Additions + b.Deletions) - (a.Additions + a.Deletions)
+	})
+
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TOP COMPONENTS\tCHURN\tCOMMITS\tCONTRIBUTORS")
+	for _, comp := range components[:min(summaryTop, len(components))] {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\n", comp.Name, comp.Additions+comp.Deletions, comp.Commits, len(comp.Contributors))
+	}
+	tw.Flush()
+}
+
+type summaryTotals struct {
+	Repositories int
+	Commits      int
+	Contributors int
+	Files        int
+	Additions    int
+	Deletions    int
+	FirstCommit  time.Time
+	LastCommit   time.Time
+}
+
+func summaryCommand(args []string) {
+	fs := flag.NewFlagSet("summary", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s summary <report.db>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	db, err := openReportDatabase(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	totals, err := loadSummaryTotals(db)
+	if err != nil {
+		log.Fatalf("Failed to load totals: %v", err)
+	}
+	report, err := loadReport(db)
+	if err != nil {
+		log.Fatalf("Failed to load report: %v", err)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	renderTotals(w, totals)
+	fmt.Fprintln(w)
+	renderSummary(w, report)
+	renderComponentBreakdown(w, report.Components)
+	coverage, err := loadCoverage(db)
+	if err != nil {
+		log.Fatalf("Failed to load coverage: %v", err)
+	}
+	renderCoverage(w, coverage)
+	overlaps, err := loadOverlaps(db)
+	if err != nil {
+		log.Fatalf("Failed to load overlaps: %v", err)
+	}
+	renderOverlaps(w, overlaps)
+	factors, err := loadBusFactors(db)
+	if err != nil {
+		log.Fatalf("Failed to load bus factors: %v", err)
+	}
+	renderBusFactors(w, factors)
+	w.Flush()
+}
+
+func loadSummaryTotals(db *sql.DB) (*summaryTotals, error) {
+	var t summaryTotals
+	var first, last string
+	err := db.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM repositories),
+			COUNT(*), COUNT(DISTINCT email),
+			COALESCE(MIN(report_date), ''), COALESCE(MAX(report_date), '')
+		FROM commits
+	`).Scan(&t.Repositories, &t.Commits, &t.Contributors, &first, &last)
+	if err != nil {
+		return nil, err
+	}
+	t.FirstCommit = parseDBTime(first)
+	t.LastCommit = parseDBTime(last)
+
+	err = db.QueryRow(`
+		SELECT COUNT(DISTINCT c.repository_id || ':' || fc.filepath),
+			COALESCE(SUM(fc.additions), 0), COALESCE(SUM(fc.deletions), 0)
+		FROM file_changes fc
+		JOIN commits c ON c.hash = fc.commit_hash
+	`).Scan(&t.Files, &t.Additions, &t.Deletions)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func renderTotals(w io.Writer, t *summaryTotals) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Repositories:\t%d\n", t.Repositories)
+	fmt.Fprintf(tw, "Commits:\t%d\n", t.Commits)
+	fmt.Fprintf(tw, "Contributors:\t%d\n", t.Contributors)
+	fmt.Fprintf(tw, "Files touched:\t%d\n", t.Files)
+	fmt.Fprintf(tw, "Lines:\t+%d -%d\n", t.Additions, t.Deletions)
+	fmt.Fprintf(tw, "Period:\t%s to %s\n", formatDate(t.FirstCommit), formatDate(t.LastCommit))
+	tw.Flush()
+}
+
+// renderComponentBreakdown lists every component, unlike the summary which
+// only shows the busiest ones.
+func renderComponentBreakdown(w io.Writer, components []ComponentSummary) {
+	if len(components) == 0 {
+		return
+	}
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "COMPONENT\tCOMMITS\tCONTRIBUTORS\tADDED\tDELETED\tTOP CONTRIBUTOR")
+	for _, comp := range components {
+		top := "-"
+		if len(comp.Contributors) > 0 {
+			top = comp.Contributors[0].Email
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t+%d\t-%d\t%s\n", comp.Name, comp.Commits, len(comp.Contributors),
+			comp.Additions, comp.Deletions, top)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,168 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+// tag is a tag pointing, directly or through an annotated tag, to a commit.
+type tag struct {
+	Name   string
+	Commit string
+	// Date is the tagger date of annotated tags, the commit date of
+	// lightweight ones.
+	Date time.Time
+}
+
+// listTags returns the tags of a repository pointing to commits, oldest
+// first.
+func listTags(ctx context.Context, repo Repository) ([]tag, error) {
+	output, err := gitCommandContext(ctx, repo.Path, "for-each-ref", "--sort=refname", "--sort=creatordate",
+		"--format=%(refname:short)%00%(objecttype)%00%(objectname)%00%(*objecttype)%00%(*objectname)%00%(creatordate:iso-strict)",
+		"refs/tags").Output()
+	if err != nil {
+		return nil, fmt.Errorf("git for-each-ref failed: %v", err)
+	}
+	var tags []tag
+	for line := range strings.Lines(string(output)) {
+		parts := strings.Split(strings.TrimSuffix(line, "\n"), "\x00")
+		if len(parts) < 6 {
+			continue
+		}
+		t := tag{Name: parts[0], Commit: parts[2]}
+		if parts[1] == "tag" {
+			// Annotated tags are peeled to the object they tag.
+			parts[1], t.Commit = parts[3], parts[4]
+		}
+		if parts[1] != "commit" {
+			continue
+		}
+		if t.Date, err = time.Parse(time.RFC3339, parts[5]); err != nil {
+			continue
+		}
+		tags = append(tags, t)
+	}
+	// The last --sort key is the primary one: tags are sorted by date, then
+	// by name.
+	return tags, nil
+}
+
+// ingestTags records the tags of a repository and, for each one, the
+// commits it released: those reachable from it and from no earlier tag.
+// Nothing is done when the tags did not change since the previous run.
+func ingestTags(ctx context.Context, db *sql.DB, repo Repository, repoID int) error {
+	tags, err := listTags(ctx, repo)
+	if err != nil {
+		return err
+	}
+	stored, err := storedTags(db, repoID)
+	if err != nil {
+		return err
+	}
+	if slices.EqualFunc(tags, stored, func(a, b tag) bool { return a.Name == b.Name && a.Commit == b.Commit }) {
+		return nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM tag_commits WHERE tag_id IN (SELECT id FROM tags WHERE repository_id = ?)", repoID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM tags WHERE repository_id = ?", repoID); err != nil {
+		return err
+	}
+	tagStmt, err := tx.Prepare("INSERT INTO tags (repository_id, name, commit_hash, date, position) VALUES (?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	commitStmt, err := tx.Prepare("INSERT INTO tag_commits (tag_id, commit_hash) VALUES (?, ?)")
+	if err != nil {
+		return err
+	}
+
+	var earlier []string
+	for i, t := range tags {
+		result, err := tagStmt.Exec(repoID, t.Name, t.Commit, t.Date, i+1)
+		if err != nil {
+			return err
+		}
+		tagID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		// Earlier tags are excluded on stdin, as there can be many.
+		cmd := gitCommandContext(ctx, repo.Path, "rev-list", "--stdin", t.Commit)
+		cmd.Stdin = strings.NewReader(strings.Join(earlier, ""))
+		output, err := cmd.Output()
+		if err != nil {
+			return fmt.Errorf("git rev-list %s failed: %v", t.Name, err)
+		}
+		for _, hash := range strings.Fields(string(output)) {
+			if _, err := commitStmt.Exec(tagID, hash); err != nil {
+				return err
+			}
+		}
+		earlier = append(earlier, "^"+t.Commit+"\n")
+	}
+	slog.Info("Ingested tags", "repo", repo.Name, "tags", len(tags))
+	return tx.Commit()
+}
+
+// storedTags returns the tags recorded for a repository, in release order.
+func storedTags(db *sql.DB, repoID int) ([]tag, error) {
+	rows, err := db.Query("SELECT name, commit_hash, date FROM tags WHERE repository_id = ? ORDER BY position", repoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tags []tag
+	for rows.Next() {
+		var t tag
+		if err := rows.Scan(&t.Name, &t.Commit, &t.Date); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// releaseCondition returns the SQL condition selecting the commits of c
+// released by a tag, or by the tags after from up to to for a from..to
+// range, e.g. v1.2..v1.3. Tags are looked up in the repository of each
+// commit.
+func releaseCondition(release string) (string, []any) {
+	const released = `c.hash IN (
+		SELECT tc.commit_hash FROM tag_commits tc
+		JOIN tags t ON t.id = tc.tag_id
+		WHERE t.repository_id = c.repository_id AND %s)`
+	from, to, isRange := strings.Cut(release, "..")
+	if !isRange {
+		return fmt.Sprintf(released, "t.name = ?"), []any{release}
+	}
+	const position = "(SELECT position FROM tags WHERE repository_id = c.repository_id AND name = ?)"
+	var conds []string
+	var args []any
+	if from != "" {
+		conds = append(conds, "t.position > "+position)
+		args = append(args, from)
+	}
+	if to != "" {
+		conds = append(conds, "t.position <= "+position)
+		args = append(args, to)
+	}
+	if len(conds) == 0 {
+		conds = append(conds, "1 = 1")
+	}
+	return fmt.Sprintf(released, strings.Join(conds, " AND ")), args
+}
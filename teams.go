@@ -0,0 +1,84 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+)
+
+// Team is a group of contributors whose contributions are rolled up
+// together.
+type Team struct {
+	Name string `yaml:"name"`
+	// Members are emails, those containing @, matched case-insensitively,
+	// or names. Any email or name of an identity stands for the identity.
+	Members []string `yaml:"members"`
+}
+
+// resolveTeamMembers maps the members of teams to the canonical emails of
+// their identities, as credited in component contributions; other members
+// are kept as they are. identities is an identitiesKey.
+func resolveTeamMembers(teams []Team, identities string) ([]Team, error) {
+	resolve, err := identityResolver(identities)
+	if err != nil {
+		return nil, err
+	}
+	resolved := make([]Team, len(teams))
+	for i, team := range teams {
+		resolved[i] = Team{Name: team.Name}
+		for _, member := range team.Members {
+			var author, email string
+			if strings.Contains(member, "@") {
+				_, email = resolve("", member)
+			} else if author, email = resolve(member, ""); email == "" {
+				email = author
+			}
+			resolved[i].Members = append(resolved[i].Members, email)
+		}
+	}
+	return resolved, nil
+}
+
+// replaceTeams replaces the teams of the database and rolls up their
+// component contributions into team_contributions. It only reads
+// component_contributions, so it is done on every run and membership
+// changes need no recompute.
+func replaceTeams(db *sql.DB, teams []Team) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM team_contributions; DELETE FROM teams"); err != nil {
+		return err
+	}
+	for _, team := range teams {
+		members, err := json.Marshal(team.Members)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("INSERT INTO teams (name, members) VALUES (?, ?)", team.Name, string(members)); err != nil {
+			return err
+		}
+	}
+	// A commit co-authored by several members counts once for each.
+	_, err = tx.Exec(`
+		INSERT INTO team_contributions (team_id, component_id, contributor_count,
+			commit_count, total_additions, total_deletions)
+		SELECT t.id, cc.component_id, COUNT(DISTINCT lower(cc.email)),
+			SUM(cc.commit_count), SUM(cc.total_additions), SUM(cc.total_deletions)
+		FROM teams t
+		JOIN component_contributions cc ON EXISTS (
+			SELECT 1 FROM json_each(t.members) m
+			WHERE lower(m.value) = lower(cc.email) OR m.value = cc.author)
+		GROUP BY t.id, cc.component_id
+	`)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
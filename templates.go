@@ -0,0 +1,77 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	htmltemplate "html/template"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+)
+
+type Template struct {
+	Path   string `yaml:"path"`
+	Output string `yaml:"output"`
+}
+
+type templateExecutor interface {
+	Execute(w io.Writer, data any) error
+}
+
+var templateFuncs = map[string]any{
+	"date":         formatDate,
+	"commitsChart": commitsChartHTML,
+	"linesChart":   linesChartHTML,
+}
+
+// parseTemplate loads a user template. Files with an .html or .htm extension
+// use html/template so values are escaped; anything else uses text/template.
+func parseTemplate(path string) (templateExecutor, error) {
+	name := filepath.Base(path)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm":
+		return htmltemplate.New(name).Funcs(templateFuncs).ParseFiles(path)
+	default:
+		return texttemplate.New(name).Funcs(templateFuncs).ParseFiles(path)
+	}
+}
+
+func renderTemplates(db *sql.DB, templates []Template) error {
+	if len(templates) == 0 {
+		return nil
+	}
+
+	report, err := loadReport(db)
+	if err != nil {
+		return err
+	}
+
+	for _, tmpl := range templates {
+		t, err := parseTemplate(tmpl.Path)
+		if err != nil {
+			return err
+		}
+		slog.Info("Rendering template", "template", tmpl.Path, "output", tmpl.Output)
+		if err := executeTemplate(t, tmpl.Output, report); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func executeTemplate(t templateExecutor, path string, report *Report) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := t.Execute(f, report); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
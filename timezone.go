@@ -0,0 +1,60 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// normalizeDates sets report_date, the commit date in the reporting
+// timezone loc, on the commits lacking it or stored for another timezone,
+// so a changed timezone also applies to commits ingested before. Days,
+// weeks and months are bucketed by report_date, date keeping the offset of
+// the author.
+func normalizeDates(db *sql.DB, loc *time.Location) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// CAST keeps the driver from parsing the stored text as a time.
+	rows, err := tx.Query("SELECT hash, date, CAST(report_date AS TEXT) FROM commits")
+	if err != nil {
+		return err
+	}
+	type normalized struct{ hash, date string }
+	var changed []normalized
+	for rows.Next() {
+		var hash, stored string
+		var date time.Time
+		if err := rows.Scan(&hash, &date, &stored); err != nil {
+			rows.Close()
+			return err
+		}
+		// The format the driver stores times with.
+		if want := date.In(loc).Format(sqlite3.SQLiteTimestampFormats[0]); want != stored {
+			changed = append(changed, normalized{hash, want})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare("UPDATE commits SET report_date = ? WHERE hash = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, c := range changed {
+		if _, err := stmt.Exec(c.date, c.hash); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,468 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Minimal TOML parser for configuration files. It decodes into generic maps
+// and slices, which are then converted to the Config struct through YAML, so
+// the same field names and custom unmarshalers apply. Dates and times are
+// kept as strings.
+
+type tomlParser struct {
+	s    string
+	pos  int
+	line int
+	// defined maps the paths of the tables defined by a [table] header to
+	// its line, see tablePath.
+	defined map[string]int
+}
+
+// TOML integers and floats are decimal, without leading zeros, with
+// underscores only between digits.
+var (
+	tomlInteger = regexp.MustCompile(`^[+-]?(0|[1-9](_?[0-9])*)$`)
+	tomlFloat   = regexp.MustCompile(`^[+-]?((0|[1-9](_?[0-9])*)(\.[0-9](_?[0-9])*)?([eE][+-]?[0-9](_?[0-9])*)?|inf|nan)$`)
+)
+
+func parseTOML(data string) (map[string]any, error) {
+	p := &tomlParser{s: data, line: 1, defined: make(map[string]int)}
+	root := make(map[string]any)
+	current := root
+	for {
+		p.skipSpace(true)
+		if p.eof() {
+			return root, nil
+		}
+		if p.peek() == '[' {
+			array := strings.HasPrefix(p.s[p.pos:], "[[")
+			if array {
+				p.pos += 2
+			} else {
+				p.pos++
+			}
+			p.skipSpace(false)
+			keys, err := p.parseKey()
+			if err != nil {
+				return nil, err
+			}
+			p.skipSpace(false)
+			closing := "]"
+			if array {
+				closing = "]]"
+			}
+			if !strings.HasPrefix(p.s[p.pos:], closing) {
+				return nil, p.errorf("expected %s", closing)
+			}
+			p.pos += len(closing)
+			if array {
+				current, err = p.appendTable(root, keys)
+			} else if current, err = p.table(root, keys); err == nil {
+				err = p.define(root, keys)
+			}
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			if err := p.parseKeyValue(current); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.endOfLine(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *tomlParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("toml: line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *tomlParser) eof() bool { return p.pos >= len(p.s) }
+
+func (p *tomlParser) peek() byte { return p.s[p.pos] }
+
+// skipSpace skips blanks and comments, and newlines when multiline is set.
+func (p *tomlParser) skipSpace(multiline bool) {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case c == '\n' && multiline:
+			p.pos++
+			p.line++
+		case c == '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) endOfLine() error {
+	p.skipSpace(false)
+	if p.eof() {
+		return nil
+	}
+	if p.peek() != '\n' {
+		return p.errorf("unexpected %q", p.peek())
+	}
+	p.pos++
+	p.line++
+	return nil
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// parseKey parses a possibly dotted key.
+func (p *tomlParser) parseKey() ([]string, error) {
+	var keys []string
+	for {
+		p.skipSpace(false)
+		if p.eof() {
+			return nil, p.errorf("expected key")
+		}
+		switch c := p.peek(); {
+		case c == '"' || c == '\'':
+			key, err := p.parseString()
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		case isBareKeyChar(c):
+			start := p.pos
+			for !p.eof() && isBareKeyChar(p.peek()) {
+				p.pos++
+			}
+			keys = append(keys, p.s[start:p.pos])
+		default:
+			return nil, p.errorf("invalid key character %q", c)
+		}
+		p.skipSpace(false)
+		if p.eof() || p.peek() != '.' {
+			return keys, nil
+		}
+		p.pos++
+	}
+}
+
+func (p *tomlParser) parseKeyValue(table map[string]any) error {
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	p.skipSpace(false)
+	if p.eof() || p.peek() != '=' {
+		return p.errorf("expected = after key %s", strings.Join(keys, "."))
+	}
+	p.pos++
+	p.skipSpace(false)
+	value, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+	parent, err := p.table(table, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	last := keys[len(keys)-1]
+	if _, ok := parent[last]; ok {
+		return p.errorf("duplicate key %s", strings.Join(keys, "."))
+	}
+	parent[last] = value
+	return nil
+}
+
+// table returns the table at keys below root, creating missing ones. Keys
+// naming an array of tables refer to its last element.
+func (p *tomlParser) table(root map[string]any, keys []string) (map[string]any, error) {
+	current := root
+	for _, key := range keys {
+		switch v := current[key].(type) {
+		case nil:
+			next := make(map[string]any)
+			current[key] = next
+			current = next
+		case map[string]any:
+			current = v
+		case []any:
+			last, ok := v[len(v)-1].(map[string]any)
+			if !ok {
+				return nil, p.errorf("key %s is not a table", key)
+			}
+			current = last
+		default:
+			return nil, p.errorf("key %s is not a table", key)
+		}
+	}
+	return current, nil
+}
+
+// define records the table at keys below root as defined by a [table]
+// header, failing when it already was.
+func (p *tomlParser) define(root map[string]any, keys []string) error {
+	path := p.tablePath(root, keys)
+	if line, ok := p.defined[path]; ok {
+		return p.errorf("table %s already defined at line %d", strings.Join(keys, "."), line)
+	}
+	p.defined[path] = p.line
+	return nil
+}
+
+// tablePath returns the path of the existing table at keys below root,
+// keys naming an array of tables followed by the index of its last element,
+// so the tables of every element are told apart.
+func (p *tomlParser) tablePath(root map[string]any, keys []string) string {
+	var path strings.Builder
+	current := root
+	for _, key := range keys {
+		path.WriteString(strconv.Quote(key))
+		switch v := current[key].(type) {
+		case map[string]any:
+			current = v
+		case []any:
+			fmt.Fprintf(&path, "[%d]", len(v)-1)
+			current, _ = v[len(v)-1].(map[string]any)
+		}
+		path.WriteByte('.')
+	}
+	return path.String()
+}
+
+func (p *tomlParser) appendTable(root map[string]any, keys []string) (map[string]any, error) {
+	parent, err := p.table(root, keys[:len(keys)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := keys[len(keys)-1]
+	table := make(map[string]any)
+	switch v := parent[last].(type) {
+	case nil:
+		parent[last] = []any{table}
+	case []any:
+		parent[last] = append(v, table)
+	default:
+		return nil, p.errorf("key %s is not an array of tables", last)
+	}
+	return table, nil
+}
+
+func (p *tomlParser) parseValue() (any, error) {
+	if p.eof() {
+		return nil, p.errorf("expected value")
+	}
+	switch p.peek() {
+	case '"', '\'':
+		return p.parseString()
+	case '[':
+		return p.parseArray()
+	case '{':
+		return p.parseInlineTable()
+	}
+
+	start := p.pos
+	for !p.eof() && !strings.ContainsRune(" \t\r\n,]}#", rune(p.peek())) {
+		p.pos++
+	}
+	// Date-times may contain a single space between date and time.
+	if p.pos-start == 10 && strings.HasPrefix(p.s[p.pos:], " ") && p.pos+1 < len(p.s) && p.s[p.pos+1] >= '0' && p.s[p.pos+1] <= '9' {
+		p.pos++
+		for !p.eof() && !strings.ContainsRune(" \t\r\n,]}#", rune(p.peek())) {
+			p.pos++
+		}
+	}
+	token := p.s[start:p.pos]
+	switch token {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "":
+		return nil, p.errorf("expected value")
+	}
+	number := strings.ReplaceAll(token, "_", "")
+	if tomlInteger.MatchString(token) {
+		n, err := strconv.ParseInt(number, 10, 64)
+		if err != nil {
+			return nil, p.errorf("invalid integer %q", token)
+		}
+		return n, nil
+	}
+	if tomlFloat.MatchString(token) {
+		f, err := strconv.ParseFloat(number, 64)
+		if err != nil {
+			return nil, p.errorf("invalid float %q", token)
+		}
+		return f, nil
+	}
+	if token[0] >= '0' && token[0] <= '9' && strings.ContainsAny(token, "-:") {
+		return token, nil
+	}
+	return nil, p.errorf("invalid value %q", token)
+}
+
+func (p *tomlParser) parseArray() (any, error) {
+	p.pos++
+	list := []any{}
+	for {
+		p.skipSpace(true)
+		if p.eof() {
+			return nil, p.errorf("unterminated array")
+		}
+		if p.peek() == ']' {
+			p.pos++
+			return list, nil
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+		p.skipSpace(true)
+		if p.eof() {
+			return nil, p.errorf("unterminated array")
+		}
+		if p.peek() == ',' {
+			p.pos++
+		} else if p.peek() != ']' {
+			return nil, p.errorf("expected , or ] in array")
+		}
+	}
+}
+
+func (p *tomlParser) parseInlineTable() (any, error) {
+	p.pos++
+	table := make(map[string]any)
+	for {
+		p.skipSpace(false)
+		if p.eof() {
+			return nil, p.errorf("unterminated inline table")
+		}
+		if p.peek() == '}' {
+			p.pos++
+			return table, nil
+		}
+		if err := p.parseKeyValue(table); err != nil {
+			return nil, err
+		}
+		p.skipSpace(false)
+		if p.eof() {
+			return nil, p.errorf("unterminated inline table")
+		}
+		if p.peek() == ',' {
+			p.pos++
+		} else if p.peek() != '}' {
+			return nil, p.errorf("expected , or } in inline table")
+		}
+	}
+}
+
+func (p *tomlParser) parseString() (string, error) {
+	quote := p.peek()
+	multiline := strings.HasPrefix(p.s[p.pos:], strings.Repeat(string(quote), 3))
+	if multiline {
+		p.pos += 3
+		// A newline right after the opening delimiter is trimmed.
+		if strings.HasPrefix(p.s[p.pos:], "\r\n") {
+			p.pos += 2
+			p.line++
+		} else if strings.HasPrefix(p.s[p.pos:], "\n") {
+			p.pos++
+			p.line++
+		}
+	} else {
+		p.pos++
+	}
+
+	var b strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.peek()
+		if c == quote {
+			if !multiline {
+				p.pos++
+				return b.String(), nil
+			}
+			if strings.HasPrefix(p.s[p.pos:], strings.Repeat(string(quote), 3)) {
+				p.pos += 3
+				return b.String(), nil
+			}
+		}
+		if c == '\n' {
+			if !multiline {
+				return "", p.errorf("newline in string")
+			}
+			p.line++
+		}
+		if c == '\\' && quote == '"' {
+			p.pos++
+			if err := p.parseEscape(&b, multiline); err != nil {
+				return "", err
+			}
+			continue
+		}
+		b.WriteByte(c)
+		p.pos++
+	}
+}
+
+func (p *tomlParser) parseEscape(b *strings.Builder, multiline bool) error {
+	if p.eof() {
+		return p.errorf("unterminated string")
+	}
+	c := p.peek()
+	p.pos++
+	switch c {
+	case 'b':
+		b.WriteByte('\b')
+	case 't':
+		b.WriteByte('\t')
+	case 'n':
+		b.WriteByte('\n')
+	case 'f':
+		b.WriteByte('\f')
+	case 'r':
+		b.WriteByte('\r')
+	case '"', '\\':
+		b.WriteByte(c)
+	case 'u', 'U':
+		size := 4
+		if c == 'U' {
+			size = 8
+		}
+		if p.pos+size > len(p.s) {
+			return p.errorf("invalid unicode escape")
+		}
+		n, err := strconv.ParseUint(p.s[p.pos:p.pos+size], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(n)) {
+			return p.errorf("invalid unicode escape")
+		}
+		b.WriteRune(rune(n))
+		p.pos += size
+	default:
+		// A line ending backslash trims the following whitespace.
+		if multiline && (c == '\n' || c == ' ' || c == '\t' || c == '\r') {
+			for p.pos--; !p.eof() && strings.ContainsRune(" \t\r\n", rune(p.peek())); p.pos++ {
+				if p.peek() == '\n' {
+					p.line++
+				}
+			}
+			return nil
+		}
+		return p.errorf("invalid escape \\%c", c)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTOMLValues(t *testing.T) {
+	tests := []struct {
+		value string
+		want  any
+	}{
+		// Integers.
+		{"0", int64(0)},
+		{"42", int64(42)},
+		{"+42", int64(42)},
+		{"-17", int64(-17)},
+		{"-0", int64(0)},
+		{"1_000", int64(1000)},
+		{"5_349_221", int64(5349221)},
+		// Floats.
+		{"3.14", 3.14},
+		{"-0.01", -0.01},
+		{"5e+22", 5e+22},
+		{"1e06", 1e06},
+		{"-2E-2", -2e-2},
+		{"6.626e-34", 6.626e-34},
+		{"224_617.445_991", 224617.445991},
+		{"0.5", 0.5},
+		{"inf", math.Inf(1)},
+		{"-inf", math.Inf(-1)},
+		// Booleans.
+		{"true", true},
+		{"false", false},
+		// Strings.
+		{`"a\tb\u00e9"`, "a\tb\u00e9"},
+		{`'C:\path'`, `C:\path`},
+		{"\"\"\"\nline\\\n    continued\"\"\"", "linecontinued"},
+		{"'''\nraw\\n'''", `raw\n`},
+		// Dates and times are kept as strings.
+		{"1979-05-27", "1979-05-27"},
+		{"1979-05-27T07:32:00Z", "1979-05-27T07:32:00Z"},
+		{"1979-05-27 07:32:00", "1979-05-27 07:32:00"},
+		// Arrays and inline tables.
+		{"[1, 2, 3]", []any{int64(1), int64(2), int64(3)}},
+		{"[\n  'a',\n  'b',\n]", []any{"a", "b"}},
+		{"{ a = 1, b.c = 'x' }", map[string]any{"a": int64(1), "b": map[string]any{"c": "x"}}},
+	}
+	for _, tt := range tests {
+		got, err := parseTOML("v = " + tt.value)
+		if err != nil {
+			t.Errorf("parseTOML(%q): %v", tt.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(got["v"], tt.want) {
+			t.Errorf("parseTOML(%q) = %#v, want %#v", tt.value, got["v"], tt.want)
+		}
+	}
+}
+
+func TestParseTOMLNaN(t *testing.T) {
+	got, err := parseTOML("v = nan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f, ok := got["v"].(float64); !ok || !math.IsNaN(f) {
+		t.Errorf("parseTOML(nan) = %#v, want NaN", got["v"])
+	}
+}
+
+func TestParseTOMLTables(t *testing.T) {
+	data := `
+name = "report"
+filters.since = "2024-01-01"
+
+[ingest]
+patch_ids = true
+
+[[repositories]]
+name = "api"
+[repositories.tags]
+pattern = "v*"
+
+[[repositories]]
+name = "web"
+[repositories.tags]
+pattern = "web-*"
+
+[components.core]
+paths = ["src/**"]
+`
+	want := map[string]any{
+		"name":    "report",
+		"filters": map[string]any{"since": "2024-01-01"},
+		"ingest":  map[string]any{"patch_ids": true},
+		"repositories": []any{
+			map[string]any{"name": "api", "tags": map[string]any{"pattern": "v*"}},
+			map[string]any{"name": "web", "tags": map[string]any{"pattern": "web-*"}},
+		},
+		"components": map[string]any{"core": map[string]any{"paths": []any{"src/**"}}},
+	}
+	got, err := parseTOML(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseTOML = %#v, want %#v", got, want)
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	tests := []struct {
+		data, err string
+	}{
+		// Numbers are decimal, without leading zeros.
+		{"v = 010", `line 1: invalid value "010"`},
+		{"v = 00", `line 1: invalid value "00"`},
+		{"v = 0x10", `line 1: invalid value "0x10"`},
+		{"v = 0o17", `line 1: invalid value "0o17"`},
+		{"v = 0b101", `line 1: invalid value "0b101"`},
+		{"v = 01.5", `line 1: invalid value "01.5"`},
+		// Underscores only go between digits.
+		{"v = _1", `line 1: invalid value "_1"`},
+		{"v = 1_", `line 1: invalid value "1_"`},
+		{"v = 1__000", `line 1: invalid value "1__000"`},
+		{"v = 1_.5", `line 1: invalid value "1_.5"`},
+		{"v = 1.", `line 1: invalid value "1."`},
+		{"v = .5", `line 1: invalid value ".5"`},
+		{"v = 99999999999999999999", `line 1: invalid integer "99999999999999999999"`},
+		// Tables and keys are defined once.
+		{"[a]\nx = 1\n\n[b]\n[a]\n", "line 5: table a already defined at line 1"},
+		{"[a.b]\n[a]\n[a.b]\n", "line 3: table a.b already defined at line 1"},
+		{"[[r]]\n[r.t]\n[r.t]\n", "line 3: table r.t already defined at line 2"},
+		{"a = 1\na = 2\n", "line 2: duplicate key a"},
+		{"a = 1\n[a]\n", "line 2: key a is not a table"},
+		// Syntax.
+		{"v = ", "line 1: expected value"},
+		{"v = 'x", "line 1: unterminated string"},
+		{"v = [1, 2", "line 1: unterminated array"},
+		{"[a\n", "line 1: expected ]"},
+		{"v = 1 2", `line 1: unexpected '2'`},
+		{`v = "\x"`, `line 1: invalid escape \x`},
+	}
+	for _, tt := range tests {
+		_, err := parseTOML(tt.data)
+		if err == nil {
+			t.Errorf("parseTOML(%q) succeeded, want error %q", tt.data, tt.err)
+		} else if !strings.HasSuffix(err.Error(), tt.err) {
+			t.Errorf("parseTOML(%q) = %v, want error %q", tt.data, err, tt.err)
+		}
+	}
+}
+
+func TestParseTOMLImplicitTables(t *testing.T) {
+	// A table created by a dotted header can be defined later on.
+	got, err := parseTOML("[a.b]\nx = 1\n[a]\ny = 2\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"a": map[string]any{"b": map[string]any{"x": int64(1)}, "y": int64(2)}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseTOML = %#v, want %#v", got, want)
+	}
+}
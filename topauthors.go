@@ -0,0 +1,94 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+)
+
+var authorSorts = map[string]func(a AuthorSummary) int{
+	"commits":   func(a AuthorSummary) int { return a.Commits },
+	"additions": func(a AuthorSummary) int { return a.Additions },
+	"deletions": func(a AuthorSummary) int { return a.Deletions },
+	"net":       func(a AuthorSummary) int { return a.Additions - a.Deletions },
+}
+
+func topAuthorsCommand(args []string) {
+	fs := flag.NewFlagSet("top-authors", flag.ExitOnError)
+	dbPath := fs.String("db", "report.db", "report database")
+	sortBy := fs.String("sort", "commits", "sort by commits, additions, deletions or net")
+	limit := fs.Int("limit", 10, "number of authors to print, 0 for all")
+	repository := fs.String("repository", "", "only count commits in this repository")
+	component := fs.String("component", "", "only count changes in this component")
+	since := fs.String("since", "", "only count commits from this date (YYYY-MM-DD)")
+	until := fs.String("until", "", "only count commits up to this date, inclusive (YYYY-MM-DD)")
+	release := fs.String("release", "", "only count commits released by this tag, or by the tags of a range such as v1.2..v1.3")
+	format := fs.String("format", "table", "output format: table, csv or json")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s top-authors [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	key, ok := authorSorts[*sortBy]
+	if !ok {
+		log.Fatalf("Unknown sort: %s", *sortBy)
+	}
+	from, to, err := parseDateRange(*since, *until)
+	if err != nil {
+		log.Fatalf("Invalid date range: %v", err)
+	}
+
+	db, err := openReportDatabase(*dbPath)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	components, err := loadComponentPatterns(db)
+	if err != nil {
+		log.Fatalf("Failed to load components: %v", err)
+	}
+	if *component != "" && !slices.ContainsFunc(components, func(c storedComponent) bool { return c.name == *component }) {
+		log.Fatalf("Unknown component: %s", *component)
+	}
+	report, err := loadFilteredReport(db, components, reportFilter{
+		Since:      from,
+		Until:      to,
+		Repository: *repository,
+		Component:  *component,
+		Release:    *release,
+	})
+	if err != nil {
+		log.Fatalf("Failed to load authors: %v", err)
+	}
+
+	authors := report.Authors
+	slices.SortStableFunc(authors, func(a, b AuthorSummary) int {
+		return cmp.Compare(key(b), key(a))
+	})
+	if *limit > 0 {
+		authors = authors[:min(*limit, len(authors))]
+	}
+
+	columns := []string{"author", "email", "commits", "additions", "deletions", "net"}
+	var records [][]any
+	for _, a := range authors {
+		records = append(records, []any{a.Author, a.Email, a.Commits, a.Additions, a.Deletions, a.Additions - a.Deletions})
+	}
+	w := bufio.NewWriter(os.Stdout)
+	if err := writeRecords(w, *format, columns, records); err != nil {
+		log.Fatalf("Failed to print authors: %v", err)
+	}
+	w.Flush()
+}
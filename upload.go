@@ -0,0 +1,59 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+func validateUploadURL(url string) error {
+	if !strings.HasPrefix(url, "s3://") && !strings.HasPrefix(url, "gs://") {
+		return fmt.Errorf("unsupported upload url: %s (expected s3:// or gs://)", url)
+	}
+	return nil
+}
+
+// uploadOutput copies an output file or directory below its upload URL
+// using the aws or gsutil command line tools, so credentials are resolved
+// the same way as for any other use of those tools.
+func uploadOutput(output Output) error {
+	info, err := os.Stat(output.Path)
+	if err != nil {
+		return err
+	}
+	prefix := strings.TrimSuffix(output.Upload, "/") + "/"
+	name := filepath.Base(output.Path)
+
+	var cmd *exec.Cmd
+	if strings.HasPrefix(prefix, "s3://") {
+		args := []string{"s3", "cp", "--only-show-errors"}
+		if info.IsDir() {
+			args = append(args, "--recursive", output.Path, prefix+name+"/")
+		} else {
+			args = append(args, output.Path, prefix+name)
+		}
+		cmd = exec.Command("aws", args...)
+	} else {
+		args := []string{"-q", "-m", "cp"}
+		if info.IsDir() {
+			args = append(args, "-r")
+		}
+		// A trailing slash makes gsutil keep the directory name.
+		args = append(args, output.Path, prefix)
+		cmd = exec.Command("gsutil", args...)
+	}
+
+	slog.Info("Uploading output", "path", output.Path, "url", prefix+name)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %v", cmd.Args[0], err)
+	}
+	return nil
+}
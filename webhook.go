@@ -0,0 +1,96 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type Webhook struct {
+	URL string `yaml:"url"`
+	// Format is the payload sent: slack (default) or json.
+	Format string `yaml:"format"`
+}
+
+type webhookPayload struct {
+	Repositories []webhookRepository `json:"repositories"`
+	Commits      int                 `json:"commits"`
+	TopAuthors   []webhookAuthor     `json:"top_authors"`
+}
+
+type webhookRepository struct {
+	Name    string `json:"name"`
+	Commits int    `json:"commits"`
+	Authors int    `json:"authors"`
+}
+
+type webhookAuthor struct {
+	Author  string `json:"author"`
+	Email   string `json:"email"`
+	Commits int    `json:"commits"`
+}
+
+func validateWebhook(hook Webhook) error {
+	if !strings.HasPrefix(hook.URL, "https://") && !strings.HasPrefix(hook.URL, "http://") {
+		return fmt.Errorf("invalid webhook url: %s", hook.URL)
+	}
+	switch hook.Format {
+	case "", "slack", "json":
+	default:
+		return fmt.Errorf("unsupported webhook format: %s", hook.Format)
+	}
+	return nil
+}
+
+// notifyWebhook posts a short run summary to the configured webhook.
+func notifyWebhook(db *sql.DB, hook Webhook) error {
+	report, err := loadReport(db)
+	if err != nil {
+		return err
+	}
+
+	var payload any
+	if hook.Format == "json" {
+		p := webhookPayload{Repositories: []webhookRepository{}, TopAuthors: []webhookAuthor{}}
+		for _, repo := range report.Repositories {
+			p.Repositories = append(p.Repositories, webhookRepository{repo.Name, repo.Commits, repo.Authors})
+			p.Commits += repo.Commits
+		}
+		for _, a := range report.Authors[:min(summaryTop, len(report.Authors))] {
+			p.TopAuthors = append(p.TopAuthors, webhookAuthor{a.Author, a.Email, a.Commits})
+		}
+		payload = p
+	} else {
+		var text strings.Builder
+		fmt.Fprintf(&text, "*git-report* generated %s\n```\n", formatDate(report.GeneratedAt))
+		renderSummary(&text, report)
+		text.WriteString("```")
+		payload = map[string]string{"text": text.String()}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	slog.Info("Posting summary to webhook")
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(hook.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// PathWeight scales the lines of the file changes matching Paths, patterns
+// in [repo:]path form, in the effort of a component, e.g. 0.1 for
+// generated code.
+type PathWeight struct {
+	Paths  []string `yaml:"paths" json:"paths"`
+	Weight float64  `yaml:"weight" json:"weight"`
+}
+
+// withWeights returns components with the weights of the configuration
+// appended to their own, which take precedence.
+func withWeights(components []Component, weights []PathWeight) []Component {
+	if len(weights) == 0 {
+		return components
+	}
+	weighted := slices.Clone(components)
+	for i := range weighted {
+		weighted[i].Weights = slices.Concat(weighted[i].Weights, weights)
+	}
+	return weighted
+}
+
+// weight returns the weight of the component, 1 unless set.
+func (c Component) weight() float64 {
+	if c.Weight == 0 {
+		return 1
+	}
+	return c.Weight
+}
+
+// lineWeight returns the weight of the lines of a change to path in
+// repoName credited to the component: its weight scaled by that of the
+// first of its weights matching the path.
+func (c Component) lineWeight(repoName, path string) float64 {
+	weight := c.weight()
+	for _, w := range c.Weights {
+		for _, pattern := range w.Paths {
+			if repo, pattern, ok := strings.Cut(pattern, ":"); ok && repo == repoName && matchPathFold(path, pattern, c.CaseInsensitive) {
+				return weight * w.Weight
+			}
+		}
+	}
+	return weight
+}
+
+// validateWeights adds the problems of weights to problems, prefixed with
+// what they belong to.
+func validateWeights(problems *validationErrors, loc located, owner string, weights []PathWeight) {
+	for i, w := range weights {
+		field := fmt.Sprintf("weights.%d", i)
+		if len(w.Paths) == 0 {
+			problems.add(loc, field, "%sweights[%d] has no paths", owner, i)
+		}
+		if w.Weight < 0 {
+			problems.add(loc, field, "%sweights[%d] weight %v is negative", owner, i, w.Weight)
+		}
+		for _, pattern := range w.Paths {
+			if repo, path := splitRepoPattern(pattern); repo == "" || path == "" {
+				problems.add(loc, field, "%sweights pattern %q is not in [repo:]path form", owner, pattern)
+			} else if err := validatePattern(path); err != nil {
+				problems.add(loc, field, "%sweights pattern %q: %v", owner, pattern, err)
+			}
+		}
+	}
+}
+
+// encodePathWeights returns the weights stored in components.path_weights,
+// empty without any.
+func encodePathWeights(weights []PathWeight) (string, error) {
+	if len(weights) == 0 {
+		return "", nil
+	}
+	encoded, err := json.Marshal(weights)
+	return string(encoded), err
+}
+
+// decodePathWeights parses the weights stored in components.path_weights.
+func decodePathWeights(encoded string) ([]PathWeight, error) {
+	var weights []PathWeight
+	if encoded == "" {
+		return weights, nil
+	}
+	err := json.Unmarshal([]byte(encoded), &weights)
+	return weights, err
+}
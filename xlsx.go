@@ -0,0 +1,193 @@
+// Copyright Jeremías Casteglione <jrmsdev@gmail.com>
+// See LICENSE file.
+
+package main
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Minimal Office Open XML workbook writer. Cells use inline strings so no
+// shared strings table or styles part is needed.
+
+type xlsxSheet struct {
+	name string
+	rows [][]any
+}
+
+var xlsxHeader = []any{"author", "email", "repository", "component", "commits", "additions", "deletions"}
+
+var xlsxTeamHeader = []any{"team", "component", "contributors", "commits", "additions", "deletions"}
+
+func renderXLSXExport(db *sql.DB, w io.Writer) error {
+	summary := &xlsxSheet{name: "Summary", rows: [][]any{xlsxHeader}}
+	sheets := []*xlsxSheet{summary}
+	used := map[string]bool{strings.ToLower(summary.name): true}
+
+	teams, err := loadTeamSummaries(db)
+	if err != nil {
+		return err
+	}
+	if len(teams) > 0 {
+		sheet := &xlsxSheet{name: xlsxSheetName("Teams", used), rows: [][]any{xlsxTeamHeader}}
+		for _, t := range teams {
+			sheet.rows = append(sheet.rows, []any{t.Team, t.Component, t.Contributors, t.Commits, t.Additions, t.Deletions})
+		}
+		sheets = append(sheets, sheet)
+	}
+
+	rows, err := db.Query(`
+		SELECT cc.author, cc.email, r.name, co.name,
+			cc.commit_count, cc.total_additions, cc.total_deletions
+		FROM component_contributions cc
+		JOIN components co ON co.id = cc.component_id
+		JOIN repositories r ON r.id = cc.repository_id
+		ORDER BY co.id, cc.commit_count DESC, cc.email
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	byComponent := make(map[string]*xlsxSheet)
+
+	for rows.Next() {
+		var author, email, repo, component string
+		var commits, additions, deletions int
+		if err := rows.Scan(&author, &email, &repo, &component, &commits, &additions, &deletions); err != nil {
+			return err
+		}
+		row := []any{author, email, repo, component, commits, additions, deletions}
+		summary.rows = append(summary.rows, row)
+
+		sheet, ok := byComponent[component]
+		if !ok {
+			sheet = &xlsxSheet{name: xlsxSheetName(component, used), rows: [][]any{xlsxHeader}}
+			byComponent[component] = sheet
+			sheets = append(sheets, sheet)
+		}
+		sheet.rows = append(sheet.rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return writeXLSX(w, sheets)
+}
+
+// xlsxSheetName returns a unique sheet name valid for Excel: at most 31
+// characters and none of []:*?/\.
+func xlsxSheetName(name string, used map[string]bool) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" {
+		name = "Sheet"
+	}
+
+	base := []rune(name)
+	if len(base) > 31 {
+		base = base[:31]
+	}
+	candidate := string(base)
+	for i := 2; used[strings.ToLower(candidate)]; i++ {
+		suffix := fmt.Sprintf(" (%d)", i)
+		n := min(len(base), 31-len(suffix))
+		candidate = string(base[:n]) + suffix
+	}
+	used[strings.ToLower(candidate)] = true
+	return candidate
+}
+
+func writeXLSX(w io.Writer, sheets []*xlsxSheet) error {
+	z := zip.NewWriter(w)
+
+	file := func(name, content string) error {
+		f, err := z.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(f, content)
+		return err
+	}
+
+	var types, sheetList, rels strings.Builder
+	for i, sheet := range sheets {
+		n := i + 1
+		fmt.Fprintf(&types, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+		fmt.Fprintf(&sheetList, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(sheet.name), n, n)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, n, n)
+	}
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			types.String() + `</Types>`},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets>` + sheetList.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			rels.String() + `</Relationships>`},
+	}
+	for _, part := range parts {
+		if err := file(part.name, part.content); err != nil {
+			return err
+		}
+	}
+
+	for i, sheet := range sheets {
+		if err := file(fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), xlsxSheetXML(sheet)); err != nil {
+			return err
+		}
+	}
+
+	return z.Close()
+}
+
+func xlsxSheetXML(sheet *xlsxSheet) string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for r, row := range sheet.rows {
+		fmt.Fprintf(&b, `<row r="%d">`, r+1)
+		for c, value := range row {
+			ref := xlsxColumn(c) + fmt.Sprint(r+1)
+			switch v := value.(type) {
+			case int:
+				fmt.Fprintf(&b, `<c r="%s"><v>%d</v></c>`, ref, v)
+			default:
+				fmt.Fprintf(&b, `<c r="%s" t="inlineStr"><is><t>%s</t></is></c>`, ref, xmlEscape(fmt.Sprint(v)))
+			}
+		}
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</sheetData></worksheet>`)
+	return b.String()
+}
+
+// xlsxColumn returns the spreadsheet column letters for a zero based index.
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}